@@ -2,21 +2,11 @@ package handler
 
 import (
 	"net/http"
-	"time"
 
-	"giscus-proxy/internal/cache"
-	"giscus-proxy/internal/proxy"
+	"github.com/cdlus/giscus-proxy/internal/config"
 )
 
-var defaultHandler http.Handler
-
-func init() {
-	p := proxy.New(proxy.Config{
-		Client: &http.Client{Timeout: 25 * time.Second},
-		Cache:  cache.NewMemoryCache(256),
-	})
-	defaultHandler = p.Handler()
-}
+var defaultHandler = config.PlatformHandler(256)
 
 // Handler is the entry point for Vercel's Go runtime.
 func Handler(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,23 @@
+// Command giscus-proxy-lambda runs the proxy on AWS Lambda behind a Function URL
+// or an API Gateway HTTP API (payload format 2.0).
+package main
+
+import (
+	"log"
+
+	awslambda "github.com/aws/aws-lambda-go/lambda"
+
+	"github.com/cdlus/giscus-proxy/internal/config"
+	"github.com/cdlus/giscus-proxy/internal/lambda"
+	"github.com/cdlus/giscus-proxy/internal/proxy"
+)
+
+func main() {
+	// Warm invocations reuse the process, so the cache survives between requests.
+	cfg, err := config.Platform(256)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p := proxy.New(cfg)
+	awslambda.Start(lambda.Adapter{Handler: p.Handler()}.Handle)
+}
@@ -0,0 +1,25 @@
+// Command giscus-proxy-netlify runs the proxy as a Netlify Function. netlify.toml
+// builds it into netlify/functions and rewrites every path to it.
+package main
+
+import (
+	"log"
+
+	awslambda "github.com/aws/aws-lambda-go/lambda"
+
+	"github.com/cdlus/giscus-proxy/internal/config"
+	"github.com/cdlus/giscus-proxy/internal/lambda"
+	"github.com/cdlus/giscus-proxy/internal/proxy"
+)
+
+func main() {
+	cfg, err := config.Platform(256)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p := proxy.New(cfg)
+	awslambda.Start(lambda.Adapter{
+		Handler:     p.Handler(),
+		StripPrefix: "/.netlify/functions/giscus-proxy",
+	}.HandleV1)
+}
@@ -0,0 +1,29 @@
+//go:build js && wasm
+
+// Command giscus-proxy-workers is the WebAssembly build of the proxy for
+// Cloudflare Workers; workers/worker.mjs loads it and forwards fetch events.
+// Build it with GOOS=js GOARCH=wasm.
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+	"github.com/cdlus/giscus-proxy/internal/config"
+	"github.com/cdlus/giscus-proxy/internal/proxy"
+	"github.com/cdlus/giscus-proxy/internal/workers"
+)
+
+func main() {
+	// Worker variables and secrets arrive as environment variables.
+	cfg, err := config.Proxy()
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.Client = &http.Client{Transport: workers.Transport{}, Timeout: 25 * time.Second}
+	// An isolate serves many requests, so the cache survives between them.
+	cfg.Cache = cache.NewMemoryCache(config.GetInt("CACHE_SIZE", 256))
+	workers.Serve(proxy.New(cfg).Handler())
+}
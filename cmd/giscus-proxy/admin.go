@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/cdlus/giscus-proxy/internal/config"
+)
+
+// adminFlags are the settings needed to reach a running instance's admin API.
+var adminFlags = []string{"ADMIN_PREFIX", "ADMIN_TOKEN", "ADMIN_USER", "ADMIN_PASSWORD", "BASE_PATH"}
+
+// withBasePath appends BASE_PATH to an instance URL.
+func withBasePath(base string) string {
+	base = strings.TrimRight(base, "/")
+	if bp := strings.Trim(config.GetEnv("BASE_PATH", ""), "/"); bp != "" {
+		base += "/" + bp
+	}
+	return base
+}
+
+// adminURL joins an instance URL and an admin endpoint such as "/purge".
+func adminURL(base, endpoint string) string {
+	return strings.TrimRight(base, "/") + config.GetEnv("ADMIN_PREFIX", "/_admin") + endpoint
+}
+
+// adminCredentials reports whether admin credentials are configured.
+func adminCredentials() bool {
+	return config.GetEnv("ADMIN_TOKEN", "") != "" || config.GetEnv("ADMIN_USER", "") != ""
+}
+
+// adminRequest builds an admin API request with the configured credentials.
+func adminRequest(ctx context.Context, method, u string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token := config.GetEnv("ADMIN_TOKEN", ""); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if user := config.GetEnv("ADMIN_USER", ""); user != "" {
+		req.SetBasicAuth(user, os.Getenv("ADMIN_PASSWORD"))
+	}
+	return req, nil
+}
+
+// localInstance returns the base URL and a client for the instance listening on
+// this machine's ADDR or HOST/PORT, preferring TCP and falling back to a Unix
+// socket.
+func localInstance() (string, *http.Client) {
+	addrs := config.Addrs()
+	for _, a := range addrs {
+		if strings.HasPrefix(a, "unix:") {
+			continue
+		}
+		host, port, err := net.SplitHostPort(a)
+		if err != nil {
+			continue
+		}
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "127.0.0.1"
+		}
+		return withBasePath("http://" + net.JoinHostPort(host, port)), http.DefaultClient
+	}
+	for _, a := range addrs {
+		if path, ok := strings.CutPrefix(a, "unix:"); ok {
+			var d net.Dialer
+			client := &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return d.DialContext(ctx, "unix", path)
+				},
+			}}
+			return withBasePath("http://localhost"), client
+		}
+	}
+	return withBasePath("http://127.0.0.1:8080"), http.DefaultClient
+}
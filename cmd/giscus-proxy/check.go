@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+	"github.com/cdlus/giscus-proxy/internal/config"
+	"github.com/cdlus/giscus-proxy/internal/proxy"
+)
+
+// runCheck validates the configuration the way serve would load it and runs the
+// readiness checks once. Problems found by Config.Validate fail the config check;
+// ignored settings are logged as warnings while the proxy is built. It returns the process exit code.
+func runCheck(args []string) int {
+	fs := newFlagSet("check", "Validate the configuration and check that upstream is reachable.")
+	envFlags(fs, serveFlags...)
+	loadConfig(fs, args)
+
+	failed := false
+	report := func(name string, err error) {
+		if err != nil {
+			failed = true
+			// Joined errors print one problem per line; align them under the first.
+			fmt.Printf("%-10s FAIL %s\n", name, strings.ReplaceAll(err.Error(), "\n", "\n"+strings.Repeat(" ", 16)))
+			return
+		}
+		fmt.Printf("%-10s ok\n", name)
+	}
+
+	cfg, err := config.Proxy()
+	if err == nil {
+		cfg.Cache = cache.NewMemoryCache(config.GetInt("CACHE_SIZE", 512))
+		// Read the server settings serve uses, so their malformed values count.
+		_, _, _ = config.Limits(), config.Drain(), config.TLS()
+		err = errors.Join(config.ParseErrors(), cfg.Validate())
+	}
+	report("config", err)
+	client, err := config.HTTPClient()
+	report("client", err)
+	if err == nil {
+		cfg.Client = client
+	}
+	_, shutdownTracing, err := config.Tracing(context.Background())
+	report("tracing", err)
+	if err == nil {
+		defer shutdownTracing(context.Background())
+	}
+	if t := config.TLS(); t.CertFile != "" || t.KeyFile != "" {
+		_, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		report("tls", err)
+	}
+	if failed {
+		return 1
+	}
+
+	p := proxy.New(cfg)
+	defer p.Close()
+	checks, ok := p.Check(context.Background())
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if res := checks[name]; res == "ok" || res == "disabled" {
+			fmt.Printf("%-10s %s\n", name, res)
+		} else {
+			fmt.Printf("%-10s FAIL %s\n", name, res)
+		}
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"os/signal"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/bench"
+	"github.com/cdlus/giscus-proxy/internal/cache"
+	"github.com/cdlus/giscus-proxy/internal/config"
+	"github.com/cdlus/giscus-proxy/internal/proxy"
+)
+
+// runLoadtest replays a traffic pattern against an in-process proxy, built from
+// the same configuration as serve but backed by a fake giscus upstream, or
+// against a running instance given with -url. It returns the process exit code,
+// which is 1 when a threshold is exceeded.
+func runLoadtest(args []string) int {
+	fs := newFlagSet("loadtest", "Replay traffic against a local instance with a fake upstream and report throughput, latency and allocations.")
+	target := fs.String("url", "", "load a running instance at this base `URL` instead of an in-process one")
+	trafficFile := fs.String("traffic", "", "replay requests from `file`, one JSON request or proxy log line per line (default: one page view)")
+	concurrency := fs.Int("concurrency", 16, "requests in flight at once")
+	duration := fs.Duration("duration", 10*time.Second, "how long to run")
+	requests := fs.Int("requests", 0, "stop after this many requests")
+	latency := fs.Duration("upstream-latency", 0, "delay of the fake upstream's responses")
+	cpuProfile := fs.String("cpuprofile", "", "write a CPU profile to `file`")
+	memProfile := fs.String("memprofile", "", "write an allocation profile to `file`")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	maxP99 := fs.Duration("max-p99", 0, "fail when the p99 latency exceeds this")
+	minRPS := fs.Float64("min-rps", 0, "fail when throughput is below this many requests per second")
+	maxErrorRate := fs.Float64("max-error-rate", 0, "fail when more than this fraction of requests fail")
+	maxAlloc := fs.Uint64("max-alloc", 0, "fail when the in-process run allocates more than this many `bytes` per request")
+	envFlags(fs, "CACHE_SIZE")
+	loadConfig(fs, args)
+
+	traffic := bench.DefaultTraffic
+	if *trafficFile != "" {
+		f, err := os.Open(*trafficFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		traffic, err = bench.ParseTraffic(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *trafficFile, err)
+			return 1
+		}
+	}
+
+	inProcess := *target == ""
+	if inProcess {
+		up := bench.NewUpstream(*latency)
+		defer up.Close()
+		cfg, err := config.Proxy()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		// Everything goes to the fake upstream; per-request logs would only
+		// measure the terminal.
+		cfg.UpstreamOrigin, cfg.APIOrigin, cfg.GitHubToken = up.URL, "", ""
+		for i := range cfg.Tenants {
+			cfg.Tenants[i].UpstreamOrigin = ""
+		}
+		cfg.Cache = cache.NewMemoryCache(config.GetInt("CACHE_SIZE", 512))
+		cfg.Logger = log.New(io.Discard, "", 0)
+		p := proxy.New(cfg)
+		defer p.Close()
+		srv := httptest.NewServer(p.Handler())
+		defer srv.Close()
+		*target = srv.URL + p.BasePath()
+	}
+
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		if err := pprof.StartCPUProfile(f); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	rep, err := bench.Run(ctx, bench.Options{
+		Target:      *target,
+		Traffic:     traffic,
+		Concurrency: *concurrency,
+		Duration:    *duration,
+		Requests:    *requests,
+	})
+	runtime.ReadMemStats(&after)
+	if *cpuProfile != "" {
+		pprof.StopCPUProfile()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// The load generator shares the process, so its own allocations are included.
+	if inProcess && rep.Requests > 0 {
+		n := uint64(rep.Requests)
+		rep.Allocations = &bench.Allocations{
+			BytesPerRequest:   (after.TotalAlloc - before.TotalAlloc) / n,
+			ObjectsPerRequest: (after.Mallocs - before.Mallocs) / n,
+			GCs:               after.NumGC - before.NumGC,
+		}
+	}
+	if *memProfile != "" {
+		if err := writeAllocProfile(*memProfile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(rep)
+	} else {
+		fmt.Printf("target     %s\n", *target)
+		rep.WriteText(os.Stdout)
+	}
+
+	failed := false
+	fail := func(format string, args ...any) {
+		failed = true
+		fmt.Fprintf(os.Stderr, "FAIL "+format+"\n", args...)
+	}
+	if *maxP99 > 0 && rep.Latency.P99 > *maxP99 {
+		fail("p99 latency %s exceeds %s", rep.Latency.P99, *maxP99)
+	}
+	if *minRPS > 0 && rep.Throughput < *minRPS {
+		fail("throughput %.1f/s is below %.1f/s", rep.Throughput, *minRPS)
+	}
+	if *maxErrorRate > 0 && rep.Requests > 0 && float64(rep.Errors)/float64(rep.Requests) > *maxErrorRate {
+		fail("error rate %.4f exceeds %.4f", float64(rep.Errors)/float64(rep.Requests), *maxErrorRate)
+	}
+	if *maxAlloc > 0 && rep.Allocations != nil && rep.Allocations.BytesPerRequest > *maxAlloc {
+		fail("%d bytes allocated per request exceeds %d", rep.Allocations.BytesPerRequest, *maxAlloc)
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+func writeAllocProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup("allocs").WriteTo(f, 0); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
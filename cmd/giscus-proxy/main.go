@@ -1,47 +1,106 @@
+// Command giscus-proxy serves the proxy as a standalone HTTP server and bundles
+// tools to validate its configuration and manage a running instance.
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"strings"
-	"time"
 
-	"giscus-proxy/internal/cache"
-	"giscus-proxy/internal/config"
-	"giscus-proxy/internal/proxy"
+	"github.com/cdlus/giscus-proxy/internal/config"
 )
 
+const usage = `Usage: giscus-proxy [command] [flags]
+
+Commands:
+  serve     start the proxy server (default)
+  check     validate the configuration and check that upstream is reachable
+  purge     drop cached responses on a running instance through the admin API
+  prestop   drain the local instance and wait (Kubernetes preStop hook)
+  loadtest  replay traffic against a local instance and report performance
+  version   print version information (also -version)
+
+Run "giscus-proxy <command> -h" for the flags of a command. Every setting can
+also come from the environment or a -config file; flags take precedence.
+`
+
 func main() {
-	client := &http.Client{Timeout: 25 * time.Second}
-	p := proxy.New(proxy.Config{
-		Client: client,
-		Cache:  cache.NewMemoryCache(512),
-	})
-
-	handler := p.Handler()
-	mux := http.NewServeMux()
-	p.Register(mux)
-
-	addr := strings.TrimSpace(os.Getenv("ADDR"))
-	if addr == "" {
-		host := config.GetEnv("HOST", "0.0.0.0")
-		port := config.GetEnv("PORT", "8080")
-		port = strings.TrimPrefix(port, ":")
-		addr = host + ":" + port
+	args := os.Args[1:]
+	cmd := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	} else if len(args) > 0 && (args[0] == "-version" || args[0] == "--version") {
+		cmd, args = "version", args[1:]
 	}
+	switch cmd {
+	case "serve":
+		runServe(args)
+	case "check":
+		os.Exit(runCheck(args))
+	case "purge":
+		os.Exit(runPurge(args))
+	case "prestop":
+		os.Exit(runPrestop(args))
+	case "loadtest":
+		os.Exit(runLoadtest(args))
+	case "version":
+		runVersion(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
+}
+
+func newFlagSet(name, summary string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: giscus-proxy %s [flags]\n\n%s\n\nFlags:\n", name, summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// envValue is a flag that sets an environment variable, so it overrides both the
+// environment and the config file for everything reading that variable.
+type envValue string
 
-	log.SetOutput(os.Stdout)
+func (v envValue) String() string { return "" }
 
-	srv := &http.Server{
-		Addr:              addr,
-		Handler:           handler,
-		Handler:           mux,
-		ReadHeaderTimeout: 5 * time.Second,
-		ErrorLog:          log.New(os.Stdout, "", 0),
+func (v envValue) Set(s string) error { return os.Setenv(string(v), s) }
+
+// envFlags registers a flag per variable, named after it: UPSTREAM_ORIGIN
+// becomes -upstream-origin.
+func envFlags(fs *flag.FlagSet, vars ...string) {
+	for _, key := range vars {
+		name := strings.ReplaceAll(strings.ToLower(key), "_", "-")
+		fs.Var(envValue(key), name, "sets "+key)
+	}
+}
+
+// envAssignments collects repeated -env KEY=VALUE flags.
+type envAssignments struct{}
+
+func (envAssignments) String() string { return "" }
+
+func (envAssignments) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("want KEY=VALUE, got %q", s)
 	}
+	return os.Setenv(k, v)
+}
 
-	publicURL := config.DerivePublicURL(addr, config.GetEnv("HOST", ""), config.GetEnv("PORT", ""))
-	log.Printf("giscus proxy listening: bind=%s url=%s", addr, publicURL)
-	log.Fatal(srv.ListenAndServe())
+// loadConfig registers -config and -env on fs, parses args and loads the config
+// file. Flag values are already in the environment by then, so they win.
+func loadConfig(fs *flag.FlagSet, args []string) {
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration `file`; environment variables override its values")
+	fs.Var(envAssignments{}, "env", "set any setting as `KEY=VALUE` (repeatable)")
+	_ = fs.Parse(args)
+	if err := config.Load(*configFile); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cdlus/giscus-proxy/internal/config"
+)
+
+// writePIDFile records this process in PID_FILE, so supervisors such as systemd
+// (PIDFile=) follow the process that took over after an upgrade. The returned
+// function removes the file unless another process has rewritten it.
+func writePIDFile() func() {
+	path := config.GetEnv("PID_FILE", "")
+	if path == "" {
+		return func() {}
+	}
+	pid := strconv.Itoa(os.Getpid())
+	if err := os.WriteFile(path, []byte(pid+"\n"), 0o644); err != nil {
+		log.Printf("pid file: %v", err)
+		return func() {}
+	}
+	return func() {
+		if b, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(b)) == pid {
+			_ = os.Remove(path)
+		}
+	}
+}
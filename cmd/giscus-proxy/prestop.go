@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/config"
+)
+
+// defaultPrestopWait applies when neither -wait nor SHUTDOWN_DELAY is set; it is
+// long enough for endpoint controllers and ingresses to drop the pod.
+const defaultPrestopWait = 5 * time.Second
+
+// runPrestop is meant for a Kubernetes preStop exec hook, where the distroless
+// image has no sleep binary. It asks the local instance to start draining when
+// admin credentials are configured, then keeps the pod serving for the wait so
+// traffic moves elsewhere before SIGTERM. The server then skips SHUTDOWN_DELAY.
+func runPrestop(args []string) int {
+	fs := newFlagSet("prestop", "Drain the local instance and wait, for use as a Kubernetes preStop hook.")
+	target := fs.String("url", "", "base `URL` of the instance (default derived from ADDR or HOST/PORT, plus BASE_PATH)")
+	wait := fs.Duration("wait", 0, "how long to keep serving after draining (default SHUTDOWN_DELAY, else 5s)")
+	envFlags(fs, append([]string{"ADDR", "HOST", "PORT", "SHUTDOWN_DELAY"}, adminFlags...)...)
+	loadConfig(fs, args)
+
+	d := *wait
+	if d == 0 {
+		d = config.GetDuration("SHUTDOWN_DELAY", defaultPrestopWait)
+	}
+	if d == 0 {
+		d = defaultPrestopWait
+	}
+
+	if adminCredentials() {
+		base, client := localInstance()
+		if *target != "" {
+			base, client = *target, http.DefaultClient
+		}
+		if err := requestDrain(client, adminURL(base, "/drain")); err != nil {
+			// Keep waiting anyway: the pod is already leaving the endpoints.
+			fmt.Fprintf(os.Stderr, "prestop: %v\n", err)
+		}
+	}
+	time.Sleep(d)
+	return 0
+}
+
+func requestDrain(client *http.Client, u string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := adminRequest(ctx, http.MethodPost, u)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return fmt.Errorf("drain failed: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/config"
+)
+
+// pathList collects repeated -path flags.
+type pathList []string
+
+func (l *pathList) String() string { return strings.Join(*l, ",") }
+
+func (l *pathList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// runPurge calls the admin purge endpoint of a running instance. Credentials and
+// the admin prefix default to the same settings the server reads. It returns the
+// process exit code.
+func runPurge(args []string) int {
+	fs := newFlagSet("purge", "Drop cached responses on a running instance through the admin API.")
+	target := fs.String("url", "", "base `URL` of the instance (default PUBLIC_URL or the detected platform URL, else http://localhost:PORT, plus BASE_PATH)")
+	var paths pathList
+	fs.Var(&paths, "path", "only purge responses whose path starts with `prefix` (repeatable)")
+	envFlags(fs, adminFlags...)
+	loadConfig(fs, args)
+
+	base := *target
+	if base == "" {
+		base = config.PublicURL()
+		if base == "" {
+			base = "http://localhost:" + strings.TrimPrefix(config.GetEnv("PORT", "8080"), ":")
+		}
+		base = withBasePath(base)
+	}
+	q := url.Values{"path": paths}
+	u := adminURL(base, "/purge")
+	if len(paths) > 0 {
+		u += "?" + q.Encode()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	req, err := adminRequest(ctx, http.MethodPost, u)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "purge failed: %s: %s\n", resp.Status, strings.TrimSpace(string(body)))
+		return 1
+	}
+	fmt.Print(string(body))
+	return 0
+}
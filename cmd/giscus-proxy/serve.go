@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+	"github.com/cdlus/giscus-proxy/internal/config"
+	"github.com/cdlus/giscus-proxy/internal/proxy"
+	"github.com/cdlus/giscus-proxy/internal/server"
+)
+
+// serveFlags are the settings serve and check accept as flags, on top of -env.
+var serveFlags = []string{
+	"ADDR", "HOST", "PORT", "PUBLIC_URL", "UPSTREAM_ORIGIN", "CACHE_SIZE",
+	"LOG_LEVEL", "LOG_OUTPUT", "ADMIN_PREFIX", "ADMIN_TOKEN",
+	"TLS_CERT_FILE", "TLS_KEY_FILE", "METRICS_ENABLED",
+}
+
+// runServe starts the proxy and serves until SIGINT or SIGTERM. It refuses to
+// start with a configuration Config.Validate rejects.
+func runServe(args []string) {
+	fs := newFlagSet("serve", "Start the proxy server.")
+	envFlags(fs, serveFlags...)
+	loadConfig(fs, args)
+
+	logOut, err := config.LogOutput()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.SetOutput(logOut)
+
+	cfg, err := config.Proxy()
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.Client, err = config.HTTPClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.Cache = cache.NewMemoryCache(config.GetInt("CACHE_SIZE", 512))
+	if err := errors.Join(config.ParseErrors(), cfg.Validate()); err != nil {
+		log.Fatalf("invalid config:\n%v", err)
+	}
+	tp, shutdownTracing, err := config.Tracing(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if tp != nil {
+		cfg.TracerProvider = tp
+	}
+	p := proxy.New(cfg)
+
+	addrs := config.Addrs()
+	addr := strings.Join(addrs, ",")
+
+	srv := p.Server()
+	srv.Addr = addrs[0]
+	srv.ErrorLog = log.New(logOut, "", 0)
+	limits := config.Limits()
+	limits.Apply(srv)
+	tlsCfg := config.TLS()
+	drain := config.Drain()
+	// The server settings are read last; reject their malformed values too.
+	if err := config.ParseErrors(); err != nil {
+		log.Fatalf("invalid config:\n%v", err)
+	}
+	lns, err := limits.ListenAll(addrs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	serve := func() error { return server.ServeAll(lns, srv.Serve) }
+	if tlsCfg.Enabled() {
+		log.Printf("giscus proxy listening: bind=%s tls=on redirect=%s", addr, tlsCfg.RedirectAddr)
+		serve = func() error { return tlsCfg.Serve(srv, lns...) }
+	} else {
+		publicURL := config.PublicURL()
+		for _, a := range addrs {
+			if !strings.HasPrefix(a, "unix:") {
+				publicURL = config.DerivePublicURL(a, config.GetEnv("HOST", ""), config.GetEnv("PORT", ""))
+				break
+			}
+		}
+		log.Printf("giscus proxy listening: bind=%s url=%s", addr, publicURL+p.BasePath())
+	}
+
+	// Listeners are bound, so connections queue from here on; a parent process
+	// handing over after an upgrade may stop accepting.
+	if err := server.Ready(); err != nil {
+		log.Printf("upgrade: %v", err)
+	}
+	removePIDFile := writePIDFile()
+	defer removePIDFile()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, upgraded := watchUpgrades(ctx)
+	// After an upgrade the new process already accepts on the same sockets, so
+	// there is nothing to wait out before closing ours.
+	drain.Drained = func() bool { return p.Draining() || upgraded.Load() }
+	err = drain.Run(ctx, srv, serve, func() {
+		if upgraded.Load() {
+			log.Printf("shutting down after upgrade: waiting up to %s for requests", drain.Timeout)
+		} else if p.Draining() {
+			log.Printf("shutting down: already draining, waiting up to %s for requests", drain.Timeout)
+		} else {
+			log.Printf("shutting down: draining for up to %s", drain.Delay+drain.Timeout)
+		}
+		p.Drain()
+		// Answer with Connection: close from now on so load balancers stop
+		// reusing connections that are about to be shut.
+		srv.SetKeepAlivesEnabled(false)
+	})
+	p.Close()
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	_ = shutdownTracing(flushCtx)
+	cancel()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("shutdown complete")
+}
@@ -0,0 +1,48 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/config"
+	"github.com/cdlus/giscus-proxy/internal/server"
+)
+
+// watchUpgrades starts a new copy of the binary on SIGHUP and, once it serves on
+// the inherited listeners, cancels the returned context so this process drains
+// and exits. The flag reports whether that happened.
+func watchUpgrades(ctx context.Context) (context.Context, *atomic.Bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	var upgraded atomic.Bool
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	timeout := config.GetDuration("UPGRADE_TIMEOUT", time.Minute)
+	go func() {
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+			}
+			log.Printf("upgrade: starting a new process")
+			pid, err := server.Upgrade(timeout)
+			if err != nil {
+				log.Printf("upgrade failed, still serving: %v", err)
+				continue
+			}
+			log.Printf("upgrade: process %d took over the listeners", pid)
+			upgraded.Store(true)
+			cancel()
+			return
+		}
+	}()
+	return ctx, &upgraded
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// watchUpgrades returns ctx unchanged: upgrades hand listeners over on SIGHUP,
+// which only Unix systems have.
+func watchUpgrades(ctx context.Context) (context.Context, *atomic.Bool) {
+	return ctx, new(atomic.Bool)
+}
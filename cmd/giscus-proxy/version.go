@@ -0,0 +1,13 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/cdlus/giscus-proxy/internal/version"
+)
+
+func runVersion(args []string) {
+	fs := newFlagSet("version", "Print version information.")
+	_ = fs.Parse(args)
+	fmt.Println(version.Get())
+}
@@ -0,0 +1,22 @@
+// Package giscusproxy exposes the proxy as a Google Cloud Functions (Cloud Run
+// functions) HTTP function, so the repository root can be deployed with
+// `gcloud functions deploy --entry-point GiscusProxy` directly. The Go buildpack
+// wraps the entry point in the functions framework.
+package giscusproxy
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/cdlus/giscus-proxy/internal/config"
+)
+
+// handler is built on the first request rather than at import time.
+var handler = sync.OnceValue(func() http.Handler {
+	return config.PlatformHandler(256)
+})
+
+// GiscusProxy is the HTTP function entry point.
+func GiscusProxy(w http.ResponseWriter, r *http.Request) {
+	handler().ServeHTTP(w, r)
+}
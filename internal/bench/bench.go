@@ -0,0 +1,241 @@
+// Package bench drives load against a giscus-proxy instance and reports
+// throughput and latency, for the loadtest command. Runs against an in-process
+// proxy use the proxytest fake upstream, so they measure the proxy rather than
+// giscus.app.
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Options configures a run.
+type Options struct {
+	// Target is the base URL of the instance under load.
+	Target string
+	// Traffic is replayed in order, wrapping around, by all workers together.
+	Traffic []Request
+	// Concurrency is the number of workers, each with one request in flight.
+	Concurrency int
+	// Duration bounds the run; Requests, when set, stops it earlier.
+	Duration time.Duration
+	Requests int
+	// Client sends the requests; nil uses one sized for Concurrency.
+	Client *http.Client
+}
+
+// Report is the outcome of a run. Latencies cover whole responses, body
+// included.
+type Report struct {
+	Requests   int           `json:"requests"`
+	Errors     int           `json:"errors"`
+	Elapsed    time.Duration `json:"elapsed_ns"`
+	Throughput float64       `json:"requests_per_second"`
+	Latency    Latency       `json:"latency"`
+	Statuses   map[int]int   `json:"statuses"`
+	Routes     []Route       `json:"routes"`
+	// Allocations are set by callers that measure them, as only an in-process
+	// instance shares the load generator's memory statistics.
+	Allocations *Allocations `json:"allocations,omitempty"`
+}
+
+// Latency holds nearest-rank percentiles of the response times.
+type Latency struct {
+	P50 time.Duration `json:"p50_ns"`
+	P90 time.Duration `json:"p90_ns"`
+	P99 time.Duration `json:"p99_ns"`
+	Max time.Duration `json:"max_ns"`
+}
+
+// Route is the share of a run spent on one request name.
+type Route struct {
+	Name     string  `json:"name"`
+	Requests int     `json:"requests"`
+	Errors   int     `json:"errors"`
+	Latency  Latency `json:"latency"`
+}
+
+// Allocations is the heap activity of a run, per request.
+type Allocations struct {
+	BytesPerRequest   uint64 `json:"bytes_per_request"`
+	ObjectsPerRequest uint64 `json:"objects_per_request"`
+	GCs               uint32 `json:"gcs"`
+}
+
+// sample is one completed request.
+type sample struct {
+	route  int
+	status int
+	dur    time.Duration
+	failed bool
+}
+
+// Run replays opts.Traffic against opts.Target until the duration or request
+// count is reached or ctx is done. Responses with status 500 or more and
+// transport failures count as errors.
+func Run(ctx context.Context, opts Options) (*Report, error) {
+	if len(opts.Traffic) == 0 {
+		return nil, errors.New("no traffic to replay")
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.Duration <= 0 && opts.Requests <= 0 {
+		return nil, errors.New("a duration or request count is required")
+	}
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{
+			Transport: &http.Transport{MaxIdleConnsPerHost: opts.Concurrency, DisableCompression: true},
+			Timeout:   30 * time.Second,
+		}
+	}
+	target := strings.TrimRight(opts.Target, "/")
+
+	names := make([]string, 0, len(opts.Traffic))
+	routes := make([]int, len(opts.Traffic))
+	for i, req := range opts.Traffic {
+		n := slices.Index(names, req.name())
+		if n < 0 {
+			n = len(names)
+			names = append(names, req.name())
+		}
+		routes[i] = n
+	}
+
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+	var next atomic.Int64
+	results := make([][]sample, opts.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				i := int(next.Add(1) - 1)
+				if opts.Requests > 0 && i >= opts.Requests {
+					return
+				}
+				req := opts.Traffic[i%len(opts.Traffic)]
+				s := do(ctx, client, target, req)
+				if ctx.Err() != nil && s.failed {
+					// Cut short by the end of the run, not a failure of the target.
+					return
+				}
+				s.route = routes[i%len(opts.Traffic)]
+				results[w] = append(results[w], s)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	var all []sample
+	for _, rs := range results {
+		all = append(all, rs...)
+	}
+	rep := &Report{Requests: len(all), Elapsed: elapsed, Statuses: map[int]int{}}
+	if elapsed > 0 {
+		rep.Throughput = float64(len(all)) / elapsed.Seconds()
+	}
+	byRoute := make([][]time.Duration, len(names))
+	errs := make([]int, len(names))
+	durs := make([]time.Duration, 0, len(all))
+	for _, s := range all {
+		durs = append(durs, s.dur)
+		byRoute[s.route] = append(byRoute[s.route], s.dur)
+		if s.failed {
+			rep.Errors++
+			errs[s.route]++
+		} else {
+			rep.Statuses[s.status]++
+		}
+	}
+	rep.Latency = latency(durs)
+	for i, name := range names {
+		rep.Routes = append(rep.Routes, Route{Name: name, Requests: len(byRoute[i]), Errors: errs[i], Latency: latency(byRoute[i])})
+	}
+	return rep, nil
+}
+
+func do(ctx context.Context, client *http.Client, target string, r Request) sample {
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, r.method(), target+r.Path, nil)
+	if err != nil {
+		return sample{failed: true}
+	}
+	for k, vs := range r.Header {
+		req.Header[k] = vs
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return sample{failed: true, dur: time.Since(start)}
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return sample{status: resp.StatusCode, dur: time.Since(start), failed: err != nil || resp.StatusCode >= 500}
+}
+
+func latency(durs []time.Duration) Latency {
+	if len(durs) == 0 {
+		return Latency{}
+	}
+	slices.Sort(durs)
+	return Latency{P50: percentile(durs, 0.50), P90: percentile(durs, 0.90), P99: percentile(durs, 0.99), Max: durs[len(durs)-1]}
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	i := int(float64(len(sorted))*q+0.5) - 1
+	return sorted[max(0, min(i, len(sorted)-1))]
+}
+
+// WriteText writes the report as aligned text.
+func (r *Report) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "requests   %d in %s, %.1f/s, %d errors\n", r.Requests, r.Elapsed.Round(time.Millisecond), r.Throughput, r.Errors)
+	fmt.Fprintf(w, "latency    %s\n", r.Latency)
+	codes := make([]int, 0, len(r.Statuses))
+	for code := range r.Statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	var parts []string
+	for _, code := range codes {
+		parts = append(parts, fmt.Sprintf("%d×%d", code, r.Statuses[code]))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "-")
+	}
+	fmt.Fprintf(w, "statuses   %s\n", strings.Join(parts, " "))
+	if a := r.Allocations; a != nil {
+		fmt.Fprintf(w, "allocs     %d B/req, %d objects/req, %d GCs\n", a.BytesPerRequest, a.ObjectsPerRequest, a.GCs)
+	}
+	for _, rt := range r.Routes {
+		fmt.Fprintf(w, "  %-40s %7d req %5d err  %s\n", rt.Name, rt.Requests, rt.Errors, rt.Latency)
+	}
+}
+
+func (l Latency) String() string {
+	return fmt.Sprintf("p50=%s p90=%s p99=%s max=%s", round(l.P50), round(l.P90), round(l.P99), round(l.Max))
+}
+
+func round(d time.Duration) time.Duration {
+	if d > time.Millisecond {
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
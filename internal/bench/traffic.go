@@ -0,0 +1,86 @@
+package bench
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Request is one request of a traffic pattern.
+type Request struct {
+	// Name groups requests in the report; it defaults to the path without query.
+	Name   string      `json:"name,omitempty"`
+	Method string      `json:"method,omitempty"`
+	Path   string      `json:"path"`
+	Header http.Header `json:"headers,omitempty"`
+}
+
+// DefaultTraffic is what one page view with an embedded widget costs the proxy:
+// the client script, the widget document, its assets and the discussion.
+var DefaultTraffic = []Request{
+	{Path: "/client.js"},
+	{Path: "/widget?origin=https%3A%2F%2Fblog.example%2Fpost&repo=owner%2Frepo&term=post&theme=light"},
+	{Path: "/_next/static/css/app.css"},
+	{Path: "/_next/static/chunks/main.js"},
+	{Path: "/_next/static/chunks/pages/widget.js"},
+	{Path: "/api/discussions?repo=owner%2Frepo&term=post&number=0&category=&strict=false&first=15"},
+}
+
+// logLineRE picks the method and path out of a proxy request log line.
+var logLineRE = regexp.MustCompile(`\bmethod=(\S+)\s.*\bpath=(/\S*)`)
+
+// ParseTraffic reads a recorded traffic pattern, one request per line: either a
+// JSON Request or a request log line of the proxy, from which method and path
+// are taken. Blank lines and lines starting with # are skipped, as are log lines
+// of other kinds.
+func ParseTraffic(r io.Reader) ([]Request, error) {
+	var out []Request
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "{"):
+			var req Request
+			if err := json.Unmarshal([]byte(line), &req); err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			if !strings.HasPrefix(req.Path, "/") {
+				return nil, fmt.Errorf("line %d: path must start with /", n)
+			}
+			out = append(out, req)
+		default:
+			if m := logLineRE.FindStringSubmatch(line); m != nil {
+				out = append(out, Request{Method: m[1], Path: m[2]})
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no requests found")
+	}
+	return out, nil
+}
+
+func (r Request) name() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	path, _, _ := strings.Cut(r.Path, "?")
+	return path
+}
+
+func (r Request) method() string {
+	if r.Method == "" {
+		return http.MethodGet
+	}
+	return r.Method
+}
@@ -0,0 +1,81 @@
+package bench
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/pkg/giscusproxy/proxytest"
+)
+
+// widgetComments is how many comments the fake widget document renders, which
+// puts it near the size of a real one with a busy discussion.
+const widgetComments = 60
+
+// NewUpstream starts a proxytest upstream loaded with documents the size of
+// real ones: a widget with the URLs and footer the proxy rewrites, cacheable
+// assets for the paths in DefaultTraffic and a discussion at /api/discussions,
+// each served after latency. Its request log is off. The caller closes it.
+func NewUpstream(latency time.Duration) *proxytest.Upstream {
+	up := proxytest.StartUpstream()
+	up.SetRecording(false)
+	up.SetLatency(latency)
+	up.SetWidget(fakeWidget())
+	immutable := http.Header{"Cache-Control": {"public, max-age=31536000, immutable"}}
+	up.SetResponse("/client.js", proxytest.Asset{
+		ContentType: "text/javascript; charset=utf-8",
+		Header:      http.Header{"Cache-Control": {"public, max-age=3600"}},
+		Body:        proxytest.DefaultClient,
+	})
+	for _, path := range []string{"/_next/static/css/app.css", "/_next/static/chunks/main.js", "/_next/static/chunks/pages/widget.js"} {
+		ct := "text/javascript; charset=utf-8"
+		if strings.HasSuffix(path, ".css") {
+			ct = "text/css; charset=utf-8"
+		}
+		up.SetResponse(path, proxytest.Asset{
+			ContentType: ct,
+			Header:      immutable,
+			Body:        fmt.Sprintf("/* %s */\n%s", path, strings.Repeat("var giscus=\"https://giscus.app\";\n", 200)),
+		})
+	}
+	up.SetResponse("/api/discussions", proxytest.Asset{
+		ContentType: "application/json",
+		Header:      http.Header{"Cache-Control": {"no-store"}},
+		Body:        fakeDiscussion(),
+	})
+	return up
+}
+
+func fakeWidget() string {
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html><html lang="en"><head><meta charset="utf-8">` +
+		`<link rel="stylesheet" href="/_next/static/css/app.css">` +
+		`<script src="/_next/static/chunks/main.js" defer></script>` +
+		`<script src="/_next/static/chunks/pages/widget.js" defer></script>` +
+		`</head><body><main class="gsc-main">`)
+	for i := 0; i < widgetComments; i++ {
+		fmt.Fprintf(&b, `<div class="gsc-comment"><a href="https://github.com/user%d">user%d</a>`+
+			`<img src="https://avatars.githubusercontent.com/u/%d?v=4" width="30" height="30">`+
+			`<div class="markdown">Comment %d about <a href="https://giscus.app">giscus</a>, with some text to make it realistic.</div></div>`, i, i, i, i)
+	}
+	b.WriteString(`<div class="gsc-footer">– powered by <a>giscus</a></div></main>`)
+	b.WriteString(`<script id="__NEXT_DATA__" type="application/json">{"props":{"pageProps":{}},"page":"/widget","buildId":"bench"}</script>`)
+	b.WriteString(`</body></html>`)
+	return b.String()
+}
+
+func fakeDiscussion() string {
+	var b strings.Builder
+	b.WriteString(`{"discussion":{"id":"D_bench","url":"https://github.com/owner/repo/discussions/1","totalCommentCount":`)
+	fmt.Fprintf(&b, `%d,"comments":[`, widgetComments)
+	for i := 0; i < widgetComments; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `{"id":"C_%d","author":{"login":"user%d","avatarUrl":"https://avatars.githubusercontent.com/u/%d?v=4","url":"https://github.com/user%d"},`+
+			`"createdAt":"2024-01-01T00:00:00Z","bodyHTML":"<p>Comment %d</p>","replies":[]}`, i, i, i, i, i)
+	}
+	b.WriteString(`]}}`)
+	return b.String()
+}
@@ -1,9 +1,14 @@
 package cache
 
 import (
+	"context"
+	"hash/maphash"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/clock"
 )
 
 // Entry represents a cached HTTP response.
@@ -14,14 +19,75 @@ type Entry struct {
 	Expires time.Time
 }
 
-// Cache defines the behaviour required for storing HTTP responses.
+// Cache defines the behaviour required for storing HTTP responses. The context
+// is the visitor's request, so network-backed caches can honor its deadline and
+// cancellation; a failed or abandoned Get is a miss.
 type Cache interface {
+	Get(ctx context.Context, key string) (Entry, bool)
+	Set(ctx context.Context, key string, entry Entry)
+}
+
+// Simple is the context-free form of Cache that earlier versions accepted.
+type Simple interface {
 	Get(key string) (Entry, bool)
 	Set(key string, entry Entry)
 }
 
-// MemoryCache is a simple in-memory implementation of Cache.
+// Adapt turns a Simple cache into a Cache that ignores the context.
+func Adapt(c Simple) Cache {
+	return simpleCache{c}
+}
+
+type simpleCache struct {
+	Simple
+}
+
+func (c simpleCache) Get(_ context.Context, key string) (Entry, bool) {
+	return c.Simple.Get(key)
+}
+
+func (c simpleCache) Set(_ context.Context, key string, entry Entry) {
+	c.Simple.Set(key, entry)
+}
+
+// Unwrap returns the adapted cache, so optional methods such as Purge stay
+// reachable.
+func (c simpleCache) Unwrap() Simple {
+	return c.Simple
+}
+
+// As reports whether c, or the cache it adapts, implements T.
+func As[T any](c Cache) (T, bool) {
+	if t, ok := c.(T); ok {
+		return t, true
+	}
+	if u, ok := c.(interface{ Unwrap() Simple }); ok {
+		t, ok := u.Unwrap().(T)
+		return t, ok
+	}
+	var zero T
+	return zero, false
+}
+
+// maxShards is how many independently locked buckets a MemoryCache splits its
+// entries into, so concurrent requests for different keys rarely contend.
+const maxShards = 16
+
+// minShardEntries keeps small caches from being split into buckets too small
+// to hold their share of hot entries.
+const minShardEntries = 16
+
+// MemoryCache is a simple in-memory implementation of Cache. Entries are spread
+// over shards by key hash, each with its own lock and share of the capacity.
 type MemoryCache struct {
+	shards     []memoryShard
+	seed       maphash.Seed
+	maxEntries int
+	evictions  atomic.Uint64
+	clock      clock.Clock
+}
+
+type memoryShard struct {
 	mu         sync.RWMutex
 	data       map[string]Entry
 	maxEntries int
@@ -29,36 +95,89 @@ type MemoryCache struct {
 
 // NewMemoryCache constructs a MemoryCache limited to the provided number of entries.
 func NewMemoryCache(maxEntries int) *MemoryCache {
-	return &MemoryCache{data: make(map[string]Entry), maxEntries: maxEntries}
+	return newMemoryCache(maxEntries, min(maxShards, max(1, maxEntries/minShardEntries)))
 }
 
-// Get retrieves a cache entry if present and not expired.
-func (c *MemoryCache) Get(key string) (Entry, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+// newMemoryCache constructs a MemoryCache with n shards.
+func newMemoryCache(maxEntries, n int) *MemoryCache {
+	c := &MemoryCache{shards: make([]memoryShard, n), seed: maphash.MakeSeed(), maxEntries: maxEntries, clock: clock.Real{}}
+	for i := range c.shards {
+		c.shards[i].data = make(map[string]Entry)
+		c.shards[i].maxEntries = maxEntries / n
+		if i < maxEntries%n {
+			c.shards[i].maxEntries++
+		}
+	}
+	return c
+}
 
-	entry, ok := c.data[key]
-	if !ok {
-		return Entry{}, false
+func (c *MemoryCache) shard(key string) *memoryShard {
+	if len(c.shards) == 1 {
+		return &c.shards[0]
 	}
-	if time.Now().After(entry.Expires) {
+	return &c.shards[maphash.String(c.seed, key)%uint64(len(c.shards))]
+}
+
+// SetClock makes the cache judge expiry by c instead of the wall clock. Call it
+// before the cache is used.
+func (c *MemoryCache) SetClock(clk clock.Clock) {
+	c.clock = clock.Or(clk)
+}
+
+// Get retrieves a cache entry if present and not expired.
+func (c *MemoryCache) Get(_ context.Context, key string) (Entry, bool) {
+	s := c.shard(key)
+	s.mu.RLock()
+	entry, ok := s.data[key]
+	s.mu.RUnlock()
+	if !ok || c.clock.Now().After(entry.Expires) {
 		return Entry{}, false
 	}
 	return entry, true
 }
 
-// Set stores a cache entry, evicting an arbitrary entry when capacity is reached.
-func (c *MemoryCache) Set(key string, entry Entry) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// Set stores a cache entry, evicting an arbitrary entry of the key's shard when
+// that shard is full.
+func (c *MemoryCache) Set(_ context.Context, key string, entry Entry) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if len(c.data) >= c.maxEntries {
-		for k := range c.data {
-			delete(c.data, k)
+	if _, ok := s.data[key]; !ok && len(s.data) >= s.maxEntries {
+		for k := range s.data {
+			delete(s.data, k)
+			c.evictions.Add(1)
 			break
 		}
 	}
-	c.data[key] = entry
+	s.data[key] = entry
+}
+
+// Purge deletes the entries whose key satisfies match and reports how many were removed.
+func (c *MemoryCache) Purge(match func(key string) bool) int {
+	n := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		for k := range s.data {
+			if match(k) {
+				delete(s.data, k)
+				n++
+			}
+		}
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Evictions reports how many entries were dropped to make room for new ones.
+func (c *MemoryCache) Evictions() uint64 {
+	return c.evictions.Load()
+}
+
+// Capacity reports how many entries the cache holds at most.
+func (c *MemoryCache) Capacity() int {
+	return c.maxEntries
 }
 
 var _ Cache = (*MemoryCache)(nil)
@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// benchmarkKeys is how many distinct keys the benchmarks spread requests over,
+// about what a busy instance keeps hot.
+const benchmarkKeys = 1024
+
+// benchmarkCache runs run in parallel against a single-shard cache and a fully
+// sharded one, both holding benchmarkKeys entries.
+func benchmarkCache(b *testing.B, run func(c *MemoryCache, ctx context.Context, keys []string, entry Entry, pb *testing.PB)) {
+	for _, n := range []int{1, maxShards} {
+		b.Run(fmt.Sprintf("shards=%d", n), func(b *testing.B) {
+			c := newMemoryCache(benchmarkKeys*2, n)
+			ctx := context.Background()
+			entry := Entry{Status: 200, Body: []byte("body"), Expires: time.Now().Add(time.Hour)}
+			keys := make([]string, benchmarkKeys)
+			for i := range keys {
+				keys[i] = "widget:" + strconv.Itoa(i)
+				c.Set(ctx, keys[i], entry)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				run(c, ctx, keys, entry, pb)
+			})
+		})
+	}
+}
+
+func BenchmarkMemoryCacheGet(b *testing.B) {
+	benchmarkCache(b, func(c *MemoryCache, ctx context.Context, keys []string, _ Entry, pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			if _, ok := c.Get(ctx, keys[i%len(keys)]); !ok {
+				b.Error("miss")
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkMemoryCacheSet(b *testing.B) {
+	benchmarkCache(b, func(c *MemoryCache, ctx context.Context, keys []string, entry Entry, pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			c.Set(ctx, keys[i%len(keys)], entry)
+		}
+	})
+}
+
+// BenchmarkMemoryCacheMixed is mostly hits with the odd refresh, as for cached
+// widget documents.
+func BenchmarkMemoryCacheMixed(b *testing.B) {
+	benchmarkCache(b, func(c *MemoryCache, ctx context.Context, keys []string, entry Entry, pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			key := keys[i%len(keys)]
+			if i%10 == 0 {
+				c.Set(ctx, key, entry)
+			} else {
+				c.Get(ctx, key)
+			}
+		}
+	})
+}
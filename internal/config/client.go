@@ -0,0 +1,56 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// HTTPClient builds the client used for upstream requests. For a self-hosted giscus
+// behind mutual TLS, UPSTREAM_CLIENT_CERT and UPSTREAM_CLIENT_KEY supply the client
+// certificate, and UPSTREAM_CA_FILE adds a private CA to trust.
+func HTTPClient() (*http.Client, error) {
+	client := &http.Client{Timeout: 25 * time.Second}
+
+	certFile := GetEnv("UPSTREAM_CLIENT_CERT", "")
+	keyFile := GetEnv("UPSTREAM_CLIENT_KEY", "")
+	caFile := GetEnv("UPSTREAM_CA_FILE", "")
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return client, nil
+	}
+
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("UPSTREAM_CLIENT_CERT and UPSTREAM_CLIENT_KEY must be set together")
+		}
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load upstream client certificate: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{pair}
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("read UPSTREAM_CA_FILE: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("UPSTREAM_CA_FILE %s contains no certificates", caFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = tlsCfg
+	client.Transport = tr
+	return client, nil
+}
@@ -1,10 +1,54 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+// parseErrors records malformed values seen by the Get* helpers, by variable,
+// so Proxy and ParseErrors can reject them after the defaults were used.
+var parseErrors struct {
+	mu   sync.Mutex
+	errs map[string]error
+}
+
+// noteParse records or clears the parse error of key.
+func noteParse(key, v, want string, err error) {
+	parseErrors.mu.Lock()
+	defer parseErrors.mu.Unlock()
+	if err == nil {
+		delete(parseErrors.errs, key)
+		return
+	}
+	if parseErrors.errs == nil {
+		parseErrors.errs = make(map[string]error)
+	}
+	parseErrors.errs[key] = fmt.Errorf("%s %q: must be %s", key, v, want)
+}
+
+// ParseErrors reports the malformed values the Get* helpers have read so far,
+// for which they fell back to the default, one per variable.
+func ParseErrors() error {
+	parseErrors.mu.Lock()
+	defer parseErrors.mu.Unlock()
+	keys := make([]string, 0, len(parseErrors.errs))
+	for k := range parseErrors.errs {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	errs := make([]error, len(keys))
+	for i, k := range keys {
+		errs[i] = parseErrors.errs[k]
+	}
+	return errors.Join(errs...)
+}
+
 // GetEnv returns the trimmed value of an environment variable or a default when unset.
 func GetEnv(key, def string) string {
 	v := strings.TrimSpace(os.Getenv(key))
@@ -29,41 +73,92 @@ func EnsureURL(v, defaultScheme string) string {
 	return defaultScheme + "://" + v
 }
 
-// DerivePublicURL attempts to build a public URL for the service based on environment hints.
-func DerivePublicURL(bindAddr, host, port string) string {
-	if u := EnsureURL(os.Getenv("PUBLIC_URL"), ""); u != "" {
-		return u
+// GetBool parses a boolean environment variable, falling back to def when unset or
+// malformed. Malformed values are reported by ParseErrors.
+func GetBool(key string, def bool) bool {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
 	}
-	if u := EnsureURL(os.Getenv("RAILWAY_PUBLIC_DOMAIN"), "https"); u != "" {
-		return u
+	b, err := strconv.ParseBool(v)
+	noteParse(key, v, "true or false", err)
+	if err != nil {
+		return def
 	}
-	if u := EnsureURL(os.Getenv("RAILWAY_URL"), ""); u != "" {
-		return u
+	return b
+}
+
+// GetInt parses an integer environment variable, falling back to def when unset or
+// malformed. Malformed values are reported by ParseErrors.
+func GetInt(key string, def int) int {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
 	}
+	n, err := strconv.Atoi(v)
+	noteParse(key, v, "an integer", err)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+// GetFloat parses a float environment variable, falling back to def when unset or
+// malformed. Malformed values are reported by ParseErrors.
+func GetFloat(key string, def float64) float64 {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	noteParse(key, v, "a number", err)
+	if err != nil {
+		return def
+	}
+	return f
+}
 
-	p := strings.TrimSpace(port)
-	h := strings.TrimSpace(host)
-	if p == "" {
-		b := bindAddr
-		if strings.HasPrefix(b, ":") {
-			p = strings.TrimPrefix(b, ":")
-		} else if i := strings.LastIndex(b, ":"); i != -1 {
-			p = b[i+1:]
+// GetList splits a comma- or newline-separated environment variable into trimmed,
+// non-empty items.
+func GetList(key string) []string {
+	var out []string
+	for _, v := range strings.FieldsFunc(os.Getenv(key), func(r rune) bool { return r == ',' || r == '\n' }) {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
 		}
 	}
-	if h == "" {
-		b := bindAddr
-		if strings.HasPrefix(b, ":") || b == "" {
-			h = "localhost"
-		} else if i := strings.LastIndex(b, ":"); i != -1 {
-			h = b[:i]
+	return out
+}
+
+// SplitLines breaks a multi-line value into trimmed lines, skipping blanks and # comments.
+func SplitLines(v string) []string {
+	var out []string
+	for _, line := range strings.Split(v, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
 		}
+		out = append(out, line)
 	}
-	if h == "0.0.0.0" || h == "::" || h == "[::]" || h == "" {
-		h = "localhost"
+	return out
+}
+
+// GetDuration parses a duration environment variable such as "30s" or "2m"; a bare
+// number is read as seconds. It falls back to def when unset or malformed;
+// malformed values are reported by ParseErrors.
+func GetDuration(key string, def time.Duration) time.Duration {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
 	}
-	if p == "" {
-		p = "8080"
+	if n, err := strconv.Atoi(v); err == nil {
+		noteParse(key, v, "", nil)
+		return time.Duration(n) * time.Second
+	}
+	d, err := time.ParseDuration(v)
+	noteParse(key, v, "a duration such as 30s or 2m", err)
+	if err != nil {
+		return def
 	}
-	return "http://" + h + ":" + p
+	return d
 }
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"go.yaml.in/yaml/v3"
+)
+
+// Load reads a YAML (.yaml, .yml, .json) or TOML (.toml) configuration file and
+// exports its settings as environment variables, so everything that reads the
+// environment picks them up. Variables already set in the environment win over
+// the file. An empty path is a no-op.
+//
+// Nested keys are joined with "_" and upper-cased to form the variable name:
+//
+//	upstream:
+//	  origin: https://giscus.app    # UPSTREAM_ORIGIN
+//	log:
+//	  level: debug                  # LOG_LEVEL
+//	replacements:                   # REPLACEMENTS, one rule per line
+//	  - "https://giscus.app=>{{proxy_origin}}"
+//
+// Lists become one entry per line, which both line-based rules and
+// comma-separated lists accept.
+func Load(path string) error {
+	if path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	var doc map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+		err = yaml.Unmarshal(b, &doc)
+	case ".toml":
+		err = toml.Unmarshal(b, &doc)
+	default:
+		return fmt.Errorf("config file %s: unsupported format %q (use .yaml, .yml, .json or .toml)", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	vars := make(map[string]string)
+	if err := flatten(vars, "", doc); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	keys := make([]string, 0, len(vars))
+	for k := range vars {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if _, set := os.LookupEnv(k); set {
+			continue
+		}
+		if err := os.Setenv(k, vars[k]); err != nil {
+			return fmt.Errorf("config file %s: set %s: %w", path, k, err)
+		}
+	}
+	return nil
+}
+
+// decodeFile decodes the YAML (.yaml, .yml, .json) or TOML (.toml) file named
+// by the environment variable key into v. An unset variable leaves v alone.
+func decodeFile(key string, v any) error {
+	path := GetEnv(key, "")
+	if path == "" {
+		return nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", key, err)
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml", ".json":
+		err = yaml.Unmarshal(b, v)
+	case ".toml":
+		err = toml.Unmarshal(b, v)
+	default:
+		return fmt.Errorf("%s %s: unsupported format %q (use .yaml, .yml, .json or .toml)", key, path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("parse %s %s: %w", key, path, err)
+	}
+	return nil
+}
+
+func flatten(out map[string]string, prefix string, v any) error {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			name := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(k))
+			if prefix != "" {
+				name = prefix + "_" + name
+			}
+			if err := flatten(out, name, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if prefix == "" {
+		return fmt.Errorf("top level must be a mapping")
+	}
+	s, err := scalar(prefix, v)
+	if err != nil {
+		return err
+	}
+	out[prefix] = s
+	return nil
+}
+
+func scalar(key string, v any) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := scalar(key, item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, "\n"), nil
+	default:
+		return "", fmt.Errorf("%s: unsupported value of type %T", key, v)
+	}
+}
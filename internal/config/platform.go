@@ -0,0 +1,60 @@
+package config
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+	"github.com/cdlus/giscus-proxy/internal/proxy"
+)
+
+// Platform builds the proxy configuration the serverless entry points run
+// with: CONFIG_FILE and the environment, the upstream HTTP client, tracing and
+// a memory cache of CACHE_SIZE entries (defaultCacheSize when unset). Any
+// error, including a problem Validate finds, is returned rather than leaving a
+// setting out, since a dropped setting can be an access restriction.
+func Platform(defaultCacheSize int) (proxy.Config, error) {
+	if err := Load(os.Getenv("CONFIG_FILE")); err != nil {
+		return proxy.Config{}, err
+	}
+	cfg, err := Proxy()
+	if err != nil {
+		return proxy.Config{}, err
+	}
+	cfg.Client, err = HTTPClient()
+	if err != nil {
+		return proxy.Config{}, err
+	}
+	cfg.Cache = cache.NewMemoryCache(GetInt("CACHE_SIZE", defaultCacheSize))
+	if err := ParseErrors(); err != nil {
+		return proxy.Config{}, err
+	}
+	tp, _, err := Tracing(context.Background())
+	if err != nil {
+		return proxy.Config{}, err
+	}
+	if tp != nil {
+		cfg.TracerProvider = tp
+	}
+	if err := cfg.Validate(); err != nil {
+		return proxy.Config{}, err
+	}
+	return cfg, nil
+}
+
+// PlatformHandler returns the handler of a proxy built by Platform for entry
+// points that can't exit on a bad configuration. When Platform fails, the error
+// is logged and every request is answered with 500 instead of being served
+// with settings missing.
+func PlatformHandler(defaultCacheSize int) http.Handler {
+	cfg, err := Platform(defaultCacheSize)
+	if err != nil {
+		log.Printf("config: %v", err)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "proxy is misconfigured", http.StatusInternalServerError)
+		})
+	}
+	return proxy.New(cfg).Handler()
+}
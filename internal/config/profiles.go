@@ -0,0 +1,44 @@
+package config
+
+import "github.com/cdlus/giscus-proxy/internal/proxy"
+
+// profileFile is the layout of PROFILES_FILE:
+//
+//	profiles:
+//	  - name: blog
+//	    theme: noborder_light
+//	    lang: en
+//	    replacements: ["Comments=>Responses"]
+//	  - name: docs
+//	    theme: preferred_color_scheme
+//	    lang: fr
+type profileFile struct {
+	Profiles []struct {
+		Name         string   `yaml:"name" toml:"name"`
+		Replacements []string `yaml:"replacements" toml:"replacements"`
+		Theme        string   `yaml:"theme" toml:"theme"`
+		Lang         string   `yaml:"lang" toml:"lang"`
+	} `yaml:"profiles" toml:"profiles"`
+}
+
+// Profiles reads the widget profiles from the YAML (.yaml, .yml, .json) or TOML
+// (.toml) file named by PROFILES_FILE, or returns nil when it is unset.
+func Profiles() ([]proxy.Profile, error) {
+	var doc profileFile
+	if err := decodeFile("PROFILES_FILE", &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Profiles) == 0 {
+		return nil, nil
+	}
+	profiles := make([]proxy.Profile, 0, len(doc.Profiles))
+	for _, pr := range doc.Profiles {
+		profiles = append(profiles, proxy.Profile{
+			Name:         pr.Name,
+			Replacements: pr.Replacements,
+			Theme:        pr.Theme,
+			Lang:         pr.Lang,
+		})
+	}
+	return profiles, nil
+}
@@ -0,0 +1,255 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/cdlus/giscus-proxy/internal/proxy"
+	"github.com/cdlus/giscus-proxy/internal/sentry"
+	"github.com/cdlus/giscus-proxy/internal/statsd"
+)
+
+// Proxy builds the parts of proxy.Config that are driven by environment variables.
+// Callers are expected to fill in runtime dependencies such as the HTTP client and cache.
+// Malformed boolean, number and duration values are an error, as is any
+// ParseErrors reported before.
+func Proxy() (proxy.Config, error) {
+	reps, err := Rules("REPLACEMENTS")
+	if err != nil {
+		return proxy.Config{}, err
+	}
+	domRules, err := Rules("DOM_RULES")
+	if err != nil {
+		return proxy.Config{}, err
+	}
+	nextData, err := Rules("NEXT_DATA_OVERRIDES")
+	if err != nil {
+		return proxy.Config{}, err
+	}
+	overrides, err := Rules("STRING_OVERRIDES")
+	if err != nil {
+		return proxy.Config{}, err
+	}
+	repAllowlist, err := Rules("QUERY_REPLACEMENT_ALLOWLIST")
+	if err != nil {
+		return proxy.Config{}, err
+	}
+	snippet, err := Snippet()
+	if err != nil {
+		return proxy.Config{}, err
+	}
+	auditLog, err := AuditLogger()
+	if err != nil {
+		return proxy.Config{}, err
+	}
+	reporter, err := ErrorReporter()
+	if err != nil {
+		return proxy.Config{}, err
+	}
+	statsdClient, err := StatsD()
+	if err != nil {
+		return proxy.Config{}, err
+	}
+	tenants, err := Tenants()
+	if err != nil {
+		return proxy.Config{}, err
+	}
+	profiles, err := Profiles()
+	if err != nil {
+		return proxy.Config{}, err
+	}
+	cfg := proxy.Config{
+		UpstreamOrigin:            strings.TrimRight(GetEnv("WIDGET_ORIGIN", GetEnv("UPSTREAM_ORIGIN", "")), "/"),
+		APIOrigin:                 strings.TrimRight(GetEnv("API_ORIGIN", ""), "/"),
+		PublicOrigin:              EnsureURL(os.Getenv("PUBLIC_URL"), ""),
+		BasePath:                  GetEnv("BASE_PATH", ""),
+		Replacements:              reps,
+		StringOverrides:           Pairs(overrides),
+		WidgetSigningKey:          GetEnv("WIDGET_SIGNING_KEY", ""),
+		DisableQueryReplacements:  GetBool("DISABLE_QUERY_REPLACEMENTS", false),
+		QueryReplacementAllowlist: repAllowlist,
+		DOMRules:                  domRules,
+		NextDataOverrides:         nextData,
+		BaseHref:                  GetEnv("BASE_HREF", ""),
+		RobotsMeta:                GetEnv("ROBOTS_META", ""),
+		ReferrerPolicy:            GetEnv("REFERRER_POLICY", ""),
+		SRI:                       GetEnv("SRI_MODE", ""),
+		StripTelemetry:            GetBool("STRIP_TELEMETRY", false),
+		DisableFooterRemoval:      GetBool("DISABLE_FOOTER_REMOVAL", false),
+		DisableBasePathRewrite:    GetBool("DISABLE_BASE_PATH_REWRITE", false),
+		DisableAuthProxy:          GetBool("DISABLE_AUTH_PROXY", false),
+		RewriteAuthCallback:       GetBool("REWRITE_AUTH_CALLBACK", false),
+		ProxyAvatars:              GetBool("PROXY_AVATARS", false),
+		AvatarCacheTTL:            GetDuration("AVATAR_CACHE_TTL", 0),
+		MirrorStaticAssets:        GetBool("MIRROR_STATIC_ASSETS", false),
+		Tenants:                   tenants,
+		Profiles:                  profiles,
+		Snapshot:                  GetBool("SNAPSHOT_ENABLED", false),
+		SnapshotCacheTTL:          GetDuration("SNAPSHOT_CACHE_TTL", 0),
+		FeedRepo:                  GetEnv("FEED_REPO", ""),
+		FeedCategory:              GetEnv("FEED_CATEGORY", ""),
+		FeedCacheTTL:              GetDuration("FEED_CACHE_TTL", 0),
+		GitHubWebhookSecret:       GetEnv("GITHUB_WEBHOOK_SECRET", ""),
+		WebhookRelayURL:           GetEnv("WEBHOOK_RELAY_URL", ""),
+		WebhookRelayFormat:        GetEnv("WEBHOOK_RELAY_FORMAT", ""),
+		PinClientSHA256:           GetEnv("PIN_CLIENT_SHA256", ""),
+		PinWidgetBuildID:          GetEnv("PIN_WIDGET_BUILD_ID", ""),
+		RemoteThemes:              GetBool("REMOTE_THEMES", false),
+		RemoteThemeHosts:          GetList("REMOTE_THEME_HOSTS"),
+		RemoteThemeCacheTTL:       GetDuration("REMOTE_THEME_CACHE_TTL", 0),
+		ReactionsCacheTTL:         GetDuration("REACTIONS_CACHE_TTL", 0),
+		GitHubToken:               GetEnv("GITHUB_DIRECT_TOKEN", ""),
+		GitHubGraphQLURL:          GetEnv("GITHUB_GRAPHQL_URL", ""),
+		GitHubCacheTTL:            GetDuration("GITHUB_DIRECT_TTL", 0),
+		GitHubRepos:               GetList("GITHUB_DIRECT_REPOS"),
+		HideVersion:               GetBool("HIDE_VERSION", false),
+		Preview:                   GetBool("PREVIEW_ENABLED", false),
+		TransformContentTypes:     GetList("TRANSFORM_CONTENT_TYPES"),
+		Minify:                    GetList("MINIFY"),
+		AllowedOrigins:            GetList("ALLOWED_ORIGINS"),
+		AllowedSites:              GetList("ALLOWED_SITES"),
+		BlockBots:                 GetBool("BLOCK_BOTS", false),
+		BlockEmptyUserAgent:       GetBool("BLOCK_EMPTY_USER_AGENT", false),
+		BlockUserAgents:           GetList("BLOCK_USER_AGENTS"),
+		AllowUserAgents:           GetList("ALLOW_USER_AGENTS"),
+		AllowEmptyReferer:         GetBool("ALLOW_EMPTY_REFERER", false),
+		TrustedProxies:            GetList("TRUSTED_PROXIES"),
+		IPAllow:                   GetList("IP_ALLOW"),
+		IPDeny:                    GetList("IP_DENY"),
+		RateLimitRPS:              GetFloat("RATE_LIMIT_RPS", 0),
+		RateLimitBurst:            GetInt("RATE_LIMIT_BURST", 0),
+		UpstreamRPS:               GetFloat("UPSTREAM_RPS", 0),
+		UpstreamBurst:             GetInt("UPSTREAM_BURST", 0),
+		MaxInFlight:               GetInt("MAX_IN_FLIGHT", 0),
+		ReadyTimeout:              GetDuration("READY_TIMEOUT", 0),
+		Metrics:                   GetBool("METRICS_ENABLED", false),
+		MetricsPath:               GetEnv("METRICS_PATH", ""),
+		SummaryInterval:           GetDuration("SUMMARY_INTERVAL", 0),
+		StatsD:                    statsdClient,
+		SlowThreshold:             GetDuration("SLOW_REQUEST_THRESHOLD", 0),
+		SecurityHeaders:           GetBool("SECURITY_HEADERS", false),
+		ContentSecurityPolicy:     GetEnv("CONTENT_SECURITY_POLICY", ""),
+		AdminToken:                GetEnv("ADMIN_TOKEN", ""),
+		AdminUser:                 GetEnv("ADMIN_USER", ""),
+		AdminPassword:             GetEnv("ADMIN_PASSWORD", ""),
+		AdminPrefix:               GetEnv("ADMIN_PREFIX", ""),
+		Pprof:                     GetBool("PPROF_ENABLED", false),
+		Capture:                   GetBool("CAPTURE_ENABLED", false),
+		Expvar:                    GetBool("EXPVAR_ENABLED", false),
+		Stats:                     GetBool("STATS_ENABLED", false),
+		StatsWindow:               GetDuration("STATS_WINDOW", 0),
+		LogLevel:                  GetEnv("LOG_LEVEL", ""),
+		AuditLogger:               auditLog,
+		ErrorReporter:             reporter,
+		SiteUser:                  GetEnv("SITE_USER", ""),
+		SitePassword:              GetEnv("SITE_PASSWORD", ""),
+		SiteToken:                 GetEnv("SITE_TOKEN", ""),
+		RedactNames:               GetList("LOG_REDACT"),
+		PassthroughAllow:          GetList("PASSTHROUGH_ALLOW"),
+		PassthroughDeny:           GetList("PASSTHROUGH_DENY"),
+		ForwardHeaders:            GetList("FORWARD_HEADERS"),
+		StripHeaders:              GetList("STRIP_HEADERS"),
+		LightTheme:                GetEnv("LIGHT_THEME", ""),
+		DarkTheme:                 GetEnv("DARK_THEME", ""),
+	}
+	if snippet.HTML != "" {
+		cfg.Snippets = append(cfg.Snippets, snippet)
+	}
+	if err := ParseErrors(); err != nil {
+		return proxy.Config{}, err
+	}
+	return cfg, nil
+}
+
+// Rules collects line-based rules from the key variable (one rule per line)
+// and the file referenced by key+"_FILE", in that order.
+func Rules(key string) ([]string, error) {
+	rules := SplitLines(os.Getenv(key))
+	if path := GetEnv(key+"_FILE", ""); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read %s_FILE: %w", key, err)
+		}
+		rules = append(rules, SplitLines(string(b))...)
+	}
+	return rules, nil
+}
+
+// Snippet reads the HTML snippet from INJECT_HTML or the file named by INJECT_HTML_FILE,
+// placed according to INJECT_POSITION.
+func Snippet() (proxy.Snippet, error) {
+	s := proxy.Snippet{
+		HTML:     os.Getenv("INJECT_HTML"),
+		Position: GetEnv("INJECT_POSITION", proxy.PositionBodyEnd),
+	}
+	if path := GetEnv("INJECT_HTML_FILE", ""); path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return proxy.Snippet{}, fmt.Errorf("read INJECT_HTML_FILE: %w", err)
+		}
+		s.HTML += string(b)
+	}
+	return s, nil
+}
+
+// Pairs parses "KEY=>VALUE" lines into a map; lines without a separator are skipped.
+func Pairs(lines []string) map[string]string {
+	if len(lines) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(lines))
+	for _, line := range lines {
+		k, v, ok := strings.Cut(line, "=>")
+		if !ok {
+			continue
+		}
+		out[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return out
+}
+
+// AuditLogger opens the admin audit log named by AUDIT_LOG: "stdout", "stderr" or a
+// file path opened for appending. Unset returns nil, leaving entries in the main log.
+func AuditLogger() (*log.Logger, error) {
+	switch dest := GetEnv("AUDIT_LOG", ""); dest {
+	case "":
+		return nil, nil
+	case "stdout":
+		return log.New(os.Stdout, "", 0), nil
+	case "stderr":
+		return log.New(os.Stderr, "", 0), nil
+	default:
+		f, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open AUDIT_LOG: %w", err)
+		}
+		return log.New(f, "", 0), nil
+	}
+}
+
+// ErrorReporter returns a Sentry reporter when SENTRY_DSN is set, tagged with
+// SENTRY_ENVIRONMENT and SENTRY_RELEASE.
+func ErrorReporter() (proxy.ErrorReporter, error) {
+	dsn := GetEnv("SENTRY_DSN", "")
+	if dsn == "" {
+		return nil, nil
+	}
+	return sentry.New(dsn, GetEnv("SENTRY_ENVIRONMENT", ""), GetEnv("SENTRY_RELEASE", ""))
+}
+
+// StatsD connects to the StatsD daemon at STATSD_ADDR, if set. STATSD_PREFIX
+// (default "giscus_proxy.") prefixes metric names; STATSD_DATADOG=true sends
+// DogStatsD tags, including the constant STATSD_TAGS ("env:prod,team:web").
+func StatsD() (*statsd.Client, error) {
+	addr := GetEnv("STATSD_ADDR", "")
+	if addr == "" {
+		return nil, nil
+	}
+	c, err := statsd.Dial(addr, GetEnv("STATSD_PREFIX", "giscus_proxy."), GetList("STATSD_TAGS"), GetBool("STATSD_DATADOG", false))
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %w", err)
+	}
+	return c, nil
+}
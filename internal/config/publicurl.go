@@ -0,0 +1,175 @@
+package config
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// URLResolver derives the service's public URL from the runtime environment. It
+// returns "" when its platform isn't detected.
+type URLResolver struct {
+	Name    string
+	Resolve func() string
+}
+
+var (
+	resolversMu sync.Mutex
+	// custom holds resolvers registered by embedders; they run after PUBLIC_URL
+	// and before the platform built-ins.
+	custom []URLResolver
+)
+
+// builtinResolvers detect the platforms the proxy is commonly deployed to.
+var builtinResolvers = []URLResolver{
+	{"railway", railwayURL},
+	{"fly", func() string { return hostURL(GetEnv("FLY_APP_NAME", ""), ".fly.dev") }},
+	{"render", func() string {
+		if u := EnsureURL(os.Getenv("RENDER_EXTERNAL_URL"), ""); u != "" {
+			return u
+		}
+		return EnsureURL(os.Getenv("RENDER_EXTERNAL_HOSTNAME"), "https")
+	}},
+	{"heroku", func() string {
+		if u := EnsureURL(os.Getenv("HEROKU_APP_DEFAULT_DOMAIN_NAME"), "https"); u != "" {
+			return u
+		}
+		return hostURL(GetEnv("HEROKU_APP_NAME", ""), ".herokuapp.com")
+	}},
+	{"vercel", vercelURL},
+	{"cloud_run", cloudRunURL},
+}
+
+// RegisterURLResolver adds a resolver consulted after PUBLIC_URL and before the
+// built-in platform resolvers. Resolvers registered later run later.
+func RegisterURLResolver(name string, resolve func() string) {
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+	custom = append(custom, URLResolver{Name: name, Resolve: resolve})
+}
+
+// URLResolvers returns the resolver chain in the order PublicURL consults it.
+func URLResolvers() []URLResolver {
+	resolversMu.Lock()
+	defer resolversMu.Unlock()
+	chain := []URLResolver{{"public_url", func() string { return EnsureURL(os.Getenv("PUBLIC_URL"), "") }}}
+	chain = append(chain, custom...)
+	return append(chain, builtinResolvers...)
+}
+
+// PublicURL returns the first URL the resolver chain produces: PUBLIC_URL, then
+// registered resolvers, then Railway, Fly.io, Render, Heroku, Vercel and Cloud
+// Run conventions. It returns "" when none applies.
+func PublicURL() string {
+	for _, r := range URLResolvers() {
+		if u := strings.TrimRight(r.Resolve(), "/"); u != "" {
+			return u
+		}
+	}
+	return ""
+}
+
+// DerivePublicURL attempts to build a public URL for the service based on environment hints.
+func DerivePublicURL(bindAddr, host, port string) string {
+	if u := PublicURL(); u != "" {
+		return u
+	}
+
+	p := strings.TrimSpace(port)
+	h := strings.TrimSpace(host)
+	if p == "" {
+		b := bindAddr
+		if strings.HasPrefix(b, ":") {
+			p = strings.TrimPrefix(b, ":")
+		} else if i := strings.LastIndex(b, ":"); i != -1 {
+			p = b[i+1:]
+		}
+	}
+	if h == "" {
+		b := bindAddr
+		if strings.HasPrefix(b, ":") || b == "" {
+			h = "localhost"
+		} else if i := strings.LastIndex(b, ":"); i != -1 {
+			h = b[:i]
+		}
+	}
+	if h == "0.0.0.0" || h == "::" || h == "[::]" || h == "" {
+		h = "localhost"
+	}
+	if p == "" {
+		p = "8080"
+	}
+	return "http://" + h + ":" + p
+}
+
+// hostURL builds https://<name><suffix> when name is set.
+func hostURL(name, suffix string) string {
+	if name == "" {
+		return ""
+	}
+	return "https://" + name + suffix
+}
+
+func railwayURL() string {
+	if u := EnsureURL(os.Getenv("RAILWAY_PUBLIC_DOMAIN"), "https"); u != "" {
+		return u
+	}
+	return EnsureURL(os.Getenv("RAILWAY_URL"), "")
+}
+
+// vercelURL prefers the stable production domain over the per-deployment one.
+func vercelURL() string {
+	if os.Getenv("VERCEL_ENV") == "production" {
+		if u := EnsureURL(os.Getenv("VERCEL_PROJECT_PRODUCTION_URL"), "https"); u != "" {
+			return u
+		}
+	}
+	return EnsureURL(os.Getenv("VERCEL_URL"), "https")
+}
+
+// cloudRunMetadata is the metadata server Cloud Run exposes to every instance.
+const cloudRunMetadata = "http://metadata.google.internal/computeMetadata/v1/"
+
+// cloudRunURL builds the deterministic https://SERVICE-PROJECT_NUMBER.REGION.run.app
+// URL. Cloud Run only sets K_SERVICE, so the project number and region come from
+// the metadata server; the lookup is skipped elsewhere.
+var cloudRunURL = sync.OnceValue(func() string {
+	service := GetEnv("K_SERVICE", "")
+	if service == "" {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	project := metadata(ctx, "project/numeric-project-id")
+	region := path.Base(metadata(ctx, "instance/region")) // projects/N/regions/REGION
+	if project == "" || region == "" || region == "." {
+		return ""
+	}
+	return "https://" + service + "-" + project + "." + region + ".run.app"
+})
+
+func metadata(ctx context.Context, key string) string {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cloudRunMetadata+key, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
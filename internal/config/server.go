@@ -0,0 +1,109 @@
+//go:build !js
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/logfile"
+	"github.com/cdlus/giscus-proxy/internal/server"
+)
+
+// TLS reads the HTTPS settings: TLS_CERT_FILE/TLS_KEY_FILE for static certificates,
+// or ACME_DOMAINS (with ACME_EMAIL and ACME_CACHE_DIR) for automatic issuance.
+// HTTP_REDIRECT_ADDR (default ":80") hosts the challenge and redirect listener;
+// HTTP3_ENABLED adds HTTP/3 over QUIC.
+func TLS() server.TLS {
+	return server.TLS{
+		CertFile:     GetEnv("TLS_CERT_FILE", ""),
+		KeyFile:      GetEnv("TLS_KEY_FILE", ""),
+		ACMEDomains:  GetList("ACME_DOMAINS"),
+		ACMEEmail:    GetEnv("ACME_EMAIL", ""),
+		ACMECacheDir: GetEnv("ACME_CACHE_DIR", ""),
+		RedirectAddr: GetEnv("HTTP_REDIRECT_ADDR", ":80"),
+		HTTP3:        GetBool("HTTP3_ENABLED", false),
+	}
+}
+
+// Limits reads MAX_CONNECTIONS, the READ_TIMEOUT, WRITE_TIMEOUT and IDLE_TIMEOUT
+// server timeouts, SOCKET_MODE (octal, default 660) for Unix sockets and
+// REUSE_PORT for SO_REUSEPORT on TCP listeners.
+func Limits() server.Limits {
+	v := GetEnv("SOCKET_MODE", "660")
+	mode, err := strconv.ParseUint(v, 8, 32)
+	noteParse("SOCKET_MODE", v, "an octal file mode such as 660", err)
+	if err != nil {
+		mode = 0o660
+	}
+	return server.Limits{
+		MaxConns:     GetInt("MAX_CONNECTIONS", 0),
+		ReadTimeout:  GetDuration("READ_TIMEOUT", 15*time.Second),
+		WriteTimeout: GetDuration("WRITE_TIMEOUT", 60*time.Second),
+		IdleTimeout:  GetDuration("IDLE_TIMEOUT", 120*time.Second),
+		SocketMode:   os.FileMode(mode),
+		ReusePort:    GetBool("REUSE_PORT", false),
+	}
+}
+
+// Addrs returns the addresses to listen on: the comma-separated ADDR list (TCP
+// host:port or "unix:/path"), or HOST:PORT when ADDR is unset.
+func Addrs() []string {
+	if addrs := GetList("ADDR"); len(addrs) > 0 {
+		return addrs
+	}
+	host := GetEnv("HOST", "0.0.0.0")
+	port := strings.TrimPrefix(GetEnv("PORT", "8080"), ":")
+	return []string{host + ":" + port}
+}
+
+// graceMargin is kept free at the end of SHUTDOWN_GRACE_PERIOD so the process
+// exits on its own before the platform kills it.
+const graceMargin = 2 * time.Second
+
+// Drain reads SHUTDOWN_DELAY, how long /readyz fails before the listeners close
+// (default 0), and SHUTDOWN_TIMEOUT, how long in-flight requests may take to
+// finish (default 25s, below the usual 30s termination grace period). When
+// SHUTDOWN_GRACE_PERIOD (e.g. Kubernetes' terminationGracePeriodSeconds) is set,
+// the timeout defaults to, and is capped at, what remains of it after the delay.
+func Drain() server.Drain {
+	d := server.Drain{
+		Delay:   GetDuration("SHUTDOWN_DELAY", 0),
+		Timeout: GetDuration("SHUTDOWN_TIMEOUT", 25*time.Second),
+	}
+	if grace := GetDuration("SHUTDOWN_GRACE_PERIOD", 0); grace > 0 {
+		budget := max(grace-d.Delay-graceMargin, time.Second)
+		if GetEnv("SHUTDOWN_TIMEOUT", "") == "" || d.Timeout > budget {
+			d.Timeout = budget
+		}
+	}
+	return d
+}
+
+// LogOutput opens the log destination named by LOG_OUTPUT: "stdout" (default),
+// "stderr" or a file path. Files rotate past LOG_MAX_SIZE megabytes (default 100,
+// 0 disables) and every LOG_ROTATE_INTERVAL (e.g. "24h", off by default), keeping
+// LOG_MAX_BACKUPS (default 5) rotated files.
+func LogOutput() (io.Writer, error) {
+	switch dest := GetEnv("LOG_OUTPUT", "stdout"); dest {
+	case "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	default:
+		w := &logfile.Writer{
+			Path:       dest,
+			MaxSize:    int64(GetInt("LOG_MAX_SIZE", 100)) << 20,
+			Interval:   GetDuration("LOG_ROTATE_INTERVAL", 0),
+			MaxBackups: GetInt("LOG_MAX_BACKUPS", 5),
+		}
+		if err := w.Open(); err != nil {
+			return nil, fmt.Errorf("open LOG_OUTPUT: %w", err)
+		}
+		return w, nil
+	}
+}
@@ -0,0 +1,52 @@
+package config
+
+import "github.com/cdlus/giscus-proxy/internal/proxy"
+
+// tenantFile is the layout of TENANTS_FILE:
+//
+//	tenants:
+//	  - name: blog
+//	    sites: ["https://blog.example.com"]
+//	    replacements: ["giscus.app=>comments.example.com"]
+//	    light_theme: noborder_light
+//	    dark_theme: noborder_dark
+//	    repos: [example/blog]
+//	  - name: docs
+//	    sites: ["https://*.docs.example.com"]
+//	    upstream_origin: https://giscus.example.com
+type tenantFile struct {
+	Tenants []struct {
+		Name           string   `yaml:"name" toml:"name"`
+		Sites          []string `yaml:"sites" toml:"sites"`
+		UpstreamOrigin string   `yaml:"upstream_origin" toml:"upstream_origin"`
+		Replacements   []string `yaml:"replacements" toml:"replacements"`
+		LightTheme     string   `yaml:"light_theme" toml:"light_theme"`
+		DarkTheme      string   `yaml:"dark_theme" toml:"dark_theme"`
+		Repos          []string `yaml:"repos" toml:"repos"`
+	} `yaml:"tenants" toml:"tenants"`
+}
+
+// Tenants reads the tenants from the YAML (.yaml, .yml, .json) or TOML (.toml)
+// file named by TENANTS_FILE, or returns nil when it is unset.
+func Tenants() ([]proxy.Tenant, error) {
+	var doc tenantFile
+	if err := decodeFile("TENANTS_FILE", &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Tenants) == 0 {
+		return nil, nil
+	}
+	tenants := make([]proxy.Tenant, 0, len(doc.Tenants))
+	for _, t := range doc.Tenants {
+		tenants = append(tenants, proxy.Tenant{
+			Name:           t.Name,
+			Sites:          t.Sites,
+			UpstreamOrigin: t.UpstreamOrigin,
+			Replacements:   t.Replacements,
+			LightTheme:     t.LightTheme,
+			DarkTheme:      t.DarkTheme,
+			Repos:          t.Repos,
+		})
+	}
+	return tenants, nil
+}
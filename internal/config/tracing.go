@@ -0,0 +1,44 @@
+//go:build !js
+
+package config
+
+import (
+	"context"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing sets up OTLP/HTTP trace export when an OTLP endpoint is configured through
+// the standard OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
+// variables. The exporter, sampler (OTEL_TRACES_SAMPLER) and resource
+// (OTEL_SERVICE_NAME, OTEL_RESOURCE_ATTRIBUTES) read the remaining OTEL_* settings
+// themselves. It returns a nil provider when tracing is off; the shutdown function
+// flushes pending spans.
+func Tracing(ctx context.Context) (trace.TracerProvider, func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+	if GetBool("OTEL_SDK_DISABLED", false) || strings.EqualFold(GetEnv("OTEL_TRACES_EXPORTER", "otlp"), "none") {
+		return nil, noop, nil
+	}
+	if GetEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "") == "" && GetEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "") == "" {
+		return nil, noop, nil
+	}
+
+	exp, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, noop, err
+	}
+	res, err := resource.Merge(
+		resource.NewSchemaless(attribute.String("service.name", "giscus-proxy")),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, noop, err
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res))
+	return tp, tp.Shutdown, nil
+}
@@ -0,0 +1,16 @@
+//go:build js
+
+package config
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing is unavailable in the WebAssembly build, which leaves out the OTLP
+// exporter to stay within edge runtime size limits. It always returns a nil
+// provider.
+func Tracing(ctx context.Context) (trace.TracerProvider, func(context.Context) error, error) {
+	return nil, func(context.Context) error { return nil }, nil
+}
@@ -0,0 +1,157 @@
+// Package lambda adapts an http.Handler to AWS Lambda HTTP events in payload
+// format 2.0, as sent by Lambda Function URLs and API Gateway HTTP APIs.
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Adapter serves Lambda HTTP events with Handler. Function URL events share the
+// API Gateway v2 payload, so one adapter covers both.
+type Adapter struct {
+	Handler http.Handler
+	// StripPrefix is removed from request paths, for platforms that rewrite every
+	// path onto the function's own route (e.g. "/.netlify/functions/giscus-proxy").
+	StripPrefix string
+}
+
+// Handle converts the event to an http.Request, runs the handler and converts the
+// buffered response back. Binary and compressed bodies are base64-encoded.
+func (a Adapter) Handle(ctx context.Context, e events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	r, err := NewRequest(ctx, e)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusBadRequest, Body: err.Error()}, nil
+	}
+	return a.serve(r).response(), nil
+}
+
+func (a Adapter) serve(r *http.Request) *responseWriter {
+	if a.StripPrefix != "" {
+		if rest, ok := strings.CutPrefix(r.URL.Path, a.StripPrefix); ok {
+			if !strings.HasPrefix(rest, "/") {
+				rest = "/" + rest
+			}
+			r.URL.Path, r.URL.RawPath = rest, ""
+			r.RequestURI = r.URL.RequestURI()
+		}
+	}
+	w := &responseWriter{header: make(http.Header)}
+	a.Handler.ServeHTTP(w, r)
+	w.WriteHeader(http.StatusOK)
+	return w
+}
+
+// NewRequest builds the http.Request described by a payload 2.0 event.
+func NewRequest(ctx context.Context, e events.APIGatewayV2HTTPRequest) (*http.Request, error) {
+	body := []byte(e.Body)
+	if e.IsBase64Encoded {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(e.Body); err != nil {
+			return nil, fmt.Errorf("decode base64 body: %w", err)
+		}
+	}
+	path := e.RawPath
+	if path == "" {
+		path = "/"
+	}
+	if e.RawQueryString != "" {
+		path += "?" + e.RawQueryString
+	}
+	r, err := http.NewRequestWithContext(ctx, e.RequestContext.HTTP.Method, path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range e.Headers {
+		r.Header.Set(k, v)
+	}
+	if len(e.Cookies) > 0 {
+		r.Header.Set("Cookie", strings.Join(e.Cookies, "; "))
+	}
+	// Lambda endpoints are HTTPS-only; tell the proxy so generated URLs match.
+	if r.Header.Get("X-Forwarded-Proto") == "" {
+		r.Header.Set("X-Forwarded-Proto", "https")
+	}
+	r.Host = r.Header.Get("Host")
+	if r.Host == "" {
+		r.Host = e.RequestContext.DomainName
+	}
+	r.URL.Host = r.Host
+	r.RemoteAddr = net.JoinHostPort(e.RequestContext.HTTP.SourceIP, "0")
+	r.RequestURI = path
+	r.ContentLength = int64(len(body))
+	return r, nil
+}
+
+// responseWriter buffers a response; Lambda returns it in one piece.
+type responseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseWriter) Header() http.Header { return w.header }
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+func (w *responseWriter) response() events.APIGatewayV2HTTPResponse {
+	resp := events.APIGatewayV2HTTPResponse{
+		StatusCode: w.status,
+		Headers:    make(map[string]string, len(w.header)),
+		Cookies:    w.header.Values("Set-Cookie"),
+	}
+	// Payload 2.0 has no multi-value headers; cookies travel separately and
+	// everything else may be comma-joined.
+	for k, vs := range w.header {
+		if k != "Set-Cookie" {
+			resp.Headers[k] = strings.Join(vs, ", ")
+		}
+	}
+	resp.Body, resp.IsBase64Encoded = w.encodedBody()
+	return resp
+}
+
+// encodedBody returns the body as-is when it is text and base64-encoded otherwise.
+func (w *responseWriter) encodedBody() (string, bool) {
+	if isText(w.header) {
+		return w.body.String(), false
+	}
+	return base64.StdEncoding.EncodeToString(w.body.Bytes()), true
+}
+
+// isText reports whether a body with these headers survives as a JSON string.
+func isText(h http.Header) bool {
+	if ce := h.Get("Content-Encoding"); ce != "" && ce != "identity" {
+		return false
+	}
+	mt, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return h.Get("Content-Type") == ""
+	}
+	if strings.HasPrefix(mt, "text/") {
+		return true
+	}
+	switch mt {
+	case "application/json", "application/javascript", "application/xml",
+		"application/manifest+json", "image/svg+xml":
+		return true
+	}
+	return strings.HasSuffix(mt, "+json") || strings.HasSuffix(mt, "+xml")
+}
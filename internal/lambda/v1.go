@@ -0,0 +1,77 @@
+package lambda
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HandleV1 is Handle for payload format 1.0 events, as sent by API Gateway REST
+// APIs and Netlify Functions.
+func (a Adapter) HandleV1(ctx context.Context, e events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	r, err := NewRequestV1(ctx, e)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: err.Error()}, nil
+	}
+	w := a.serve(r)
+	resp := events.APIGatewayProxyResponse{
+		StatusCode:        w.status,
+		MultiValueHeaders: w.header,
+	}
+	resp.Body, resp.IsBase64Encoded = w.encodedBody()
+	return resp, nil
+}
+
+// NewRequestV1 builds the http.Request described by a payload 1.0 event.
+func NewRequestV1(ctx context.Context, e events.APIGatewayProxyRequest) (*http.Request, error) {
+	body := []byte(e.Body)
+	if e.IsBase64Encoded {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(e.Body); err != nil {
+			return nil, fmt.Errorf("decode base64 body: %w", err)
+		}
+	}
+	u := &url.URL{Path: e.Path}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	query := url.Values(e.MultiValueQueryStringParameters)
+	if len(query) == 0 {
+		query = make(url.Values, len(e.QueryStringParameters))
+		for k, v := range e.QueryStringParameters {
+			query.Set(k, v)
+		}
+	}
+	u.RawQuery = query.Encode()
+	r, err := http.NewRequestWithContext(ctx, e.HTTPMethod, u.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range e.Headers {
+		r.Header.Set(k, v)
+	}
+	for k, vs := range e.MultiValueHeaders {
+		r.Header.Del(k)
+		for _, v := range vs {
+			r.Header.Add(k, v)
+		}
+	}
+	if r.Header.Get("X-Forwarded-Proto") == "" {
+		r.Header.Set("X-Forwarded-Proto", "https")
+	}
+	r.Host = r.Header.Get("Host")
+	if r.Host == "" {
+		r.Host = e.RequestContext.DomainName
+	}
+	r.URL.Host = r.Host
+	r.RemoteAddr = net.JoinHostPort(e.RequestContext.Identity.SourceIP, "0")
+	r.RequestURI = u.RequestURI()
+	r.ContentLength = int64(len(body))
+	return r, nil
+}
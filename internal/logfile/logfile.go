@@ -0,0 +1,156 @@
+// Package logfile writes logs to a file that rotates by size and/or age, keeping
+// a bounded number of timestamped backups next to it.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupLayout is appended to the file name of rotated files.
+const backupLayout = "20060102-150405"
+
+// Writer is an io.WriteCloser appending to Path. It is safe for concurrent use.
+type Writer struct {
+	// Path of the active log file; its directory must exist.
+	Path string
+	// MaxSize rotates the file before a write would take it past this many bytes.
+	// Zero disables size-based rotation.
+	MaxSize int64
+	// Interval rotates the file once it has been open this long. Zero disables
+	// time-based rotation.
+	Interval time.Duration
+	// MaxBackups is how many rotated files are kept; older ones are deleted.
+	// Zero keeps them all.
+	MaxBackups int
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+// Open opens (or creates) w.Path for appending, so a configuration error
+// surfaces at startup rather than on the first log line.
+func (w *Writer) Open() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.open()
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.f, w.size, w.opened = f, info.Size(), time.Now()
+	return nil
+}
+
+// Write appends p, rotating first when the size or age limit is reached.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if w.due(int64(len(p))) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *Writer) due(next int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.MaxSize > 0 && w.size+next > w.MaxSize {
+		return true
+	}
+	return w.Interval > 0 && time.Since(w.opened) >= w.Interval
+}
+
+// Rotate moves the current file aside and starts a new one.
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+func (w *Writer) rotate() error {
+	if w.f != nil {
+		if err := w.f.Close(); err != nil {
+			return err
+		}
+		w.f = nil
+	}
+	backup := w.Path + "." + time.Now().Format(backupLayout)
+	// Several rotations within a second would collide; suffix them.
+	for i := 1; ; i++ {
+		if _, err := os.Stat(backup); os.IsNotExist(err) {
+			break
+		}
+		backup = fmt.Sprintf("%s.%s.%d", w.Path, time.Now().Format(backupLayout), i)
+	}
+	if err := os.Rename(w.Path, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.prune()
+	return nil
+}
+
+// prune deletes the oldest backups beyond MaxBackups. Failures are ignored;
+// a leftover backup is better than losing the log line being written.
+func (w *Writer) prune() {
+	if w.MaxBackups <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(w.Path + ".*")
+	if err != nil {
+		return
+	}
+	prefix := w.Path + "."
+	backups := matches[:0]
+	for _, m := range matches {
+		stamp, _, _ := strings.Cut(strings.TrimPrefix(m, prefix), ".")
+		if _, err := time.Parse(backupLayout, stamp); err == nil {
+			backups = append(backups, m)
+		}
+	}
+	slices.Sort(backups)
+	for len(backups) > w.MaxBackups {
+		_ = os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
+
+// Close closes the current file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// AdminAuth guards administrative endpoints with a bearer token and/or basic auth
+// credentials. A request passes when it satisfies any configured method.
+type AdminAuth struct {
+	Token    string
+	User     string
+	Password string
+}
+
+// Enabled reports whether any credential is configured.
+func (a AdminAuth) Enabled() bool {
+	return a.Token != "" || (a.User != "" && a.Password != "")
+}
+
+// Authorized checks the request's Authorization header.
+func (a AdminAuth) Authorized(r *http.Request) bool {
+	_, ok := a.Identify(r)
+	return ok
+}
+
+// Identify returns who the request authenticated as: "token" for the bearer token
+// or "user:NAME" for basic auth.
+func (a AdminAuth) Identify(r *http.Request) (string, bool) {
+	if a.Token != "" {
+		if tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && secureEqual(strings.TrimSpace(tok), a.Token) {
+			return "token", true
+		}
+	}
+	if a.User != "" && a.Password != "" {
+		if u, pw, ok := r.BasicAuth(); ok && secureEqual(u, a.User) && secureEqual(pw, a.Password) {
+			return "user:" + u, true
+		}
+	}
+	return "", false
+}
+
+// Middleware rejects unauthorized requests with 401. With no credentials configured
+// every request is rejected, so admin endpoints are never exposed by accident.
+func (a AdminAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() || !a.Authorized(r) {
+			if a.User != "" {
+				w.Header().Add("WWW-Authenticate", `Basic realm="giscus-proxy admin"`)
+			}
+			if a.Token != "" {
+				w.Header().Add("WWW-Authenticate", `Bearer realm="giscus-proxy admin"`)
+			}
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP resolves the address of the visitor behind a request, honoring
+// X-Forwarded-For only when the immediate peer is a trusted proxy.
+type ClientIP struct {
+	trusted []*net.IPNet
+	unix    bool
+}
+
+// NewClientIP builds a resolver trusting the given proxy CIDRs or single IPs. The
+// entry "unix" trusts peers connecting over a Unix domain socket.
+func NewClientIP(trusted []string) (*ClientIP, error) {
+	var cidrs []string
+	trustUnix := false
+	for _, t := range trusted {
+		if strings.TrimSpace(t) == "unix" {
+			trustUnix = true
+			continue
+		}
+		cidrs = append(cidrs, t)
+	}
+	nets, err := ParseCIDRs(cidrs)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientIP{trusted: nets, unix: trustUnix}, nil
+}
+
+// unixPeer reports whether remoteAddr belongs to a Unix domain socket connection,
+// whose peers have no address ("" or "@").
+func unixPeer(remoteAddr string) bool {
+	return remoteAddr == "" || remoteAddr == "@"
+}
+
+// ParseCIDRs parses CIDR blocks, accepting bare IPs as single-host networks.
+func ParseCIDRs(vals []string) ([]*net.IPNet, error) {
+	var out []*net.IPNet
+	for _, v := range vals {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", v)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", v, err)
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+func contains(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustedPeer reports whether the immediate peer of r is a trusted proxy.
+func (c *ClientIP) TrustedPeer(r *http.Request) bool {
+	if c == nil {
+		return false
+	}
+	if unixPeer(r.RemoteAddr) {
+		return c.unix
+	}
+	if len(c.trusted) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	peer := net.ParseIP(host)
+	return peer != nil && contains(c.trusted, peer)
+}
+
+// Resolve returns the client IP for r. X-Forwarded-For is walked from the right,
+// skipping trusted proxies, so visitors can't spoof their address by prepending entries.
+func (c *ClientIP) Resolve(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !c.TrustedPeer(r) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		ip := net.ParseIP(hop)
+		if ip == nil {
+			continue
+		}
+		if !contains(c.trusted, ip) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
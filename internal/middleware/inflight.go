@@ -0,0 +1,28 @@
+package middleware
+
+import "net/http"
+
+// InFlight caps the number of requests handled concurrently. Requests over the cap
+// are shed at once instead of queueing, keeping latency bounded under floods.
+type InFlight struct {
+	slots chan struct{}
+}
+
+// NewInFlight allows up to max concurrent requests.
+func NewInFlight(max int) *InFlight {
+	return &InFlight{slots: make(chan struct{}, max)}
+}
+
+// Middleware answers 503 with Retry-After when every slot is taken.
+func (f *InFlight) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case f.slots <- struct{}{}:
+			defer func() { <-f.slots }()
+			next.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "server busy", http.StatusServiceUnavailable)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+)
+
+// IPFilter admits clients by CIDR. Deny entries are checked first; when the allow
+// list is non-empty, clients must also match it.
+type IPFilter struct {
+	allow     []*net.IPNet
+	deny      []*net.IPNet
+	ip        *ClientIP
+	rejectAll bool
+}
+
+// RejectAll returns a filter that admits no client, for failing closed on bad configuration.
+func RejectAll() *IPFilter {
+	return &IPFilter{rejectAll: true}
+}
+
+// NewIPFilter builds a filter from CIDR (or bare IP) lists.
+func NewIPFilter(allow, deny []string, ip *ClientIP) (*IPFilter, error) {
+	a, err := ParseCIDRs(allow)
+	if err != nil {
+		return nil, err
+	}
+	d, err := ParseCIDRs(deny)
+	if err != nil {
+		return nil, err
+	}
+	return &IPFilter{allow: a, deny: d, ip: ip}, nil
+}
+
+// Allowed reports whether the client behind r may use the proxy.
+func (f *IPFilter) Allowed(r *http.Request) bool {
+	if f.rejectAll {
+		return false
+	}
+	ip := net.ParseIP(f.ip.Resolve(r))
+	if ip == nil {
+		return len(f.allow) == 0 && len(f.deny) == 0
+	}
+	if contains(f.deny, ip) {
+		return false
+	}
+	return len(f.allow) == 0 || contains(f.allow, ip)
+}
+
+// Middleware rejects filtered clients with 403.
+func (f *IPFilter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !f.Allowed(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
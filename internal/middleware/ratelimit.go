@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const rateLimitSweepEvery = time.Minute
+
+// RateLimiter is a per-client token bucket limiter.
+type RateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	rps       float64
+	burst     float64
+	ip        *ClientIP
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter allows each client rps requests per second with bursts of up to burst requests.
+func NewRateLimiter(rps float64, burst int, ip *ClientIP) *RateLimiter {
+	if burst < 1 {
+		burst = int(math.Ceil(rps))
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		buckets:   make(map[string]*bucket),
+		rps:       rps,
+		burst:     float64(burst),
+		ip:        ip,
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow takes a token for key, returning how long to wait when none is available.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > rateLimitSweepEvery {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rps)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rps * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have refilled completely; they are indistinguishable from new ones.
+func (l *RateLimiter) sweep(now time.Time) {
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rps >= l.burst {
+			delete(l.buckets, k)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Middleware rejects requests over the limit with 429 and a Retry-After header.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := l.Allow(l.ip.Resolve(r))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
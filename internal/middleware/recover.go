@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime/debug"
+)
+
+// Recoverer turns handler panics into 500 responses instead of dropped connections.
+type Recoverer struct {
+	// OnPanic is called with the recovered value and the goroutine stack.
+	OnPanic func(r *http.Request, v any, stack []byte)
+	// Respond writes the error response; the default is a plain-text 500.
+	Respond func(w http.ResponseWriter, r *http.Request)
+}
+
+// Middleware recovers panics from next. http.ErrAbortHandler is re-raised, since
+// it deliberately aborts the response.
+func (rc Recoverer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			if rc.OnPanic != nil {
+				rc.OnPanic(r, v, debug.Stack())
+			}
+			if rc.Respond != nil {
+				rc.Respond(w, r)
+				return
+			}
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DefaultCSP is tuned for the giscus widget iframe: Next.js inline bootstrapping,
+// GitHub avatars and API calls, custom themes from any HTTPS origin, and framing
+// by any embedding site.
+const DefaultCSP = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline'; " +
+	"style-src 'self' 'unsafe-inline' https:; " +
+	"img-src 'self' data: https:; " +
+	"font-src 'self' data: https:; " +
+	"connect-src 'self' https://api.github.com; " +
+	"frame-ancestors *; " +
+	"base-uri 'self'; " +
+	"form-action 'self' https://github.com"
+
+// SecurityHeaders sets hardening headers on every response. Empty fields are skipped.
+type SecurityHeaders struct {
+	HSTS                  string
+	ContentTypeOptions    string
+	ReferrerPolicy        string
+	ContentSecurityPolicy string
+}
+
+// DefaultSecurityHeaders returns sane defaults for serving the giscus widget.
+func DefaultSecurityHeaders() SecurityHeaders {
+	return SecurityHeaders{
+		HSTS:                  "max-age=31536000; includeSubDomains",
+		ContentTypeOptions:    "nosniff",
+		ReferrerPolicy:        "strict-origin-when-cross-origin",
+		ContentSecurityPolicy: DefaultCSP,
+	}
+}
+
+// Middleware applies the headers. HSTS is only sent on HTTPS requests, including
+// those terminated by a proxy that sets X-Forwarded-Proto.
+func (s SecurityHeaders) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		if s.HSTS != "" && isHTTPS(r) {
+			h.Set("Strict-Transport-Security", s.HSTS)
+		}
+		if s.ContentTypeOptions != "" {
+			h.Set("X-Content-Type-Options", s.ContentTypeOptions)
+		}
+		if s.ReferrerPolicy != "" {
+			h.Set("Referrer-Policy", s.ReferrerPolicy)
+		}
+		if s.ContentSecurityPolicy != "" {
+			h.Set("Content-Security-Policy", s.ContentSecurityPolicy)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
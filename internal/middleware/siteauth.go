@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// SiteAuthCookie remembers a valid shared token so the widget's own asset and API
+// requests pass without repeating it in every URL.
+const SiteAuthCookie = "giscus_proxy_token"
+
+// SiteAuth hides the whole proxy behind basic auth and/or a shared token. The token
+// may be sent as a "token" query parameter, a bearer token or the SiteAuthCookie.
+type SiteAuth struct {
+	User     string
+	Password string
+	Token    string
+	// Exempt lists paths served without credentials; entries ending in "/" match
+	// by prefix.
+	Exempt []string
+}
+
+// Enabled reports whether any credential is configured.
+func (a SiteAuth) Enabled() bool {
+	return a.Token != "" || (a.User != "" && a.Password != "")
+}
+
+func (a SiteAuth) exempt(path string) bool {
+	for _, e := range a.Exempt {
+		if path == e || (strings.HasSuffix(e, "/") && strings.HasPrefix(path, e)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a SiteAuth) cookieValue() string {
+	sum := sha256.Sum256([]byte("giscus-proxy:" + a.Token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (a SiteAuth) authorized(r *http.Request) bool {
+	if a.ownAuthorization(r) {
+		return true
+	}
+	if a.Token == "" {
+		return false
+	}
+	c, err := r.Cookie(SiteAuthCookie)
+	return err == nil && secureEqual(c.Value, a.cookieValue())
+}
+
+// ownAuthorization reports whether r's Authorization header carries the site's
+// basic credentials or token rather than something meant for the upstream.
+func (a SiteAuth) ownAuthorization(r *http.Request) bool {
+	if a.User != "" && a.Password != "" {
+		if u, pw, ok := r.BasicAuth(); ok && secureEqual(u, a.User) && secureEqual(pw, a.Password) {
+			return true
+		}
+	}
+	if a.Token == "" {
+		return false
+	}
+	tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && secureEqual(strings.TrimSpace(tok), a.Token)
+}
+
+// withoutCredentials returns r without the site's credentials in its
+// Authorization header, which browsers repeat on every request to the proxy.
+func (a SiteAuth) withoutCredentials(r *http.Request) *http.Request {
+	if !a.ownAuthorization(r) {
+		return r
+	}
+	r2 := r.Clone(r.Context())
+	r2.Header.Del("Authorization")
+	return r2
+}
+
+// Middleware rejects requests without valid credentials with 401. A valid token in
+// the query string is removed before the request continues and remembered in a
+// cookie, and the site's credentials are removed from the Authorization header,
+// so neither reaches the upstream. CORS preflights and exempt paths always pass.
+func (a SiteAuth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || a.exempt(r.URL.Path) || a.authorized(r) {
+			next.ServeHTTP(w, a.withoutCredentials(r))
+			return
+		}
+		q := r.URL.Query()
+		if a.Token != "" && q.Has("token") && secureEqual(q.Get("token"), a.Token) {
+			cookie := &http.Cookie{Name: SiteAuthCookie, Value: a.cookieValue(), Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode}
+			if isHTTPS(r) {
+				// The widget runs in a cross-site iframe, which only sends SameSite=None cookies.
+				cookie.Secure = true
+				cookie.SameSite = http.SameSiteNoneMode
+			}
+			http.SetCookie(w, cookie)
+			q.Del("token")
+			r2 := r.Clone(r.Context())
+			r2.URL.RawQuery = q.Encode()
+			r2.RequestURI = r2.URL.RequestURI()
+			next.ServeHTTP(w, r2)
+			return
+		}
+		if a.User != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="giscus-proxy"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	})
+}
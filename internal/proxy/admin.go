@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+// registerAdmin attaches the admin endpoints behind the shared auth middleware.
+// Nothing is registered unless admin credentials are configured.
+func (p *Proxy) registerAdmin(rt *routeTable) {
+	if !p.adminAuth.Enabled() {
+		return
+	}
+	p.handleAdmin(rt, "/config", p.handleAdminConfig)
+	p.handleAdmin(rt, "/drain", p.handleAdminDrain)
+	p.handleAdmin(rt, "/giscus.json", p.handleAdminGiscusJSON)
+	if p.cache != nil {
+		p.handleAdmin(rt, "/purge", p.handleAdminPurge)
+	}
+	if p.stats != nil {
+		p.handleAdmin(rt, "/stats", p.handleAdminStats)
+	}
+	if p.capture != nil {
+		p.handleAdmin(rt, "/capture", p.handleAdminCapture)
+	}
+	if p.pprof {
+		p.handleAdminPattern(rt, "/debug/pprof/", "pprof", pprof.Index)
+		p.handleAdminPattern(rt, "/debug/pprof/cmdline", "pprof", pprof.Cmdline)
+		p.handleAdminPattern(rt, "/debug/pprof/profile", "pprof", pprof.Profile)
+		p.handleAdminPattern(rt, "/debug/pprof/symbol", "pprof", pprof.Symbol)
+		p.handleAdminPattern(rt, "/debug/pprof/trace", "pprof", pprof.Trace)
+	}
+	if p.vars != nil {
+		p.handleAdminPattern(rt, "/debug/vars", "vars", p.handleVars)
+	}
+}
+
+// handleAdmin registers an admin endpoint behind authentication. Every call,
+// including rejected ones, is recorded in the audit log.
+func (p *Proxy) handleAdmin(rt *routeTable, path string, h http.HandlerFunc) {
+	p.handleAdminPattern(rt, p.adminPrefix+path, strings.Trim(path, "/"), h)
+}
+
+// handleAdminPattern is handleAdmin for endpoints outside the admin prefix.
+func (p *Proxy) handleAdminPattern(rt *routeTable, pattern, action string, h http.HandlerFunc) {
+	authed := p.adminAuth.Middleware(h)
+	rt.add(pattern, "admin/"+action, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		authed.ServeHTTP(sw, r)
+		p.audit(r, action, sw.status)
+	}))
+}
+
+// handleAdminConfig reports the effective, non-secret configuration.
+func (p *Proxy) handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"upstream_origin":    p.upstreamOrigin,
+		"api_origin":         p.apiOrigin,
+		"public_origin":      p.publicOrigin,
+		"base_path":          p.basePath,
+		"widget_source_path": p.widgetSourcePath,
+		"widget_paths":       p.widgetPaths,
+		"cache_enabled":      p.cache != nil,
+		"replacements":       len(p.replacers),
+		"query_replacements": p.queryReplacers,
+		"dom_rules":          len(p.domRules),
+		"next_data":          len(p.nextData),
+		"snippets":           len(p.snippets),
+		"strip_telemetry":    p.stripTelemetry,
+		"remove_footer":      p.removeFooter,
+		"base_path_rewrite":  len(p.baseReplacers) > 0,
+		"auth_proxy":         p.authProxy,
+		"github_direct":      p.github != nil,
+		"mirrors":            len(p.mirrors),
+		"tenants":            tenantNames(p.tenants),
+		"profiles":           profileNames(p.profiles),
+		"snapshot":           p.snapshot,
+		"feed":               p.feed != nil,
+		"webhook_relay":      relayName(p.relay),
+		"pins":               p.pinStatus(),
+		"remote_themes":      p.remoteThemes != nil,
+		"sri":                p.sri,
+		"minify":             p.minify,
+		"transform_types":    p.transformTypes,
+		"rate_limited":       p.rateLimiter != nil,
+		"security_headers":   p.security != nil,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/middleware"
+)
+
+// auditEntry is one line of the admin audit log.
+type auditEntry struct {
+	Time   string `json:"time"`
+	Actor  string `json:"actor"`
+	Action string `json:"action"`
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	IP     string `json:"ip"`
+	Status int    `json:"status"`
+	ID     string `json:"request_id,omitempty"`
+}
+
+// audit records an admin request: who made it, what it did, when and from where.
+func (p *Proxy) audit(r *http.Request, action string, status int) {
+	actor, ok := p.adminAuth.Identify(r)
+	if !ok {
+		actor = "anonymous"
+	}
+	line, err := json.Marshal(auditEntry{
+		Time:   p.clock.Now().UTC().Format(time.RFC3339),
+		Actor:  actor,
+		Action: action,
+		Method: r.Method,
+		Path:   r.URL.Path,
+		IP:     p.clientIP.Resolve(r),
+		Status: status,
+		ID:     middleware.RequestIDFrom(r.Context()),
+	})
+	if err != nil {
+		return
+	}
+	if p.auditLogger != nil {
+		p.auditLogger.Print(string(line))
+		return
+	}
+	p.logf("audit  %s", line)
+}
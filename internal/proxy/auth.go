@@ -0,0 +1,284 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/middleware"
+)
+
+// maxAuthBody bounds request bodies forwarded by the auth handler; giscus only
+// posts small JSON documents.
+const maxAuthBody = 64 << 10
+
+// authResponseHeaders are the upstream response headers the auth handler relays,
+// besides Location and Set-Cookie, which are rewritten.
+var authResponseHeaders = []string{"Content-Type", "Cache-Control", "Vary", "Www-Authenticate"}
+
+// upstreamCookiePrefix is put in front of the names of cookies the upstream
+// sets. Only cookies carrying it go back upstream, so the other cookies of the
+// proxy's host, such as a blog's session when the proxy shares its domain
+// under BasePath, stay with the visitor.
+const upstreamCookiePrefix = "giscus-proxy."
+
+// keepRedirectsKey marks upstream requests whose redirects must be handed back
+// to the visitor instead of being followed.
+type keepRedirectsKey struct{}
+
+// keepAuthRedirects returns a copy of c that hands redirects of auth requests
+// back unfollowed and otherwise follows them like c does.
+func keepAuthRedirects(c *http.Client) *http.Client {
+	cc := *c
+	check := c.CheckRedirect
+	cc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if req.Context().Value(keepRedirectsKey{}) != nil {
+			return http.ErrUseLastResponse
+		}
+		if check != nil {
+			return check(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &cc
+}
+
+// isAuthRequest reports whether a request under /api/ belongs to the sign-in
+// flow or an authenticated API call rather than to cacheable passthrough.
+func isAuthRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/oauth/") || r.Header.Get("Authorization") != "" ||
+		(r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions)
+}
+
+// handleAPI sends sign-in and authenticated requests under /api/ to handleAuth
+// and the rest to the passthrough handler.
+func (p *Proxy) handleAPI(w http.ResponseWriter, r *http.Request) {
+	if isAuthRequest(r) {
+		p.handleAuth(w, r)
+		return
+	}
+	p.handlePassthrough(w, r)
+}
+
+// handleAuth forwards the giscus OAuth flow and authenticated API calls: any
+// method, with the visitor's Authorization header and cookies, never cached.
+// Redirects are relayed instead of followed, with Location headers pointing at
+// the upstream moved to the proxy, and cookies set by the upstream are scoped to
+// the proxy's host.
+func (p *Proxy) handleAuth(w http.ResponseWriter, r *http.Request) {
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	var target string
+	var ph phases
+	r, span := p.startSpan(r, "auth")
+	defer func() {
+		p.logLine(r, "auth", sw.status, sw.written, time.Since(start), "BYPASS", target)
+		p.logSlow(r, "auth", sw.status, time.Since(start), &ph)
+		p.endSpan(span, sw.status, "BYPASS", target)
+	}()
+	w = sw
+
+	if !p.checkOrigin(w, r) || !p.checkSite(w, r) || !p.checkBot(w, r) {
+		return
+	}
+	if r.Method == http.MethodOptions {
+		p.writeAuthCORS(w, r)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if !p.passthroughPaths.allowed(r.URL.Path) {
+		p.httpError(w, r, "404 page not found", http.StatusNotFound)
+		return
+	}
+
+	target = p.upstreamFor(r) + r.URL.Path
+	if raw := r.URL.RawQuery; raw != "" {
+		target += "?" + raw
+	}
+	ctx := context.WithValue(r.Context(), keepRedirectsKey{}, true)
+	req, err := http.NewRequestWithContext(ctx, r.Method, target, http.MaxBytesReader(w, r.Body, maxAuthBody))
+	if err != nil {
+		p.httpError(w, r, "failed to build upstream request", http.StatusInternalServerError)
+		return
+	}
+	req.ContentLength = r.ContentLength
+	p.headerPolicy.forward(req.Header, r.Header)
+	if v := r.Header.Get("Authorization"); v != "" {
+		req.Header.Set("Authorization", v)
+	}
+	if v := upstreamCookies(r); v != "" {
+		req.Header.Set("Cookie", v)
+	}
+	if id := middleware.RequestIDFrom(r.Context()); id != "" {
+		req.Header.Set(middleware.RequestIDHeader, id)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	ph.begin()
+	resp, err := p.client.Do(req)
+	ph.end(&ph.upstream)
+	if err != nil {
+		p.upstreamError(w, r, err)
+		return
+	}
+	defer resp.Body.Close()
+	p.debugUpstream(req, resp)
+
+	p.writeAuthCORS(w, r)
+	copyIf(w.Header(), resp.Header, authResponseHeaders...)
+	if w.Header().Get("Cache-Control") == "" {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	if loc := resp.Header.Get("Location"); loc != "" {
+		w.Header().Set("Location", p.rewriteAuthLocation(r, loc))
+	}
+	for _, c := range resp.Header.Values("Set-Cookie") {
+		if c = proxyCookie(c, p.basePath); c != "" {
+			w.Header().Add("Set-Cookie", c)
+		}
+	}
+	if len(p.mirrors) > 0 && mirrorType(resp.Header.Get("Content-Type")) && r.Method != http.MethodHead {
+		ph.begin()
+		bin, err := io.ReadAll(resp.Body)
+		ph.end(&ph.upstream)
+		if err != nil {
+			p.httpError(w, r, "failed to read upstream body", http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(resp.StatusCode)
+		ph.begin()
+		_, _ = w.Write(p.rewriteMirrors(r, resp.Header.Get("Content-Type"), bin))
+		ph.end(&ph.write)
+		return
+	}
+	w.WriteHeader(resp.StatusCode)
+	if r.Method != http.MethodHead {
+		ph.begin()
+		_, _ = io.Copy(w, resp.Body)
+		ph.end(&ph.write)
+	}
+}
+
+// writeAuthCORS writes the CORS headers with the methods the auth routes accept.
+func (p *Proxy) writeAuthCORS(w http.ResponseWriter, r *http.Request) {
+	p.writeCORS(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		w.Header().Set("Access-Control-Allow-Methods", "GET,HEAD,POST,PUT,PATCH,DELETE,OPTIONS")
+	}
+}
+
+// upstreamCookies returns the cookies the upstream set through proxyCookie,
+// under their original names. The visitor's other cookies aren't sent.
+func upstreamCookies(r *http.Request) string {
+	var parts []string
+	for _, c := range r.Cookies() {
+		if name, ok := upstreamCookieName(c.Name); ok {
+			parts = append(parts, name+"="+c.Value)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// cookieNamePrefixes are the name prefixes browsers give special meaning; they
+// stay in front of upstreamCookiePrefix.
+var cookieNamePrefixes = []string{"__Secure-", "__Host-"}
+
+// splitCookiePrefix splits one of cookieNamePrefixes off name.
+func splitCookiePrefix(name string) (prefix, rest string) {
+	for _, prefix := range cookieNamePrefixes {
+		if rest, ok := strings.CutPrefix(name, prefix); ok {
+			return prefix, rest
+		}
+	}
+	return "", name
+}
+
+// proxyCookie scopes a Set-Cookie value from the upstream to the proxy: the
+// name gets upstreamCookiePrefix, the Domain attribute is dropped and the Path
+// is moved under basePath. As __Host- cookies must have Path=/, they become
+// __Secure- ones under a base path. It returns "" for a value without a name.
+func proxyCookie(setCookie, basePath string) string {
+	attrs := strings.Split(setCookie, ";")
+	name, value, ok := strings.Cut(attrs[0], "=")
+	if name = strings.TrimSpace(name); !ok || name == "" {
+		return ""
+	}
+	special, name := splitCookiePrefix(name)
+	if special == "__Host-" && basePath != "" {
+		special = "__Secure-"
+	}
+	out := []string{special + upstreamCookiePrefix + name + "=" + value}
+	for _, a := range attrs[1:] {
+		k, v, _ := strings.Cut(strings.TrimSpace(a), "=")
+		switch {
+		case strings.EqualFold(k, "domain"):
+			continue
+		case strings.EqualFold(k, "path") && basePath != "":
+			a = " Path=" + basePath + strings.TrimSuffix(v, "/")
+			if !strings.HasPrefix(v, "/") {
+				// Not an absolute path, so browsers use the default; scope it
+				// to the base path instead.
+				a = " Path=" + basePath
+			}
+		}
+		out = append(out, a)
+	}
+	return strings.Join(out, ";")
+}
+
+// upstreamCookieName returns the upstream's name for a cookie set through
+// proxyCookie, and false for any other cookie.
+func upstreamCookieName(name string) (string, bool) {
+	special, name := splitCookiePrefix(name)
+	name, ok := strings.CutPrefix(name, upstreamCookiePrefix)
+	if !ok || name == "" {
+		return "", false
+	}
+	return special + name, true
+}
+
+// rewriteAuthLocation moves redirects to the upstream (the API or the widget
+// origin) onto the proxy. With RewriteAuthCallback set, redirect_uri parameters
+// pointing at the upstream, as in the redirect to GitHub's authorize page, are
+// moved too.
+func (p *Proxy) rewriteAuthLocation(r *http.Request, loc string) string {
+	origins := []string{p.upstreamFor(r), p.upstreamOrigin}
+	if rest, ok := trimOrigin(loc, origins); ok {
+		loc = p.proxyBase(r) + rest
+	} else if strings.HasPrefix(loc, "/") && !strings.HasPrefix(loc, "//") {
+		loc = p.basePath + loc
+	}
+	if !p.authCallbacks {
+		return loc
+	}
+	u, err := url.Parse(loc)
+	if err != nil {
+		return loc
+	}
+	q := u.Query()
+	rest, ok := trimOrigin(q.Get("redirect_uri"), origins)
+	if !ok {
+		return loc
+	}
+	q.Set("redirect_uri", p.proxyBase(r)+rest)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// trimOrigin strips the first of origins that s starts with, reporting whether
+// one matched.
+func trimOrigin(s string, origins []string) (string, bool) {
+	for _, o := range origins {
+		if s == o || strings.HasPrefix(s, o+"/") || strings.HasPrefix(s, o+"?") {
+			return s[len(o):], true
+		}
+	}
+	return s, false
+}
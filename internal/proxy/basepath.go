@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// basePathRoots are the root-relative upstream paths that widget documents and
+// assets reference and that must be moved under the base path.
+var basePathRoots = []string{"/_next/", "/api/", "/themes/", "/favicon.ico"}
+
+// clientOriginRE finds the giscus origin the client script derives from its own
+// src, e.g. `n=new URL(e.src).origin`.
+var clientOriginRE = regexp.MustCompile(`([A-Za-z_$][\w$]*)\s*=\s*new URL\(([\w$.]+)\.src\)\.origin`)
+
+// cleanBasePath normalizes a base path to "/prefix" form; "" and "/" mean none.
+func cleanBasePath(s string) string {
+	s = strings.Trim(strings.TrimSpace(s), "/")
+	if s == "" {
+		return ""
+	}
+	return "/" + s
+}
+
+// BasePath returns the path prefix the proxy is mounted under, or "".
+func (p *Proxy) BasePath() string {
+	return p.basePath
+}
+
+// proxyBase returns the URL visitors use to reach the proxy root: its origin
+// followed by the base path.
+func (p *Proxy) proxyBase(r *http.Request) string {
+	return p.proxyOrigin(r) + p.basePath
+}
+
+// mountBasePath strips the base path from incoming requests. The bare base path
+// redirects to its trailing-slash form and anything outside it is not found.
+func (p *Proxy) mountBasePath(next http.Handler) http.Handler {
+	if p.basePath == "" {
+		return next
+	}
+	strip := http.StripPrefix(p.basePath, next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == p.basePath {
+			target := p.basePath + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, p.basePath+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		strip.ServeHTTP(w, r)
+	})
+}
+
+// basePathReplacers prefixes quoted or url()-wrapped root-relative upstream
+// paths with base. They are literal rules, so widget streaming still applies.
+func basePathReplacers(base string) []replacer {
+	if base == "" {
+		return nil
+	}
+	var reps []replacer
+	for _, root := range basePathRoots {
+		for _, q := range []string{`"`, `'`, "`", "("} {
+			reps = append(reps, replacer{from: q + root, to: q + base + root})
+		}
+	}
+	return reps
+}
+
+// rebaseClient makes the client script build widget URLs under base while still
+// checking message origins against the plain origin.
+func rebaseClient(b []byte, base string) []byte {
+	m := clientOriginRE.FindSubmatch(b)
+	if m == nil {
+		return b
+	}
+	name := string(m[1])
+	b = clientOriginRE.ReplaceAll(b, []byte(`${1}=new URL(${2}.src).origin+`+strings.ReplaceAll(quoteJS(base), "$", "$$")))
+	check := regexp.MustCompile(`\.origin\s*(!==?|===?)\s*` + regexp.QuoteMeta(name) + `\b`)
+	return check.ReplaceAll(b, []byte(`.origin${1}new URL(`+strings.ReplaceAll(name, "$", "$$")+`).origin`))
+}
+
+func quoteJS(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// DefaultBotUserAgents are patterns for common scrapers, SEO crawlers and HTTP
+// libraries that have no business loading a comment widget.
+var DefaultBotUserAgents = []string{
+	`python-requests`, `python-urllib`, `aiohttp`, `scrapy`, `go-http-client`,
+	`okhttp`, `java/`, `libwww-perl`, `wget`, `curl/`, `httpclient`,
+	`headlesschrome`, `phantomjs`, `ahrefsbot`, `semrushbot`, `mj12bot`, `dotbot`,
+	`petalbot`, `bytespider`, `gptbot`, `ccbot`, `claudebot`, `dataforseobot`,
+}
+
+// botFilter rejects requests by User-Agent. Allow patterns are checked first, so
+// legitimate crawlers can be exempted from broad block patterns.
+type botFilter struct {
+	blockEmpty bool
+	allow      []*regexp.Regexp
+	block      []*regexp.Regexp
+}
+
+func (f *botFilter) enabled() bool {
+	return f.blockEmpty || len(f.block) > 0
+}
+
+// blocked reports whether a request with the given User-Agent should be refused.
+func (f *botFilter) blocked(ua string) bool {
+	ua = strings.TrimSpace(ua)
+	if ua == "" {
+		return f.blockEmpty
+	}
+	for _, re := range f.allow {
+		if re.MatchString(ua) {
+			return false
+		}
+	}
+	for _, re := range f.block {
+		if re.MatchString(ua) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileUserAgentPatterns compiles case-insensitive, unanchored patterns,
+// logging and skipping invalid ones.
+func (p *Proxy) compileUserAgentPatterns(kind string, pats []string) []*regexp.Regexp {
+	var out []*regexp.Regexp
+	for _, pat := range pats {
+		if pat = strings.TrimSpace(pat); pat == "" {
+			continue
+		}
+		re, err := regexp.Compile("(?i)" + pat)
+		if err != nil {
+			p.warnf("ignoring invalid %s user agent pattern %q: %v", kind, pat, err)
+			continue
+		}
+		out = append(out, re)
+	}
+	return out
+}
+
+// checkBot rejects filtered user agents with 403.
+func (p *Proxy) checkBot(w http.ResponseWriter, r *http.Request) bool {
+	if !p.bots.enabled() || isWarm(r) || !p.bots.blocked(r.UserAgent()) {
+		return true
+	}
+	p.httpError(w, r, "forbidden", http.StatusForbidden)
+	return false
+}
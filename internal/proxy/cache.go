@@ -1,14 +1,28 @@
 package proxy
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
 )
 
 func (p *Proxy) cacheKey(r *http.Request) string {
-	return r.Method + " " + r.URL.RequestURI() + " ae=" + strings.TrimSpace(r.Header.Get("Accept-Encoding"))
+	key := r.Method + " " + r.URL.RequestURI() + " ae=" + strings.TrimSpace(r.Header.Get("Accept-Encoding"))
+	if p.passthroughTransforms(r) {
+		// Transformed bodies may embed the request host via placeholders.
+		key += " host=" + r.Host
+	}
+	if RequestOptionsFrom(r.Context()).UpstreamOrigin != "" {
+		key += " upstream=" + p.upstreamFor(r)
+	}
+	return key + p.cacheNamespace(r)
 }
 
 func parseMaxAge(h http.Header) (time.Duration, bool) {
@@ -28,3 +42,135 @@ func parseMaxAge(h http.Header) (time.Duration, bool) {
 	}
 	return 0, false
 }
+
+// ErrPurgeUnsupported is returned by Purge when the cache is disabled or can't
+// drop entries.
+var ErrPurgeUnsupported = errors.New("cache does not support purging")
+
+// warmAcceptEncoding is the Accept-Encoding Warm requests with, matching what
+// current browsers send, since it is part of the cache key.
+const warmAcceptEncoding = "gzip, deflate, br, zstd"
+
+// maxWarmError bounds how much of an error answer Warm reports.
+const maxWarmError = 200
+
+// warmKey marks the proxy's own Warm requests, which carry no embedding site or
+// browser User-Agent and skip the checks that rely on them.
+type warmKey struct{}
+
+// isWarm reports whether r was made by Warm.
+func isWarm(r *http.Request) bool {
+	return r.Context().Value(warmKey{}) != nil
+}
+
+// purger is implemented by caches that can drop entries on demand.
+type purger interface {
+	Purge(match func(key string) bool) int
+}
+
+// Cache returns the cache holding upstream responses, or nil when caching is off.
+func (p *Proxy) Cache() cache.Cache {
+	return p.cache
+}
+
+// Purge drops cached responses whose request URI (path and query) starts with
+// one of prefixes, or every response when none are given, and reports how many
+// were removed.
+func (p *Proxy) Purge(prefixes ...string) (int, error) {
+	c, ok := cache.As[purger](p.cache)
+	if !ok {
+		return 0, ErrPurgeUnsupported
+	}
+	n := c.Purge(func(key string) bool {
+		if len(prefixes) == 0 {
+			return true
+		}
+		// Keys look like "GET /client.js?x=1 ae=gzip".
+		_, rest, _ := strings.Cut(key, " ")
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(rest, prefix) {
+				return true
+			}
+		}
+		return false
+	})
+	p.infof("cache purged: entries=%d paths=%v", n, prefixes)
+	return n, nil
+}
+
+// Warm fetches each passthrough path (e.g. "/client.js" or a theme stylesheet)
+// as a visitor would, so the next visitors get it from the cache. Requests use
+// PublicOrigin (or localhost) as their host and a browser's Accept-Encoding,
+// both of which can be part of the cache key; the embedding site and bot checks
+// don't apply to them. Paths that fail or aren't cacheable are each reported in
+// the returned error, with the proxy's answer; the rest are still warmed.
+func (p *Proxy) Warm(ctx context.Context, paths ...string) error {
+	if p.cache == nil {
+		return errors.New("warm: caching is disabled")
+	}
+	ctx = context.WithValue(ctx, warmKey{}, true)
+	origin := p.publicOrigin
+	if origin == "" {
+		origin = "http://localhost"
+	}
+	var errs []error
+	for _, path := range paths {
+		r, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+path, nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("warm %s: %w", path, err))
+			continue
+		}
+		r.Header.Set("Accept-Encoding", warmAcceptEncoding)
+		w := &warmWriter{header: http.Header{}}
+		p.handlePassthrough(w, r)
+		if w.status != http.StatusOK {
+			msg := strings.TrimSpace(w.body.String())
+			if msg == "" {
+				msg = http.StatusText(w.status)
+			}
+			errs = append(errs, fmt.Errorf("warm %s: status %d: %s", path, w.status, msg))
+		} else if _, ok := p.cache.Get(ctx, p.cacheKey(r)); !ok {
+			errs = append(errs, fmt.Errorf("warm %s: response is not cacheable", path))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// warmWriter discards the body of a Warm request, keeping its status and the
+// start of an error answer.
+type warmWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *warmWriter) Header() http.Header { return w.header }
+
+func (w *warmWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *warmWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.status != http.StatusOK && w.body.Len() < maxWarmError {
+		w.body.Write(b[:min(len(b), maxWarmError-w.body.Len())])
+	}
+	return len(b), nil
+}
+
+// handleAdminPurge drops cached responses: all of them, or with ?path= (repeatable)
+// only those whose request URI starts with one of the given prefixes.
+func (p *Proxy) handleAdminPurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n, err := p.Purge(r.URL.Query()["path"]...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"purged": n})
+}
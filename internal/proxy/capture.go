@@ -0,0 +1,220 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cdlus/giscus-proxy/internal/clock"
+	"github.com/cdlus/giscus-proxy/internal/middleware"
+)
+
+const (
+	defaultCaptureDuration = 5 * time.Minute
+	maxCaptureDuration     = time.Hour
+	defaultCaptureSize     = 50
+	maxCaptureSize         = 500
+	// maxCaptureBody bounds the bytes kept per response body; the client still
+	// receives the whole body.
+	maxCaptureBody = 1 << 20
+)
+
+// capture records upstream exchanges into a ring buffer while a capture session,
+// started through the admin API, is running.
+type capture struct {
+	clock   clock.Clock
+	mu      sync.Mutex
+	until   time.Time
+	paths   []string
+	entries []captureEntry
+	next    int
+	total   int
+}
+
+type captureEntry struct {
+	Time            time.Time   `json:"time"`
+	Duration        string      `json:"duration"`
+	RequestID       string      `json:"request_id,omitempty"`
+	Method          string      `json:"method"`
+	URL             string      `json:"url"`
+	RequestHeaders  http.Header `json:"request_headers"`
+	Status          int         `json:"status,omitempty"`
+	ResponseHeaders http.Header `json:"response_headers,omitempty"`
+	Body            string      `json:"body,omitempty"`
+	BodyBinary      []byte      `json:"body_base64,omitempty"`
+	BodyTruncated   bool        `json:"body_truncated,omitempty"`
+	Error           string      `json:"error,omitempty"`
+}
+
+// start begins a new session, discarding earlier entries.
+func (c *capture) start(paths []string, d time.Duration, size int) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.until = c.clock.Now().Add(d)
+	c.paths = paths
+	c.entries = make([]captureEntry, 0, size)
+	c.next, c.total = 0, 0
+	return c.until
+}
+
+// stop ends the session and drops its entries.
+func (c *capture) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.until = time.Time{}
+	c.paths, c.entries = nil, nil
+	c.next, c.total = 0, 0
+}
+
+// matches reports whether an upstream request for path should be recorded now.
+func (c *capture) matches(path string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.clock.Now().Before(c.until) {
+		return false
+	}
+	if len(c.paths) == 0 {
+		return true
+	}
+	for _, prefix := range c.paths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *capture) add(e captureEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cap(c.entries) == 0 {
+		return
+	}
+	c.total++
+	if len(c.entries) < cap(c.entries) {
+		c.entries = append(c.entries, e)
+		return
+	}
+	c.entries[c.next] = e
+	c.next = (c.next + 1) % len(c.entries)
+}
+
+// snapshot returns the session state with entries oldest first.
+func (c *capture) snapshot() map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := make([]captureEntry, 0, len(c.entries))
+	entries = append(entries, c.entries[c.next:]...)
+	entries = append(entries, c.entries[:c.next]...)
+	out := map[string]any{
+		"active":   c.clock.Now().Before(c.until),
+		"paths":    c.paths,
+		"size":     cap(c.entries),
+		"recorded": c.total,
+		"entries":  entries,
+	}
+	if !c.until.IsZero() {
+		out["until"] = c.until
+	}
+	return out
+}
+
+// captureClient records matching upstream exchanges with sensitive headers and
+// query values redacted. Only the first maxCaptureBody bytes of a response are
+// held back; the rest streams through untouched.
+type captureClient struct {
+	HTTPClient
+	p *Proxy
+}
+
+func (c *captureClient) Do(req *http.Request) (*http.Response, error) {
+	if !c.p.capture.matches(req.URL.Path) {
+		return c.HTTPClient.Do(req)
+	}
+	start := c.p.clock.Now()
+	resp, err := c.HTTPClient.Do(req)
+	e := captureEntry{
+		Time:           start.UTC(),
+		Duration:       c.p.clock.Now().Sub(start).String(),
+		RequestID:      middleware.RequestIDFrom(req.Context()),
+		Method:         req.Method,
+		URL:            c.p.redactURL(req.URL.String()),
+		RequestHeaders: c.p.redactHeader(req.Header),
+	}
+	if err != nil {
+		e.Error = err.Error()
+		c.p.capture.add(e)
+		return resp, err
+	}
+	e.Status = resp.StatusCode
+	e.ResponseHeaders = c.p.redactHeader(resp.Header)
+	read, readErr := io.ReadAll(io.LimitReader(resp.Body, maxCaptureBody+1))
+	body := read
+	if len(body) > maxCaptureBody {
+		e.BodyTruncated = true
+		body = body[:maxCaptureBody]
+	}
+	if utf8.Valid(body) {
+		e.Body = string(body)
+	} else {
+		e.BodyBinary = body
+	}
+	if readErr != nil {
+		e.Error = readErr.Error()
+	}
+	c.p.capture.add(e)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(read), resp.Body), resp.Body}
+	return resp, nil
+}
+
+// handleAdminCapture controls capture sessions: POST starts one (?path= prefixes,
+// repeatable; ?duration=, default 5m, at most 1h; ?size= entries kept, default 50),
+// GET returns the recorded exchanges and DELETE stops the session and clears them.
+func (p *Proxy) handleAdminCapture(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, p.capture.snapshot())
+	case http.MethodDelete:
+		p.capture.stop()
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPost:
+		q := r.URL.Query()
+		d := defaultCaptureDuration
+		if v := q.Get("duration"); v != "" {
+			parsed, err := time.ParseDuration(v)
+			if err != nil || parsed <= 0 || parsed > maxCaptureDuration {
+				http.Error(w, "invalid duration (at most 1h)", http.StatusBadRequest)
+				return
+			}
+			d = parsed
+		}
+		size := defaultCaptureSize
+		if v := q.Get("size"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxCaptureSize {
+				http.Error(w, "invalid size (1-500)", http.StatusBadRequest)
+				return
+			}
+			size = n
+		}
+		var paths []string
+		for _, v := range q["path"] {
+			if v = strings.TrimSpace(v); v != "" {
+				paths = append(paths, v)
+			}
+		}
+		until := p.capture.start(paths, d, size)
+		p.warnf("capture started: paths=%v until=%s size=%d", paths, until.UTC().Format(time.RFC3339), size)
+		writeJSON(w, http.StatusOK, p.capture.snapshot())
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,310 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// domRule is a declarative DOM operation of the form "SELECTOR => ACTION [ARGS]".
+//
+// Supported actions:
+//   - remove                 drop matching elements
+//   - set-attr NAME=VALUE    set (or add) an attribute
+//   - remove-attr NAME       delete an attribute
+//   - append HTML            inject HTML as the last child
+//   - prepend HTML           inject HTML as the first child
+type domRule struct {
+	sel    selector
+	action string
+	attr   string
+	value  string
+}
+
+// selector is a chain of compound selectors joined by the descendant combinator.
+type selector []compound
+
+type compound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrMatch
+}
+
+type attrMatch struct {
+	key string
+	op  string
+	val string
+}
+
+func parseDOMRules(vals []string) ([]domRule, error) {
+	if len(vals) == 0 {
+		return nil, nil
+	}
+	var out []domRule
+	for _, raw := range vals {
+		parts := strings.SplitN(raw, "=>", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("bad dom rule %q (use SELECTOR => ACTION)", raw)
+		}
+		sel, err := parseSelector(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("dom rule %q: %w", raw, err)
+		}
+		action, args, _ := strings.Cut(strings.TrimSpace(parts[1]), " ")
+		args = strings.TrimSpace(args)
+		rule := domRule{sel: sel, action: strings.ToLower(action)}
+		switch rule.action {
+		case "remove":
+		case "set-attr":
+			k, v, ok := strings.Cut(args, "=")
+			if !ok || strings.TrimSpace(k) == "" {
+				return nil, fmt.Errorf("dom rule %q: set-attr needs NAME=VALUE", raw)
+			}
+			rule.attr, rule.value = strings.TrimSpace(k), unquote(strings.TrimSpace(v))
+		case "remove-attr":
+			if args == "" {
+				return nil, fmt.Errorf("dom rule %q: remove-attr needs NAME", raw)
+			}
+			rule.attr = args
+		case "append", "prepend":
+			if args == "" {
+				return nil, fmt.Errorf("dom rule %q: %s needs an HTML fragment", raw, rule.action)
+			}
+			rule.value = args
+		default:
+			return nil, fmt.Errorf("dom rule %q: unknown action %q", raw, action)
+		}
+		out = append(out, rule)
+	}
+	return out, nil
+}
+
+func parseSelector(s string) (selector, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty selector")
+	}
+	sel := make(selector, 0, len(fields))
+	for _, f := range fields {
+		c, err := parseCompound(f)
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, c)
+	}
+	return sel, nil
+}
+
+func parseCompound(s string) (compound, error) {
+	var c compound
+	i := strings.IndexAny(s, "#.[")
+	if i == -1 {
+		i = len(s)
+	}
+	c.tag = strings.ToLower(s[:i])
+	if c.tag == "*" {
+		c.tag = ""
+	}
+	s = s[i:]
+	for s != "" {
+		switch s[0] {
+		case '#', '.':
+			end := strings.IndexAny(s[1:], "#.[")
+			if end == -1 {
+				end = len(s) - 1
+			}
+			name := s[1 : end+1]
+			if name == "" {
+				return c, fmt.Errorf("empty name after %q", s[0])
+			}
+			if s[0] == '#' {
+				c.id = name
+			} else {
+				c.classes = append(c.classes, name)
+			}
+			s = s[end+1:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end == -1 {
+				return c, fmt.Errorf("unterminated attribute selector %q", s)
+			}
+			c.attrs = append(c.attrs, parseAttrMatch(s[1:end]))
+			s = s[end+1:]
+		default:
+			return c, fmt.Errorf("unexpected %q in selector", s[0])
+		}
+	}
+	return c, nil
+}
+
+func parseAttrMatch(s string) attrMatch {
+	for _, op := range []string{"^=", "$=", "*=", "="} {
+		if i := strings.Index(s, op); i != -1 {
+			return attrMatch{key: strings.ToLower(strings.TrimSpace(s[:i])), op: op, val: unquote(strings.TrimSpace(s[i+len(op):]))}
+		}
+	}
+	return attrMatch{key: strings.ToLower(strings.TrimSpace(s))}
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func (c compound) match(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if c.tag != "" && n.Data != c.tag {
+		return false
+	}
+	if c.id != "" && attr(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		have := strings.Fields(attr(n, "class"))
+		for _, want := range c.classes {
+			found := false
+			for _, h := range have {
+				if h == want {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		v, ok := lookupAttr(n, a.key)
+		if !ok {
+			return false
+		}
+		switch a.op {
+		case "=":
+			ok = v == a.val
+		case "^=":
+			ok = strings.HasPrefix(v, a.val)
+		case "$=":
+			ok = strings.HasSuffix(v, a.val)
+		case "*=":
+			ok = strings.Contains(v, a.val)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (s selector) match(n *html.Node) bool {
+	if !s[len(s)-1].match(n) {
+		return false
+	}
+	i := len(s) - 2
+	for p := n.Parent; p != nil && i >= 0; p = p.Parent {
+		if s[i].match(p) {
+			i--
+		}
+	}
+	return i < 0
+}
+
+func attr(n *html.Node, key string) string {
+	v, _ := lookupAttr(n, key)
+	return v
+}
+
+func lookupAttr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
+
+func removeAttr(n *html.Node, key string) {
+	out := n.Attr[:0]
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			continue
+		}
+		out = append(out, a)
+	}
+	n.Attr = out
+}
+
+func findAll(root *html.Node, sel selector) []*html.Node {
+	var out []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if sel.match(n) {
+			out = append(out, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return out
+}
+
+// applyDOMRules parses b as an HTML document, applies the rules in order and renders the result.
+func applyDOMRules(b []byte, rules []domRule) ([]byte, error) {
+	if len(rules) == 0 {
+		return b, nil
+	}
+	doc, err := html.Parse(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		for _, n := range findAll(doc, rule.sel) {
+			switch rule.action {
+			case "remove":
+				if n.Parent != nil {
+					n.Parent.RemoveChild(n)
+				}
+			case "set-attr":
+				setAttr(n, rule.attr, rule.value)
+			case "remove-attr":
+				removeAttr(n, rule.attr)
+			case "append", "prepend":
+				nodes, err := html.ParseFragment(strings.NewReader(rule.value), n)
+				if err != nil {
+					return nil, err
+				}
+				first := n.FirstChild
+				for _, c := range nodes {
+					if rule.action == "prepend" && first != nil {
+						n.InsertBefore(c, first)
+					} else {
+						n.AppendChild(c)
+					}
+				}
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
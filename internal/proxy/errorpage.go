@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrorHandler writes the response for a request the proxy can't serve: upstream
+// failures, rejected origins, bad methods and the like. message is the plain-text
+// reason the proxy would otherwise send.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, status int, message string)
+
+// errorRetries is how many times the default error page reloads itself after a
+// temporary failure before leaving it to the visitor.
+const errorRetries = 3
+
+var errorTmpl = template.Must(template.New("error").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Status}} {{.StatusText}}</title>
+<style>
+:root{color-scheme:light dark}
+body{margin:0;padding:1.5rem 1rem;font:14px/1.5 system-ui,sans-serif;text-align:center;color:#57606a}
+p{margin:.25rem 0}
+.msg{font-size:12px;opacity:.8;overflow-wrap:anywhere}
+a{color:#0969da}
+</style>
+</head>
+<body>
+<p><strong>Comments are {{if .Link}}temporarily unavailable{{else}}unavailable right now{{end}}.</strong></p>
+{{if .Link}}<p><a href="{{.Link}}" target="_blank" rel="noopener">View the discussion on GitHub</a></p>
+{{end}}<p class="msg">{{.Status}} {{.StatusText}}{{if .Message}}: {{.Message}}{{end}}</p>
+{{if .Retry}}<p><a href="" id="retry">Try again</a></p>
+<script>
+(function(){
+  var h=document.documentElement.scrollHeight;
+  try{parent.postMessage({giscus:{resizeHeight:h}},"*")}catch(e){}
+  var k="giscus-proxy-retry:"+location.pathname+location.search;
+  var n=+(sessionStorage.getItem(k)||0);
+  if(n>={{.Retries}}){sessionStorage.removeItem(k);return}
+  sessionStorage.setItem(k,n+1);
+  var a=document.getElementById("retry");
+  a.textContent="Retrying in {{.Delay}}s…";
+  setTimeout(function(){location.reload()},{{.Delay}}*1000*(n+1));
+})();
+</script>
+{{end}}</body>
+</html>
+`))
+
+// widgetPageKey marks requests for the widget document, which always get the
+// HTML error page, linking to the discussion on GitHub when upstream fails.
+type widgetPageKey struct{}
+
+// repoRE matches giscus's repo parameter.
+var repoRE = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+// discussionLink returns the GitHub page for the discussion a widget query
+// selects: the discussion itself for a number, a search for a term, or else the
+// repository's discussions.
+func discussionLink(q url.Values) string {
+	repo := q.Get("repo")
+	if !repoRE.MatchString(repo) {
+		return ""
+	}
+	link := "https://github.com/" + repo + "/discussions"
+	if n, err := strconv.Atoi(q.Get("number")); err == nil && n > 0 {
+		return link + "/" + strconv.Itoa(n)
+	}
+	if term := q.Get("term"); term != "" {
+		return link + "?discussions_q=" + url.QueryEscape(term)
+	}
+	return link
+}
+
+// httpError answers r with an error. A configured ErrorHandler decides; otherwise
+// requests for a document, such as the widget iframe, get a minimal HTML page
+// that retries temporary failures, and everything else plain text.
+func (p *Proxy) httpError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	if p.errorHandler != nil {
+		p.errorHandler(w, r, status, message)
+		return
+	}
+	widget := r.Context().Value(widgetPageKey{}) != nil
+	if !widget && !wantsHTML(r) {
+		http.Error(w, message, status)
+		return
+	}
+	delay := 5
+	if s, err := strconv.Atoi(w.Header().Get("Retry-After")); err == nil && s > 0 {
+		delay = s
+	}
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	h.Set("X-Content-Type-Options", "nosniff")
+	retry := status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+	var link string
+	if widget && retry {
+		link = discussionLink(r.URL.Query())
+	}
+	w.WriteHeader(status)
+	_ = errorTmpl.Execute(w, map[string]any{
+		"Status":     status,
+		"StatusText": http.StatusText(status),
+		"Message":    message,
+		"Link":       link,
+		"Retry":      retry,
+		"Retries":    errorRetries,
+		"Delay":      delay,
+	})
+}
+
+// panicResponse answers a request whose handler panicked.
+func (p *Proxy) panicResponse(w http.ResponseWriter, r *http.Request) {
+	p.httpError(w, r, "internal server error", http.StatusInternalServerError)
+}
+
+// wantsHTML reports whether r is a browser navigation or iframe load rather than
+// a script, stylesheet or API call.
+func wantsHTML(r *http.Request) bool {
+	switch r.Header.Get("Sec-Fetch-Dest") {
+	case "document", "iframe", "frame":
+		return true
+	case "":
+		return r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html")
+	}
+	return false
+}
@@ -0,0 +1,337 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+)
+
+const (
+	defaultFeedTTL = 5 * time.Minute
+	// feedSize is the number of comments a feed lists.
+	feedSize = 50
+)
+
+const recentCommentsQuery = `query($owner: String!, $name: String!) {
+  repository(owner: $owner, name: $name) {
+    isPrivate
+    discussions(first: 50, orderBy: {field: UPDATED_AT, direction: DESC}) {
+      nodes {
+        title url category { name }
+        comments(last: 20) {
+          nodes {
+            id url createdAt bodyHTML isMinimized author { login url }
+            replies(last: 20) { nodes { id url createdAt bodyHTML isMinimized author { login url } } }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// feed lists the newest comments of a repository's discussions.
+type feed struct {
+	owner, name string
+	category    string
+	ttl         time.Duration
+}
+
+type feedComment struct {
+	ID          string  `json:"id"`
+	URL         string  `json:"url"`
+	CreatedAt   string  `json:"createdAt"`
+	BodyHTML    string  `json:"bodyHTML"`
+	IsMinimized bool    `json:"isMinimized"`
+	Author      *ghUser `json:"author"`
+	Replies     *struct {
+		Nodes []*feedComment `json:"nodes"`
+	} `json:"replies"`
+}
+
+// feedItem is a comment with the discussion it belongs to.
+type feedItem struct {
+	URL, Title, Author, AuthorURL, HTML string
+	Created                             time.Time
+}
+
+// items fetches the feed's newest comments, newest first.
+func (f *feed) items(ctx context.Context, g *githubDirect, client HTTPClient) ([]feedItem, error) {
+	var data struct {
+		Repository *struct {
+			IsPrivate   bool `json:"isPrivate"`
+			Discussions struct {
+				Nodes []*struct {
+					Title    string `json:"title"`
+					URL      string `json:"url"`
+					Category struct {
+						Name string `json:"name"`
+					} `json:"category"`
+					Comments struct {
+						Nodes []*feedComment `json:"nodes"`
+					} `json:"comments"`
+				} `json:"nodes"`
+			} `json:"discussions"`
+		} `json:"repository"`
+	}
+	vars := map[string]any{"owner": f.owner, "name": f.name}
+	if err := g.query(ctx, client, recentCommentsQuery, vars, &data); err != nil {
+		return nil, err
+	}
+	if data.Repository == nil {
+		return nil, nil
+	}
+	if data.Repository.IsPrivate {
+		return nil, fmt.Errorf("feed repository %s/%s is private", f.owner, f.name)
+	}
+	var items []feedItem
+	add := func(title string, c *feedComment) {
+		if c == nil || c.IsMinimized {
+			return
+		}
+		created, _ := time.Parse(time.RFC3339, c.CreatedAt)
+		author := ghostAuthor
+		if c.Author != nil {
+			author = *c.Author
+		}
+		items = append(items, feedItem{
+			URL: c.URL, Title: author.Login + " on " + title,
+			Author: author.Login, AuthorURL: author.URL, HTML: c.BodyHTML, Created: created,
+		})
+	}
+	for _, d := range data.Repository.Discussions.Nodes {
+		if d == nil || (f.category != "" && !strings.EqualFold(d.Category.Name, f.category)) {
+			continue
+		}
+		for _, c := range d.Comments.Nodes {
+			add(d.Title, c)
+			if c != nil && c.Replies != nil {
+				for _, reply := range c.Replies.Nodes {
+					add(d.Title, reply)
+				}
+			}
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Created.After(items[j].Created) })
+	if len(items) > feedSize {
+		items = items[:feedSize]
+	}
+	return items, nil
+}
+
+// title and link describe the feed itself.
+func (f *feed) title() string {
+	t := "Comments on " + f.owner + "/" + f.name
+	if f.category != "" {
+		t += " (" + f.category + ")"
+	}
+	return t
+}
+
+func (f *feed) link() string {
+	return "https://github.com/" + f.owner + "/" + f.name + "/discussions"
+}
+
+// feedFormats maps the /feed/ routes to their renderers and content types.
+var feedFormats = map[string]struct {
+	contentType string
+	render      func(f *feed, self string, items []feedItem) ([]byte, error)
+}{
+	"rss":  {"application/rss+xml; charset=utf-8", renderRSS},
+	"atom": {"application/atom+xml; charset=utf-8", renderAtom},
+	"json": {"application/feed+json; charset=utf-8", renderJSONFeed},
+}
+
+// handleFeed serves the newest comments of the configured repository as RSS
+// (/feed/rss), Atom (/feed/atom) or JSON Feed (/feed/json), so site owners can
+// follow new comments in a feed reader. Feeds are cached for FeedCacheTTL.
+func (p *Proxy) handleFeed(w http.ResponseWriter, r *http.Request) {
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	cacheState := "BYPASS"
+	var ph phases
+	r, span := p.startSpan(r, "feed")
+	defer func() {
+		p.logLine(r, "feed", sw.status, sw.written, time.Since(start), cacheState, p.github.endpoint)
+		p.logSlow(r, "feed", sw.status, time.Since(start), &ph)
+		p.endSpan(span, sw.status, cacheState, p.github.endpoint)
+	}()
+	w = sw
+
+	format, ok := feedFormats[strings.TrimPrefix(r.URL.Path, "/feed/")]
+	if !ok {
+		p.httpError(w, r, "404 page not found", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		p.httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	maxAge := "public, max-age=" + strconv.Itoa(int(p.feed.ttl.Seconds()))
+	// Feeds link to themselves.
+	key := "feed " + r.URL.Path + " host=" + r.Host
+	if p.cacheable(r) {
+		if ent, ok := p.cache.Get(r.Context(), key); ok {
+			cacheState = "HIT"
+			writeMirrored(w, r, ent.Status, ent.Headers, maxAge, ent.Body)
+			return
+		}
+	}
+
+	ph.begin()
+	items, err := p.feed.items(r.Context(), p.github, p.client)
+	ph.end(&ph.upstream)
+	if err != nil {
+		p.upstreamError(w, r, err)
+		return
+	}
+	ph.begin()
+	body, err := format.render(p.feed, p.proxyBase(r)+r.URL.Path, items)
+	ph.end(&ph.transform)
+	if err != nil {
+		p.reportError(r, "feed render", err)
+		p.httpError(w, r, "failed to render feed", http.StatusInternalServerError)
+		return
+	}
+	h := http.Header{"Content-Type": {format.contentType}}
+	writeMirrored(w, r, http.StatusOK, h, maxAge, body)
+	if p.cacheable(r) {
+		p.cache.Set(r.Context(), key, cache.Entry{Status: http.StatusOK, Headers: h, Body: body, Expires: p.clock.Now().Add(p.feed.ttl)})
+		cacheState = "MISS:cached"
+	}
+}
+
+func renderRSS(f *feed, self string, items []feedItem) ([]byte, error) {
+	type guid struct {
+		IsPermaLink bool   `xml:"isPermaLink,attr"`
+		Value       string `xml:",chardata"`
+	}
+	type item struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		GUID        guid   `xml:"guid"`
+		Author      string `xml:"dc:creator"`
+		PubDate     string `xml:"pubDate"`
+		Description string `xml:"description"`
+	}
+	type atomLink struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Type string `xml:"type,attr"`
+	}
+	doc := struct {
+		XMLName xml.Name `xml:"rss"`
+		Version string   `xml:"version,attr"`
+		Atom    string   `xml:"xmlns:atom,attr"`
+		DC      string   `xml:"xmlns:dc,attr"`
+		Channel struct {
+			Title       string   `xml:"title"`
+			Link        string   `xml:"link"`
+			Self        atomLink `xml:"atom:link"`
+			Description string   `xml:"description"`
+			Items       []item   `xml:"item"`
+		} `xml:"channel"`
+	}{Version: "2.0", Atom: "http://www.w3.org/2005/Atom", DC: "http://purl.org/dc/elements/1.1/"}
+	doc.Channel.Title = f.title()
+	doc.Channel.Link = f.link()
+	doc.Channel.Self = atomLink{Href: self, Rel: "self", Type: "application/rss+xml"}
+	doc.Channel.Description = "Newest comments on " + f.owner + "/" + f.name + " discussions"
+	for _, it := range items {
+		doc.Channel.Items = append(doc.Channel.Items, item{
+			Title: it.Title, Link: it.URL, GUID: guid{IsPermaLink: true, Value: it.URL}, Author: it.Author,
+			PubDate: it.Created.UTC().Format(time.RFC1123Z), Description: it.HTML,
+		})
+	}
+	return marshalXML(doc)
+}
+
+func renderAtom(f *feed, self string, items []feedItem) ([]byte, error) {
+	type link struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr,omitempty"`
+	}
+	type author struct {
+		Name string `xml:"name"`
+		URI  string `xml:"uri,omitempty"`
+	}
+	type content struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	}
+	type entry struct {
+		Title   string  `xml:"title"`
+		ID      string  `xml:"id"`
+		Link    link    `xml:"link"`
+		Updated string  `xml:"updated"`
+		Author  author  `xml:"author"`
+		Content content `xml:"content"`
+	}
+	doc := struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Title   string   `xml:"title"`
+		ID      string   `xml:"id"`
+		Links   []link   `xml:"link"`
+		Updated string   `xml:"updated"`
+		Entries []entry  `xml:"entry"`
+	}{
+		Title: f.title(),
+		ID:    self,
+		Links: []link{{Href: self, Rel: "self"}, {Href: f.link(), Rel: "alternate"}},
+	}
+	updated := time.Unix(0, 0)
+	for _, it := range items {
+		if it.Created.After(updated) {
+			updated = it.Created
+		}
+		doc.Entries = append(doc.Entries, entry{
+			Title: it.Title, ID: it.URL, Link: link{Href: it.URL}, Updated: it.Created.UTC().Format(time.RFC3339),
+			Author: author{Name: it.Author, URI: it.AuthorURL}, Content: content{Type: "html", Value: it.HTML},
+		})
+	}
+	doc.Updated = updated.UTC().Format(time.RFC3339)
+	return marshalXML(doc)
+}
+
+func renderJSONFeed(f *feed, self string, items []feedItem) ([]byte, error) {
+	type author struct {
+		Name string `json:"name"`
+		URL  string `json:"url,omitempty"`
+	}
+	type item struct {
+		ID            string   `json:"id"`
+		URL           string   `json:"url"`
+		Title         string   `json:"title"`
+		ContentHTML   string   `json:"content_html"`
+		DatePublished string   `json:"date_published"`
+		Authors       []author `json:"authors"`
+	}
+	out := struct {
+		Version     string `json:"version"`
+		Title       string `json:"title"`
+		HomePageURL string `json:"home_page_url"`
+		FeedURL     string `json:"feed_url"`
+		Items       []item `json:"items"`
+	}{Version: "https://jsonfeed.org/version/1.1", Title: f.title(), HomePageURL: f.link(), FeedURL: self, Items: []item{}}
+	for _, it := range items {
+		out.Items = append(out.Items, item{
+			ID: it.URL, URL: it.URL, Title: it.Title, ContentHTML: it.HTML,
+			DatePublished: it.Created.UTC().Format(time.RFC3339), Authors: []author{{Name: it.Author, URL: it.AuthorURL}},
+		})
+	}
+	return json.MarshalIndent(out, "", "  ")
+}
+
+func marshalXML(v any) ([]byte, error) {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+)
+
+// noteHeader carries advice alongside generated configuration.
+const noteHeader = "X-Giscus-Proxy-Note"
+
+// giscusConfig is the origin part of a repository's giscus.json.
+type giscusConfig struct {
+	Origins      []string `json:"origins"`
+	OriginsRegex []string `json:"originsRegex,omitempty"`
+}
+
+// giscusOrigins turns the sites the proxy lets embed the widget (AllowedSites,
+// AllowedOrigins and tenants' Sites) into giscus.json origins: exact origins
+// as they are, patterns without a scheme or with a wildcard as regexes. It
+// reports false when a "*" pattern, or no pattern at all, leaves every site
+// allowed.
+func (p *Proxy) giscusOrigins() (giscusConfig, bool) {
+	pats := append(append([]originPattern(nil), p.allowedSites...), p.allowedOrigins...)
+	for _, t := range p.tenants {
+		pats = append(pats, t.sites...)
+	}
+	if p.preview && p.publicOrigin != "" {
+		// The preview page embeds the widget from the proxy's own origin.
+		pats = append(pats, parseOriginPatterns([]string{p.publicOrigin})...)
+	}
+	origins, regexes := map[string]bool{}, map[string]bool{}
+	restricted := len(pats) > 0
+	for _, pat := range pats {
+		switch {
+		case pat.any:
+			restricted = false
+		case pat.scheme != "" && !pat.wildcard:
+			origins[pat.scheme+"://"+pat.host] = true
+		default:
+			scheme := "https?"
+			if pat.scheme != "" {
+				scheme = regexp.QuoteMeta(pat.scheme)
+			}
+			host := regexp.QuoteMeta(pat.host)
+			if pat.wildcard {
+				host = `[^/]+\.` + host
+			}
+			regexes["^"+scheme+"://"+host+"$"] = true
+		}
+	}
+	cfg := giscusConfig{Origins: sortedKeys(origins), OriginsRegex: sortedKeys(regexes)}
+	return cfg, restricted
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// handleAdminGiscusJSON serves the origins section of a giscus.json matching the
+// proxy's allowlists, to commit to the discussions repository so giscus.app
+// refuses the same sites the proxy does.
+func (p *Proxy) handleAdminGiscusJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cfg, restricted := p.giscusOrigins()
+	if !restricted {
+		w.Header().Set(noteHeader, "no ALLOWED_SITES or ALLOWED_ORIGINS restrict embedding; giscus will accept any site")
+		cfg = giscusConfig{Origins: []string{}}
+	}
+	writeJSON(w, http.StatusOK, cfg)
+}
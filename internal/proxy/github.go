@@ -0,0 +1,433 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+)
+
+// DefaultGitHubGraphQLURL is GitHub's GraphQL endpoint used by direct mode.
+const DefaultGitHubGraphQLURL = "https://api.github.com/graphql"
+
+const (
+	defaultDirectTTL = time.Minute
+	// maxGraphQLResponse bounds GitHub responses read by direct mode.
+	maxGraphQLResponse = 8 << 20
+)
+
+// ghostAuthor stands in for deleted GitHub accounts, as on github.com.
+var ghostAuthor = ghUser{AvatarURL: "https://avatars.githubusercontent.com/u/10137?v=4", Login: "ghost", URL: "https://github.com/ghost"}
+
+// discussionFields selects what giscus renders. Viewer-specific fields are left
+// out: they would describe the operator's token, not the visitor.
+const discussionFields = `
+fragment reactions on Reactable {
+  reactionGroups { content users { totalCount } }
+}
+fragment comment on Comment {
+  id url createdAt lastEditedAt deletedAt isMinimized bodyHTML authorAssociation
+  author { avatarUrl login url }
+  ...reactions
+}
+fragment discussion on Discussion {
+  id url locked title body
+  repository { nameWithOwner isPrivate }
+  reactions { totalCount }
+  ...reactions
+  comments(first: $first, last: $last, after: $after, before: $before) {
+    totalCount
+    pageInfo { startCursor hasNextPage hasPreviousPage endCursor }
+    nodes {
+      ...comment
+      upvoteCount
+      replies(last: 100) { totalCount nodes { ...comment replyTo { id } } }
+    }
+  }
+}`
+
+const searchDiscussionsQuery = `query($query: String!, $first: Int, $last: Int, $after: String, $before: String) {
+  search(type: DISCUSSION, first: 20, query: $query) { nodes { ...discussion } }
+}` + discussionFields
+
+const discussionByNumberQuery = `query($owner: String!, $name: String!, $number: Int!, $first: Int, $last: Int, $after: String, $before: String) {
+  repository(owner: $owner, name: $name) { discussion(number: $number) { ...discussion } }
+}` + discussionFields
+
+// githubDirect renders discussions from GitHub's GraphQL API with an operator
+// token, so comment display doesn't depend on giscus.app.
+type githubDirect struct {
+	token    string
+	endpoint string
+	ttl      time.Duration
+	// repos, when set, are the lowercased OWNER/NAME repositories it may read.
+	repos []string
+}
+
+// repoAllowed reports whether direct mode may read discussions of repo.
+func (g *githubDirect) repoAllowed(repo string) bool {
+	return len(g.repos) == 0 || slices.Contains(g.repos, strings.ToLower(repo))
+}
+
+// directRequest reports whether r is a read-only discussions request direct mode
+// answers. Signed-in visitors keep going upstream so their reactions and
+// permissions are right.
+func (p *Proxy) directRequest(r *http.Request) bool {
+	return p.github != nil && r.URL.Path == "/api/discussions" && r.Header.Get("Authorization") == "" &&
+		(r.Method == http.MethodGet || r.Method == http.MethodHead)
+}
+
+// handleDiscussions answers read-only discussions requests from GitHub in direct
+// mode and sends the rest to the /api/ handler.
+func (p *Proxy) handleDiscussions(w http.ResponseWriter, r *http.Request) {
+	if !p.checkRepo(w, r) {
+		return
+	}
+	if !p.directRequest(r) {
+		if p.authProxy {
+			p.handleAPI(w, r)
+		} else {
+			p.handlePassthrough(w, r)
+		}
+		return
+	}
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	cacheState := "BYPASS"
+	var ph phases
+	r, span := p.startSpan(r, "github")
+	defer func() {
+		p.logLine(r, "github", sw.status, sw.written, time.Since(start), cacheState, p.github.endpoint)
+		p.logSlow(r, "github", sw.status, time.Since(start), &ph)
+		p.endSpan(span, sw.status, cacheState, p.github.endpoint)
+	}()
+	w = sw
+
+	if !p.checkOrigin(w, r) || !p.checkSite(w, r) || !p.checkBot(w, r) {
+		return
+	}
+	if !p.passthroughPaths.allowed(r.URL.Path) {
+		p.httpError(w, r, "404 page not found", http.StatusNotFound)
+		return
+	}
+	p.writeCORS(w, r)
+	key := "github " + r.URL.RawQuery + p.cacheNamespace(r)
+	if p.cacheable(r) {
+		if ent, ok := p.cache.Get(r.Context(), key); ok {
+			cacheState = "HIT"
+			writeDirect(w, r, ent.Status, p.rewriteMirrors(r, "application/json", ent.Body))
+			return
+		}
+	}
+
+	ph.begin()
+	status, body, err := p.github.discussion(r.Context(), p.client, r.URL.Query())
+	ph.end(&ph.upstream)
+	if err != nil {
+		p.upstreamError(w, r, err)
+		return
+	}
+	writeDirect(w, r, status, p.rewriteMirrors(r, "application/json", body))
+	// Errors, including a discussion not created yet, aren't kept for the TTL.
+	if p.cacheable(r) && status == http.StatusOK {
+		ttl := p.github.ttl
+		if d := RequestOptionsFrom(r.Context()).CacheTTL; d > 0 {
+			ttl = d
+		}
+		p.cache.Set(r.Context(), key, cache.Entry{Status: status, Headers: http.Header{"Content-Type": {"application/json"}}, Body: body, Expires: p.clock.Now().Add(ttl)})
+		cacheState = "MISS:cached"
+	}
+}
+
+func writeDirect(w http.ResponseWriter, r *http.Request, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
+
+// discussion looks up the discussion selected by giscus's query parameters (repo,
+// term or number, category, strict, and first/last/after/before for comment
+// pagination) and returns the response giscus's own /api/discussions would send.
+func (g *githubDirect) discussion(ctx context.Context, client HTTPClient, q url.Values) (int, []byte, error) {
+	get := func(k string) string { return strings.TrimSpace(q.Get(k)) }
+	repo := get("repo")
+	owner, name, _ := strings.Cut(repo, "/")
+	if !repoRE.MatchString(repo) {
+		return directError(http.StatusBadRequest, "repo must be OWNER/NAME")
+	}
+	if !g.repoAllowed(repo) {
+		return directError(http.StatusForbidden, "repository not allowed")
+	}
+	vars := map[string]any{}
+	for _, k := range []string{"first", "last"} {
+		if v := get(k); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 100 {
+				return directError(http.StatusBadRequest, k+" must be between 1 and 100")
+			}
+			vars[k] = n
+		}
+	}
+	if vars["first"] == nil && vars["last"] == nil {
+		vars["first"] = 20
+	}
+	for _, k := range []string{"after", "before"} {
+		if v := get(k); v != "" {
+			vars[k] = v
+		}
+	}
+
+	var d *ghDiscussion
+	if number := get("number"); number != "" {
+		n, err := strconv.Atoi(number)
+		if err != nil || n < 1 {
+			return directError(http.StatusBadRequest, "number must be a positive integer")
+		}
+		vars["owner"], vars["name"], vars["number"] = owner, name, n
+		var data struct {
+			Repository *struct {
+				Discussion *ghDiscussion `json:"discussion"`
+			} `json:"repository"`
+		}
+		if err := g.query(ctx, client, discussionByNumberQuery, vars, &data); err != nil {
+			return 0, nil, err
+		}
+		if data.Repository != nil {
+			d = data.Repository.Discussion
+		}
+	} else {
+		term := get("term")
+		if term == "" {
+			return directError(http.StatusBadRequest, "term or number is required")
+		}
+		strict := get("strict") == "true" || get("strict") == "1"
+		sum := sha1.Sum([]byte(term))
+		hash := hex.EncodeToString(sum[:])
+		search := "repo:" + repo
+		if category := get("category"); category != "" {
+			search += " category:" + strconv.Quote(category)
+		}
+		if strict {
+			search += " in:body " + hash
+		} else {
+			search += " in:title " + strconv.Quote(term)
+		}
+		vars["query"] = search
+		var data struct {
+			Search struct {
+				Nodes []*ghDiscussion `json:"nodes"`
+			} `json:"search"`
+		}
+		if err := g.query(ctx, client, searchDiscussionsQuery, vars, &data); err != nil {
+			return 0, nil, err
+		}
+		// Search is fuzzy; giscus only accepts an exact title or hash match.
+		for _, n := range data.Search.Nodes {
+			if n != nil && ((!strict && n.Title == term) || (strict && strings.Contains(n.Body, hash))) {
+				d = n
+				break
+			}
+		}
+	}
+	// The operator's token may reach private repositories; their discussions
+	// mustn't be published through the proxy.
+	if d == nil || d.Repository.IsPrivate || !strings.EqualFold(d.Repository.NameWithOwner, repo) {
+		return directError(http.StatusNotFound, "Discussion not found")
+	}
+	body, err := json.Marshal(map[string]any{"discussion": d.giscus()})
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, body, nil
+}
+
+func directError(status int, msg string) (int, []byte, error) {
+	body, _ := json.Marshal(map[string]string{"error": msg})
+	return status, body, nil
+}
+
+// query runs a GraphQL query and decodes its data into out.
+func (g *githubDirect) query(ctx context.Context, client HTTPClient, query string, vars map[string]any, out any) error {
+	payload, err := json.Marshal(map[string]any{"query": query, "variables": vars})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+g.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxGraphQLResponse))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("github graphql: status %d", resp.StatusCode)
+	}
+	var res struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return fmt.Errorf("github graphql: %w", err)
+	}
+	if len(res.Errors) > 0 {
+		return errors.New("github graphql: " + res.Errors[0].Message)
+	}
+	return json.Unmarshal(res.Data, out)
+}
+
+type ghUser struct {
+	AvatarURL string `json:"avatarUrl"`
+	Login     string `json:"login"`
+	URL       string `json:"url"`
+}
+
+type ghReactionGroup struct {
+	Content string `json:"content"`
+	Users   struct {
+		TotalCount int `json:"totalCount"`
+	} `json:"users"`
+}
+
+type ghComment struct {
+	ID                string            `json:"id"`
+	URL               string            `json:"url"`
+	CreatedAt         string            `json:"createdAt"`
+	LastEditedAt      *string           `json:"lastEditedAt"`
+	DeletedAt         *string           `json:"deletedAt"`
+	IsMinimized       bool              `json:"isMinimized"`
+	BodyHTML          string            `json:"bodyHTML"`
+	AuthorAssociation string            `json:"authorAssociation"`
+	Author            *ghUser           `json:"author"`
+	ReactionGroups    []ghReactionGroup `json:"reactionGroups"`
+	UpvoteCount       int               `json:"upvoteCount"`
+	ReplyTo           *struct {
+		ID string `json:"id"`
+	} `json:"replyTo"`
+	Replies *struct {
+		TotalCount int          `json:"totalCount"`
+		Nodes      []*ghComment `json:"nodes"`
+	} `json:"replies"`
+}
+
+type ghDiscussion struct {
+	ID         string `json:"id"`
+	URL        string `json:"url"`
+	Locked     bool   `json:"locked"`
+	Title      string `json:"title"`
+	Body       string `json:"body"`
+	Repository struct {
+		NameWithOwner string `json:"nameWithOwner"`
+		IsPrivate     bool   `json:"isPrivate"`
+	} `json:"repository"`
+	Reactions struct {
+		TotalCount int `json:"totalCount"`
+	} `json:"reactions"`
+	ReactionGroups []ghReactionGroup `json:"reactionGroups"`
+	Comments       struct {
+		TotalCount int            `json:"totalCount"`
+		PageInfo   map[string]any `json:"pageInfo"`
+		Nodes      []*ghComment   `json:"nodes"`
+	} `json:"comments"`
+}
+
+// giscus converts the discussion to the shape giscus's widget expects, with every
+// viewer field false since the visitor isn't signed in.
+func (d *ghDiscussion) giscus() map[string]any {
+	comments := make([]map[string]any, 0, len(d.Comments.Nodes))
+	replies := 0
+	for _, c := range d.Comments.Nodes {
+		if c == nil {
+			continue
+		}
+		out := c.giscus()
+		var rs []map[string]any
+		if c.Replies != nil {
+			replies += c.Replies.TotalCount
+			out["replyCount"] = c.Replies.TotalCount
+			for _, reply := range c.Replies.Nodes {
+				if reply != nil {
+					rs = append(rs, reply.giscus())
+				}
+			}
+		}
+		out["replies"] = append(make([]map[string]any, 0, len(rs)), rs...)
+		out["upvoteCount"] = c.UpvoteCount
+		out["viewerHasUpvoted"] = false
+		out["viewerCanUpvote"] = false
+		comments = append(comments, out)
+	}
+	return map[string]any{
+		"id":                d.ID,
+		"url":               d.URL,
+		"locked":            d.Locked,
+		"repository":        map[string]string{"nameWithOwner": d.Repository.NameWithOwner},
+		"reactionCount":     d.Reactions.TotalCount,
+		"totalCommentCount": d.Comments.TotalCount,
+		"totalReplyCount":   replies,
+		"reactions":         reactionMap(d.ReactionGroups),
+		"comments":          comments,
+		"pageInfo":          d.Comments.PageInfo,
+	}
+}
+
+func (c *ghComment) giscus() map[string]any {
+	author := ghostAuthor
+	if c.Author != nil {
+		author = *c.Author
+	}
+	count := 0
+	for _, g := range c.ReactionGroups {
+		count += g.Users.TotalCount
+	}
+	out := map[string]any{
+		"id":                c.ID,
+		"author":            author,
+		"viewerDidAuthor":   false,
+		"createdAt":         c.CreatedAt,
+		"url":               c.URL,
+		"authorAssociation": c.AuthorAssociation,
+		"lastEditedAt":      c.LastEditedAt,
+		"deletedAt":         c.DeletedAt,
+		"isMinimized":       c.IsMinimized,
+		"bodyHTML":          c.BodyHTML,
+		"reactionCount":     count,
+		"reactions":         reactionMap(c.ReactionGroups),
+	}
+	if c.ReplyTo != nil {
+		out["replyToId"] = c.ReplyTo.ID
+	}
+	return out
+}
+
+func reactionMap(groups []ghReactionGroup) map[string]any {
+	out := make(map[string]any, len(groups))
+	for _, g := range groups {
+		out[g.Content] = map[string]any{"count": g.Users.TotalCount, "viewerHasReacted": false}
+	}
+	return out
+}
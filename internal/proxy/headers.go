@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DefaultForwardHeaders lists the only client headers forwarded upstream unless
+// configured otherwise: giscus needs the type of the bodies the sign-in flow and
+// comment posts send, and nothing else about the visitor.
+var DefaultForwardHeaders = []string{"Content-Type"}
+
+// DefaultStripHeaders is a starting point for Config.StripHeaders: credentials,
+// the visitor's addresses and the tracking headers added by CDNs and hosting
+// platforms. Entries ending in "*" match by prefix.
+var DefaultStripHeaders = []string{
+	"Authorization",
+	"Proxy-Authorization",
+	"Cookie",
+	"Referer",
+	"Origin",
+	"Forwarded",
+	"Via",
+	"X-Forwarded-*",
+	"X-Real-Ip",
+	"True-Client-Ip",
+	"X-Client-Data",
+	"Cf-*",
+	"X-Vercel-*",
+	"X-Amzn-*",
+	"X-Cloud-Trace-Context",
+	"Traceparent",
+	"Tracestate",
+}
+
+// hopHeaders are never forwarded: they describe the client connection, or the proxy
+// sets them itself.
+var hopHeaders = map[string]bool{
+	"Connection":        true,
+	"Proxy-Connection":  true,
+	"Keep-Alive":        true,
+	"Te":                true,
+	"Trailer":           true,
+	"Transfer-Encoding": true,
+	"Upgrade":           true,
+	"Host":              true,
+	"Content-Length":    true,
+	"Accept-Encoding":   true,
+}
+
+// headerPolicy decides which client request headers are copied to upstream
+// requests. A non-empty allow list forwards only the named headers; otherwise
+// everything except strip is forwarded.
+type headerPolicy struct {
+	allow []string
+	strip []string
+}
+
+// newHeaderPolicy forwards the allow list when one is given, else everything
+// but a given strip list, else DefaultForwardHeaders.
+func newHeaderPolicy(allow, strip []string) headerPolicy {
+	if allow = cleanHeaderNames(allow); len(allow) > 0 {
+		return headerPolicy{allow: allow}
+	}
+	if strip = cleanHeaderNames(strip); len(strip) > 0 {
+		return headerPolicy{strip: strip}
+	}
+	return headerPolicy{allow: cleanHeaderNames(DefaultForwardHeaders)}
+}
+
+func cleanHeaderNames(vals []string) []string {
+	var out []string
+	for _, v := range vals {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, http.CanonicalHeaderKey(v))
+		}
+	}
+	return out
+}
+
+func matchHeaderName(pattern, name string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(name, prefix)
+	}
+	return pattern == name
+}
+
+func matchHeaderNames(patterns []string, name string) bool {
+	for _, pat := range patterns {
+		if matchHeaderName(pat, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// forward copies the permitted headers from src into dst.
+func (hp headerPolicy) forward(dst, src http.Header) {
+	conn := map[string]bool{}
+	for _, v := range src.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			conn[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+		}
+	}
+	for k, vs := range src {
+		k = http.CanonicalHeaderKey(k)
+		if hopHeaders[k] || conn[k] {
+			continue
+		}
+		if len(hp.allow) > 0 {
+			if !matchHeaderNames(hp.allow, k) {
+				continue
+			}
+		} else if matchHeaderNames(hp.strip, k) {
+			continue
+		}
+		dst[k] = append([]string(nil), vs...)
+	}
+}
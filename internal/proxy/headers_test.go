@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// visitorHeaders is what a browser behind a CDN typically sends.
+func visitorHeaders() http.Header {
+	return http.Header{
+		"Accept":            {"text/html"},
+		"Accept-Encoding":   {"gzip, br"},
+		"Accept-Language":   {"en"},
+		"Authorization":     {"Bearer token"},
+		"Cf-Connecting-Ip":  {"203.0.113.7"},
+		"Connection":        {"keep-alive, X-Hop"},
+		"Content-Length":    {"2"},
+		"Content-Type":      {"application/json"},
+		"Cookie":            {"session=1"},
+		"Host":              {"proxy.test"},
+		"Referer":           {"https://blog.test/post"},
+		"Traceparent":       {"00-abc-def-01"},
+		"Transfer-Encoding": {"chunked"},
+		"X-Forwarded-For":   {"203.0.113.7"},
+		"X-Hop":             {"1"},
+		"X-Requested-With":  {"XMLHttpRequest"},
+	}
+}
+
+func TestHeaderPolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		allow, strip []string
+		want         []string
+	}{
+		{"default", nil, nil, []string{"Content-Type"}},
+		{"allow list", []string{"accept", " accept-language ", ""}, nil, []string{"Accept", "Accept-Language"}},
+		{"allow prefix", []string{"Accept*"}, nil, []string{"Accept", "Accept-Language"}},
+		{"allow beats strip", []string{"Content-Type"}, []string{"Accept"}, []string{"Content-Type"}},
+		{"allow never forwards hop headers", []string{"Connection", "Host", "X-Hop", "Accept-Encoding"}, nil, nil},
+		{"strip", []string{" "}, []string{"cookie", "authorization"}, []string{
+			"Accept", "Accept-Language", "Cf-Connecting-Ip", "Content-Type", "Referer",
+			"Traceparent", "X-Forwarded-For", "X-Requested-With",
+		}},
+		{"default strip list", nil, DefaultStripHeaders, []string{
+			"Accept", "Accept-Language", "Content-Type", "X-Requested-With",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := http.Header{}
+			newHeaderPolicy(tt.allow, tt.strip).forward(dst, visitorHeaders())
+			var got []string
+			for k := range dst {
+				got = append(got, k)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("forwarded %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardCopiesValues(t *testing.T) {
+	src := http.Header{"Accept": {"text/html", "application/json"}}
+	dst := http.Header{}
+	newHeaderPolicy([]string{"Accept"}, nil).forward(dst, src)
+	src["Accept"][0] = "changed"
+	if got := dst.Values("Accept"); !slices.Equal(got, []string{"text/html", "application/json"}) {
+		t.Errorf("Accept = %q, want both values, unaffected by later changes", got)
+	}
+}
+
+func TestUpstreamRequestHeaders(t *testing.T) {
+	var got http.Header
+	p := newTestProxy(t, Config{}, func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+	})
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		creds   bool
+		want    map[string]string
+		missing []string
+	}{
+		{"passthrough", http.MethodGet, "/api/discussions?repo=o/r", false, map[string]string{
+			"Content-Type": "application/json",
+			"User-Agent":   userAgent,
+		}, []string{"Cookie", "Referer", "X-Forwarded-For", "Cf-Connecting-Ip", "Accept-Language", "X-Hop"}},
+		{"auth", http.MethodPost, "/api/discussions?repo=o/r", true, map[string]string{
+			"Content-Type":  "application/json",
+			"User-Agent":    userAgent,
+			"Authorization": "Bearer token",
+			"Cookie":        "session=upstream",
+		}, []string{"Referer", "X-Forwarded-For", "Cf-Connecting-Ip", "Accept-Language", "X-Hop"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = nil
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader("{}"))
+			for k, vs := range visitorHeaders() {
+				if k != "Host" && k != "Content-Length" && k != "Transfer-Encoding" {
+					r.Header[k] = vs
+				}
+			}
+			r.Header.Add("Cookie", upstreamCookiePrefix+"session=upstream")
+			if !tt.creds {
+				// A GET with credentials would go through the auth handler.
+				r.Header.Del("Authorization")
+			}
+			rec := serve(p, r)
+			if rec.Code != http.StatusOK || got == nil {
+				t.Fatalf("status = %d, upstream reached: %v", rec.Code, got != nil)
+			}
+			for k, v := range tt.want {
+				if got.Get(k) != v {
+					t.Errorf("%s = %q, want %q", k, got.Get(k), v)
+				}
+			}
+			for _, k := range tt.missing {
+				if v := got.Values(k); len(v) > 0 {
+					t.Errorf("%s forwarded: %q", k, v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+)
+
+// readyTTL is how long a readiness result is reused, so frequent probes don't turn
+// into upstream traffic.
+const readyTTL = 15 * time.Second
+
+const readyCacheKey = "giscus-proxy:readyz"
+
+// readiness memoizes the last readiness check.
+type readiness struct {
+	mu      sync.Mutex
+	checked time.Time
+	checks  map[string]string
+	ok      bool
+}
+
+// handleHealth reports that the process is alive. It never contacts upstream.
+func (p *Proxy) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReady reports whether the proxy can serve traffic: upstream answers within
+// the readiness timeout and the cache stores and returns entries. It fails as soon
+// as the proxy starts draining.
+func (p *Proxy) handleReady(w http.ResponseWriter, r *http.Request) {
+	if p.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "draining"})
+		return
+	}
+	checks, ok := p.ready(r.Context())
+	status, code := "ok", http.StatusOK
+	if !ok {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]any{"status": status, "checks": checks})
+}
+
+// handleAdminDrain lets a preStop hook take the instance out of rotation ahead of
+// SIGTERM: POST starts draining, DELETE undoes it and GET reports the state.
+// Requests keep being served either way; only /readyz changes.
+func (p *Proxy) handleAdminDrain(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if !p.draining.Swap(true) {
+			p.warnf("draining requested through the admin API")
+		}
+	case http.MethodDelete:
+		if p.draining.Swap(false) {
+			p.warnf("draining cancelled through the admin API")
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"draining": p.draining.Load()})
+}
+
+func (p *Proxy) ready(ctx context.Context) (map[string]string, bool) {
+	p.readiness.mu.Lock()
+	defer p.readiness.mu.Unlock()
+	if p.clock.Now().Sub(p.readiness.checked) < readyTTL {
+		return p.readiness.checks, p.readiness.ok
+	}
+	checks, ok := p.Check(ctx)
+	p.readiness.checked, p.readiness.checks, p.readiness.ok = p.clock.Now(), checks, ok
+	return checks, ok
+}
+
+// Check runs the readiness checks now, without the memoization /readyz applies:
+// upstream must answer within the readiness timeout and the cache must store and
+// return entries. It returns each check's result ("ok" or the failure) and
+// whether all passed.
+func (p *Proxy) Check(ctx context.Context) (map[string]string, bool) {
+	checks := map[string]string{"upstream": "ok", "cache": "ok"}
+	ok := true
+	if err := p.checkUpstream(ctx); err != nil {
+		checks["upstream"], ok = err.Error(), false
+	}
+	if p.cache == nil {
+		checks["cache"] = "disabled"
+	} else if err := p.checkCache(ctx); err != nil {
+		checks["cache"], ok = err.Error(), false
+	}
+	return checks, ok
+}
+
+func (p *Proxy) checkUpstream(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.readyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, p.upstreamOrigin+"/client.js", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := p.client.Do(req)
+	if errors.Is(err, errUpstreamBudget) {
+		// Out of budget says nothing about upstream health.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("upstream status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (p *Proxy) checkCache(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.readyTimeout)
+	defer cancel()
+	stamp := p.clock.Now()
+	p.cache.Set(ctx, readyCacheKey, cache.Entry{Status: http.StatusOK, Expires: stamp.Add(readyTTL * 2)})
+	ent, ok := p.cache.Get(ctx, readyCacheKey)
+	if !ok || !ent.Expires.Equal(stamp.Add(readyTTL*2)) {
+		return errors.New("cache did not return a stored entry")
+	}
+	return nil
+}
+
+// healthBypass serves the health endpoints ahead of the rest of the middleware, so
+// probes aren't rate limited, filtered or shed.
+func (p *Proxy) healthBypass(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			p.handleHealth(w, r)
+		case "/readyz":
+			p.handleReady(w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
@@ -1,14 +1,16 @@
 package proxy
 
 import (
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
 	"net/http"
-	"net/url"
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/middleware"
 )
 
 type statusWriter struct {
@@ -28,6 +30,12 @@ func (w *statusWriter) Write(p []byte) (int, error) {
 	return n, err
 }
 
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
 func fmtDur(d time.Duration) string {
 	if d < time.Second {
 		return fmt.Sprintf("%4dms", d.Milliseconds())
@@ -36,29 +44,58 @@ func fmtDur(d time.Duration) string {
 	return fmt.Sprintf("%6.2fs", sec)
 }
 
-func (p *Proxy) logLine(kind, method, path string, status, bytes int, dur time.Duration, cacheState, target string) {
+func (p *Proxy) logLine(r *http.Request, kind string, status, bytes int, dur time.Duration, cacheState, target string) {
+	p.observeRequest(kind, status, bytes, dur, cacheState)
+	if p.stats != nil {
+		p.stats.observe(p.clock.Now(), r.URL.Path, status, bytes, cacheState)
+	}
 	if cacheState == "" {
 		cacheState = "-"
 	}
-	p.logf("%-6s method=%-4s status=%3d bytes=%8d dur=%9s cache=%-10s path=%s target=%s",
-		kind, method, status, bytes, fmtDur(dur), cacheState, path, target)
-}
-
-func writeCORS(h http.ResponseWriter) {
-	h.Header().Set("Access-Control-Allow-Origin", "*")
-	h.Header().Set("Vary", "Origin")
-	h.Header().Set("Access-Control-Allow-Methods", "GET,HEAD,OPTIONS")
-	h.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization,Accept")
+	id := middleware.RequestIDFrom(r.Context())
+	if id == "" {
+		id = "-"
+	}
+	p.infof("%-6s method=%-4s status=%3d bytes=%8d dur=%9s cache=%-10s path=%s target=%s id=%s",
+		kind, r.Method, status, bytes, fmtDur(dur), cacheState, p.redactURL(r.URL.RequestURI()), p.redactURL(target), id)
 }
 
 func copyIf(dst, src http.Header, keys ...string) {
 	for _, k := range keys {
 		if v := src.Get(k); v != "" {
-			dst.Set(k, v)
+			mergeHeader(dst, k, v)
 		}
 	}
 }
 
+// mergeHeader sets k to v, except for Vary which is appended so that the
+// Origin entry added for CORS survives.
+func mergeHeader(dst http.Header, k, v string) {
+	if http.CanonicalHeaderKey(k) == "Vary" {
+		dst.Add(k, v)
+		return
+	}
+	dst.Set(k, v)
+}
+
+func isHTML(contentType string) bool {
+	return mediaType(contentType) == "text/html"
+}
+
+// textType reports whether a passthrough response of this content type is a
+// document or script that may reference other upstream URLs: HTML, CSS, JSON or
+// JavaScript.
+func textType(contentType string) bool {
+	mt := mediaType(contentType)
+	return mt == "text/html" || mt == "text/css" || mt == "application/json" || strings.HasSuffix(mt, "javascript")
+}
+
+// mediaType returns the lower-cased media type of a Content-Type value without parameters.
+func mediaType(contentType string) string {
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mt))
+}
+
 func decompressIfNeeded(h http.Header, body io.ReadCloser) (io.ReadCloser, func(), error) {
 	enc := strings.ToLower(strings.TrimSpace(h.Get("Content-Encoding")))
 	switch enc {
@@ -80,10 +117,15 @@ type replacer struct {
 	from     string
 	fromRE   *regexp.Regexp
 	to       string
+	// untrusted marks regex rules supplied by visitors, which are subject to input size caps.
+	untrusted bool
 }
 
-func parseReplacers(q url.Values) ([]replacer, error) {
-	vals := q["rep"]
+func parseReplacers(vals []string) ([]replacer, error) {
+	return parseReplacersWith(vals, regexp.Compile)
+}
+
+func parseReplacersWith(vals []string, compile func(string) (*regexp.Regexp, error)) ([]replacer, error) {
 	if len(vals) == 0 {
 		return nil, nil
 	}
@@ -96,7 +138,7 @@ func parseReplacers(q url.Values) ([]replacer, error) {
 		left, right := parts[0], parts[1]
 		if strings.HasPrefix(left, "re:") {
 			pat := left[len("re:"):]
-			re, err := regexp.Compile(pat)
+			re, err := compile(pat)
 			if err != nil {
 				return nil, fmt.Errorf("regex compile failed for %q: %w", pat, err)
 			}
@@ -108,25 +150,95 @@ func parseReplacers(q url.Values) ([]replacer, error) {
 	return out, nil
 }
 
+// applyReplacements applies reps to b in order. Each rule that matches writes
+// its result to a pooled scratch buffer that is then copied into a single
+// output buffer, so a body costs one allocation however many rules change it.
+// b itself is never modified, and is returned as is when nothing matches.
 func applyReplacements(b []byte, reps []replacer) []byte {
 	if len(reps) == 0 {
 		return b
 	}
-	s := string(b)
+	var out []byte
+	scratch := getBuffer()
+	defer putBuffer(scratch)
+	src := b
 	for _, r := range reps {
+		var ok bool
+		scratch.Reset()
 		if r.useRegex {
-			s = r.fromRE.ReplaceAllString(s, r.to)
+			ok = replaceRegex(scratch, src, r.fromRE, r.to)
+		} else {
+			ok = replaceLiteral(scratch, src, r.from, r.to)
+		}
+		if !ok {
+			continue
+		}
+		if out == nil {
+			out = make([]byte, 0, scratch.Len()+scratch.Len()/8)
+		}
+		out = append(out[:0], scratch.Bytes()...)
+		src = out
+	}
+	return src
+}
+
+// replaceLiteral writes src to dst with every from replaced by to, reporting
+// whether there was anything to replace; dst is untouched when there wasn't.
+func replaceLiteral(dst *bytes.Buffer, src []byte, from, to string) bool {
+	if from == "" {
+		return false
+	}
+	i := bytes.Index(src, []byte(from))
+	if i < 0 {
+		return false
+	}
+	dst.Grow(len(src))
+	for i >= 0 {
+		dst.Write(src[:i])
+		dst.WriteString(to)
+		src = src[i+len(from):]
+		i = bytes.Index(src, []byte(from))
+	}
+	dst.Write(src)
+	return true
+}
+
+// replaceRegex is replaceLiteral for a regexp, expanding $ references in to as
+// regexp.ReplaceAll does.
+func replaceRegex(dst *bytes.Buffer, src []byte, re *regexp.Regexp, to string) bool {
+	expand := strings.Contains(to, "$")
+	var matches [][]int
+	if expand {
+		matches = re.FindAllSubmatchIndex(src, -1)
+	} else {
+		matches = re.FindAllIndex(src, -1)
+	}
+	if len(matches) == 0 {
+		return false
+	}
+	dst.Grow(len(src))
+	var tpl []byte
+	if expand {
+		tpl = []byte(to)
+	}
+	var tmp []byte
+	last := 0
+	for _, m := range matches {
+		dst.Write(src[last:m[0]])
+		if expand {
+			tmp = re.Expand(tmp[:0], tpl, src, m)
+			dst.Write(tmp)
 		} else {
-			s = strings.ReplaceAll(s, r.from, r.to)
+			dst.WriteString(to)
 		}
+		last = m[1]
 	}
-	return []byte(s)
+	dst.Write(src[last:])
+	return true
 }
 
-func widgetFooterSwap(b []byte) []byte {
-	s := string(b)
-	s = strings.ReplaceAll(s, "– powered by \\u003ca\\u003egiscus\\u003c/a\\u003e", "")
-	s = strings.ReplaceAll(s, "– powered by <a>giscus</a>", "")
-	s = strings.ReplaceAll(s, "- powered by <a>giscus</a>", "")
-	return []byte(s)
+var footerReplacers = []replacer{
+	{from: "– powered by \\u003ca\\u003egiscus\\u003c/a\\u003e"},
+	{from: "– powered by <a>giscus</a>"},
+	{from: "- powered by <a>giscus</a>"},
 }
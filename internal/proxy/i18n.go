@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"encoding/json"
+	"html"
+	"sort"
+	"strings"
+)
+
+// stringOverrideReplacers turns a visible-string override map into literal replacers.
+// Besides the plain text, the HTML- and JSON-escaped spellings of each key are
+// covered so overrides also hit entity-encoded markup and __NEXT_DATA__/JS strings.
+// Longer keys are applied first so "Sign in with GitHub" wins over "GitHub".
+func stringOverrideReplacers(overrides map[string]string) []replacer {
+	keys := make([]string, 0, len(overrides))
+	for k := range overrides {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	var out []replacer
+	for _, k := range keys {
+		v := overrides[k]
+		out = append(out, replacer{from: k, to: v})
+		if ek := html.EscapeString(k); ek != k {
+			out = append(out, replacer{from: ek, to: html.EscapeString(v)})
+		}
+		if jk := jsonEscape(k); jk != k {
+			out = append(out, replacer{from: jk, to: jsonEscape(v)})
+		}
+	}
+	return out
+}
+
+// jsonEscape returns s as it appears inside a JSON string literal, without the quotes.
+func jsonEscape(s string) string {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return s
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(string(b), `"`), `"`)
+}
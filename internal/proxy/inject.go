@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Snippet placements understood by Snippet.Position.
+const (
+	PositionHeadStart = "head-start"
+	PositionHead      = "head"
+	PositionBodyStart = "body-start"
+	PositionBodyEnd   = "body-end"
+)
+
+// Snippet is an HTML fragment injected into every widget document.
+type Snippet struct {
+	HTML string
+	// Position is one of PositionHeadStart, PositionHead, PositionBodyStart or
+	// PositionBodyEnd (the default).
+	Position string
+}
+
+var (
+	headOpenRE  = regexp.MustCompile(`(?i)<head\b[^>]*>`)
+	headCloseRE = regexp.MustCompile(`(?i)</head\s*>`)
+	bodyOpenRE  = regexp.MustCompile(`(?i)<body\b[^>]*>`)
+	bodyCloseRE = regexp.MustCompile(`(?i)</body\s*>`)
+)
+
+func normalizeSnippets(in []Snippet) ([]Snippet, error) {
+	var out []Snippet
+	for _, s := range in {
+		if strings.TrimSpace(s.HTML) == "" {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(s.Position)) {
+		case "", PositionBodyEnd:
+			s.Position = PositionBodyEnd
+		case PositionHeadStart:
+			s.Position = PositionHeadStart
+		case PositionHead:
+			s.Position = PositionHead
+		case PositionBodyStart:
+			s.Position = PositionBodyStart
+		default:
+			return nil, fmt.Errorf("unknown snippet position %q (use head-start, head, body-start or body-end)", s.Position)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func injectSnippets(b []byte, snippets []Snippet) []byte {
+	for _, s := range snippets {
+		b = injectAt(b, s.Position, s.HTML)
+	}
+	return b
+}
+
+func injectAt(b []byte, pos, frag string) []byte {
+	at := -1
+	switch pos {
+	case PositionHeadStart:
+		if loc := headOpenRE.FindIndex(b); loc != nil {
+			at = loc[1]
+		} else if loc := bodyOpenRE.FindIndex(b); loc != nil {
+			at = loc[1]
+		}
+	case PositionHead:
+		if loc := headCloseRE.FindIndex(b); loc != nil {
+			at = loc[0]
+		} else if loc := bodyOpenRE.FindIndex(b); loc != nil {
+			at = loc[1]
+		}
+	case PositionBodyStart:
+		if loc := bodyOpenRE.FindIndex(b); loc != nil {
+			at = loc[1]
+		}
+	default:
+		if locs := bodyCloseRE.FindAllIndex(b, -1); len(locs) > 0 {
+			at = locs[len(locs)-1][0]
+		}
+	}
+	if at == -1 {
+		at = len(b)
+	}
+	out := make([]byte, 0, len(b)+len(frag))
+	out = append(out, b[:at]...)
+	out = append(out, frag...)
+	return append(out, b[at:]...)
+}
+
+// metaSnippet builds the <base> and <meta> tags requested in cfg, or an empty snippet.
+func metaSnippet(cfg Config) Snippet {
+	var b strings.Builder
+	if cfg.BaseHref != "" {
+		b.WriteString(`<base href="` + html.EscapeString(cfg.BaseHref) + `">`)
+	}
+	if cfg.RobotsMeta != "" {
+		b.WriteString(`<meta name="robots" content="` + html.EscapeString(cfg.RobotsMeta) + `">`)
+	}
+	if cfg.ReferrerPolicy != "" {
+		b.WriteString(`<meta name="referrer" content="` + html.EscapeString(cfg.ReferrerPolicy) + `">`)
+	}
+	return Snippet{HTML: b.String(), Position: PositionHeadStart}
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+)
+
+// lazyScript loads the giscus client next to it once the comments container
+// comes within data-lazy-margin (default 200px) of the viewport. Every other
+// data-* attribute is handed to the client, so an embed switches to lazy
+// loading by pointing its script tag at /lazy.js instead of /client.js. The
+// container is data-lazy-target (a CSS selector), else the page's .giscus
+// element, else the script tag's parent.
+const lazyScript = `(function () {
+  var s = document.currentScript;
+  if (!s) return;
+  var src = new URL(s.src);
+  src.pathname = src.pathname.replace(/lazy\.js$/, "client.js");
+  src.search = "";
+  var sel = s.getAttribute("data-lazy-target");
+  var box = (sel && document.querySelector(sel)) || document.querySelector(".giscus") || s.parentNode;
+  function load() {
+    var c = document.createElement("script");
+    c.src = src.href;
+    c.async = true;
+    c.crossOrigin = "anonymous";
+    for (var i = 0; i < s.attributes.length; i++) {
+      var a = s.attributes[i];
+      if (a.name.indexOf("data-") === 0 && a.name.indexOf("data-lazy-") !== 0) c.setAttribute(a.name, a.value);
+    }
+    if (box === s.parentNode) s.parentNode.insertBefore(c, s.nextSibling);
+    else box.appendChild(c);
+  }
+  if (!("IntersectionObserver" in window) || !box || !box.getBoundingClientRect) return load();
+  var io = new IntersectionObserver(function (entries) {
+    for (var i = 0; i < entries.length; i++) {
+      if (entries[i].isIntersecting) {
+        io.disconnect();
+        return load();
+      }
+    }
+  }, { rootMargin: s.getAttribute("data-lazy-margin") || "200px" });
+  io.observe(box);
+})();
+`
+
+// handleLazy serves the lazy-loading shim for the giscus client.
+func (p *Proxy) handleLazy(w http.ResponseWriter, r *http.Request) {
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	defer func() {
+		p.logLine(r, "lazy", sw.status, sw.written, time.Since(start), "", "")
+	}()
+	w = sw
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		p.httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	p.writeCORS(w, r)
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write([]byte(lazyScript))
+	}
+}
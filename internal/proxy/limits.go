@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+)
+
+// Limits applied to replacement rules supplied through the rep query parameter.
+const (
+	maxQueryReplacers  = 16
+	maxQueryPatternLen = 256
+	maxQueryRegexInsts = 2048
+	maxQueryRegexInput = 4 << 20
+)
+
+// parseQueryReplacers parses visitor-supplied rep values, enforcing count, length and
+// complexity limits. Identical patterns within one request are compiled only once.
+func parseQueryReplacers(vals []string) ([]replacer, error) {
+	if len(vals) > maxQueryReplacers {
+		return nil, fmt.Errorf("too many rep values (max %d)", maxQueryReplacers)
+	}
+	compiled := make(map[string]*regexp.Regexp)
+	reps, err := parseReplacersWith(vals, func(pat string) (*regexp.Regexp, error) {
+		if re, ok := compiled[pat]; ok {
+			return re, nil
+		}
+		if len(pat) > maxQueryPatternLen {
+			return nil, fmt.Errorf("pattern longer than %d bytes", maxQueryPatternLen)
+		}
+		if err := checkRegexComplexity(pat); err != nil {
+			return nil, err
+		}
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			return nil, err
+		}
+		compiled[pat] = re
+		return re, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range reps {
+		reps[i].untrusted = reps[i].useRegex
+	}
+	return reps, nil
+}
+
+// checkRegexComplexity rejects patterns whose compiled program is too large,
+// which catches deeply nested or heavily repeated expressions.
+func checkRegexComplexity(pat string) error {
+	re, err := syntax.Parse(pat, syntax.Perl)
+	if err != nil {
+		return err
+	}
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		return err
+	}
+	if len(prog.Inst) > maxQueryRegexInsts {
+		return fmt.Errorf("pattern too complex (%d instructions, max %d)", len(prog.Inst), maxQueryRegexInsts)
+	}
+	return nil
+}
+
+// capUntrustedRegex drops visitor-supplied regex rules when the body exceeds the input cap.
+func capUntrustedRegex(reps []replacer, size int) ([]replacer, bool) {
+	if size <= maxQueryRegexInput {
+		return reps, false
+	}
+	out := make([]replacer, 0, len(reps))
+	dropped := false
+	for _, r := range reps {
+		if r.untrusted {
+			dropped = true
+			continue
+		}
+		out = append(out, r)
+	}
+	return out, dropped
+}
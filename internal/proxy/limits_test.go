@@ -0,0 +1,134 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseQueryReplacersLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		vals    []string
+		wantErr string
+	}{
+		{"literal", []string{"giscus=>proxy"}, ""},
+		{"regex", []string{`re:\bgiscus\b=>proxy`}, ""},
+		{"max rules", slices.Repeat([]string{"a=>b"}, maxQueryReplacers), ""},
+		{"too many rules", slices.Repeat([]string{"a=>b"}, maxQueryReplacers+1), "too many rep values"},
+		{"max pattern length", []string{"re:" + strings.Repeat("a", maxQueryPatternLen) + "=>b"}, ""},
+		{"pattern too long", []string{"re:" + strings.Repeat("a", maxQueryPatternLen+1) + "=>b"}, "pattern longer than"},
+		{"long literal", []string{strings.Repeat("a", maxQueryPatternLen+1) + "=>b"}, ""},
+		{"too complex", []string{"re:(?:abc){1000}=>x"}, "pattern too complex"},
+		{"alternation too complex", []string{"re:(?:x|yz){1000}=>x"}, "pattern too complex"},
+		{"repeated regex", []string{"re:(?:ab){500}=>x"}, ""},
+		{"invalid", []string{"re:(=>x"}, "regex compile failed"},
+		{"missing arrow", []string{"giscus"}, "bad rep value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reps, err := parseQueryReplacers(tt.vals)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("parseQueryReplacers: %v", err)
+				}
+				if len(reps) != len(tt.vals) {
+					t.Fatalf("got %d rules, want %d", len(reps), len(tt.vals))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseQueryReplacers error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseQueryReplacersUntrusted(t *testing.T) {
+	reps, err := parseQueryReplacers([]string{"giscus=>proxy", "re:a+=>b", "re:a+=>c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{false, true, true} {
+		if reps[i].untrusted != want {
+			t.Errorf("rule %d untrusted = %v, want %v", i, reps[i].untrusted, want)
+		}
+	}
+	if reps[1].fromRE != reps[2].fromRE {
+		t.Error("identical patterns were compiled twice")
+	}
+
+	// Rules from the configuration are never capped.
+	reps, err = parseReplacers([]string{"re:(?:abc){1000}=>x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reps[0].untrusted {
+		t.Error("configured regex rule marked untrusted")
+	}
+}
+
+func TestCapUntrustedRegex(t *testing.T) {
+	configured, err := parseReplacers([]string{"re:a+=>b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := parseQueryReplacers([]string{"giscus=>proxy", "re:c+=>d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reps := append(configured, query...)
+
+	got, dropped := capUntrustedRegex(reps, maxQueryRegexInput)
+	if dropped || len(got) != 3 {
+		t.Fatalf("at the cap: %d rules, dropped %v; want 3, false", len(got), dropped)
+	}
+	got, dropped = capUntrustedRegex(reps, maxQueryRegexInput+1)
+	if !dropped || len(got) != 2 {
+		t.Fatalf("over the cap: %d rules, dropped %v; want 2, true", len(got), dropped)
+	}
+	for _, r := range got {
+		if r.untrusted {
+			t.Errorf("untrusted rule %v kept over the cap", r.fromRE)
+		}
+	}
+	if out := string(applyReplacements([]byte("aa giscus zz"), got)); out != "b proxy zz" {
+		t.Errorf("applyReplacements = %q, want %q", out, "b proxy zz")
+	}
+}
+
+func TestWidgetQueryReplacerLimits(t *testing.T) {
+	var body string
+	p := newTestProxy(t, Config{Replacements: []string{"re:a+=>b"}}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = io.WriteString(w, body)
+	})
+	get := func(query string) *httptest.ResponseRecorder {
+		return serve(p, httptest.NewRequest(http.MethodGet, "/widget?repo=o/r&"+query, nil))
+	}
+
+	body = "aa giscus zz"
+	if rec := get("rep=re:z%2B=>d"); rec.Code != http.StatusOK || rec.Body.String() != "b giscus d" {
+		t.Errorf("small body: %d %q, want 200 %q", rec.Code, rec.Body.String(), "b giscus d")
+	}
+	if rec := get("rep=re:(?:abc){1000}=>x"); rec.Code != http.StatusBadRequest {
+		t.Errorf("complex pattern: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := get(strings.Repeat("rep=a=>b&", maxQueryReplacers+1)); rec.Code != http.StatusBadRequest {
+		t.Errorf("too many rules: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	// Over the input cap the visitor's regex is skipped; the configured regex
+	// and literal rules still apply.
+	body = "aa giscus zz" + strings.Repeat(" ", maxQueryRegexInput)
+	rec := get("rep=re:z%2B=>d&rep=giscus=>proxy")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("large body: status %d", rec.Code)
+	}
+	if got := strings.TrimRight(rec.Body.String(), " "); got != "b proxy zz" {
+		t.Errorf("large body = %q, want %q", got, "b proxy zz")
+	}
+}
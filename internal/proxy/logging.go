@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// logLevel orders log verbosity; messages below the configured level are dropped.
+// The zero value is info.
+type logLevel int
+
+const (
+	levelDebug logLevel = iota - 1
+	levelInfo
+	levelWarn
+	levelError
+)
+
+func parseLogLevel(s string) (logLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return levelDebug, nil
+	case "", "info":
+		return levelInfo, nil
+	case "warn", "warning":
+		return levelWarn, nil
+	case "error":
+		return levelError, nil
+	}
+	return levelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// logf writes a line regardless of level; used for the audit trail.
+func (p *Proxy) logf(format string, args ...any) {
+	if p.logger == nil {
+		log.Printf(format, args...)
+		return
+	}
+	p.logger.Printf(format, args...)
+}
+
+// infof logs per-request lines.
+func (p *Proxy) infof(format string, args ...any) {
+	if p.logLevel <= levelInfo {
+		p.logf(format, args...)
+	}
+}
+
+// debugf logs troubleshooting detail such as cache decisions and upstream headers.
+func (p *Proxy) debugf(format string, args ...any) {
+	if p.logLevel <= levelDebug {
+		p.logf("debug  "+format, args...)
+	}
+}
+
+// warnf logs ignored configuration and degraded behavior.
+func (p *Proxy) warnf(format string, args ...any) {
+	if p.logLevel <= levelWarn {
+		p.logf("warn   "+format, args...)
+	}
+}
+
+// errorf logs failures while serving a request.
+func (p *Proxy) errorf(format string, args ...any) {
+	if p.logLevel <= levelError {
+		p.logf("error  "+format, args...)
+	}
+}
+
+// debugUpstream dumps an upstream exchange's headers, with sensitive values redacted.
+func (p *Proxy) debugUpstream(req *http.Request, resp *http.Response) {
+	if p.logLevel > levelDebug {
+		return
+	}
+	p.debugf("upstream %s %s status=%d request_headers=%v response_headers=%v",
+		req.Method, p.redactURL(req.URL.String()), resp.StatusCode, p.redactHeader(req.Header), p.redactHeader(resp.Header))
+}
+
+// redactHeader returns a copy of h with sensitive header values masked.
+func (p *Proxy) redactHeader(h http.Header) http.Header {
+	out := h.Clone()
+	for k, vs := range out {
+		if p.redact[strings.ToLower(k)] {
+			for i := range vs {
+				vs[i] = redacted
+			}
+		}
+	}
+	return out
+}
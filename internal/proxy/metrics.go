@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+	"github.com/cdlus/giscus-proxy/internal/metrics"
+)
+
+// MetricsRecorder receives the proxy's measurements. The Prometheus endpoint,
+// StatsD, expvar and the periodic summary are all recorders; set
+// Config.MetricsRecorder to feed another telemetry backend.
+type MetricsRecorder interface {
+	// ObserveRequest records a finished widget, preview or passthrough request.
+	ObserveRequest(route string, status, bytes int, d time.Duration)
+	// ObserveUpstream records an upstream request by status code, "error" when
+	// it failed.
+	ObserveUpstream(code string, d time.Duration)
+	// ObserveCache records a cache lookup: "hit" or "miss".
+	ObserveCache(result string)
+}
+
+// ErrorRecorder is implemented by recorders that also count errors by kind:
+// upstream, upstream_budget, upstream_vetoed or response (5xx).
+type ErrorRecorder interface {
+	ObserveError(kind string)
+}
+
+// NopRecorder discards every measurement. It is the default recorder.
+type NopRecorder struct{}
+
+func (NopRecorder) ObserveRequest(string, int, int, time.Duration) {}
+func (NopRecorder) ObserveUpstream(string, time.Duration)          {}
+func (NopRecorder) ObserveCache(string)                            {}
+
+// recorders fans measurements out to every configured recorder.
+type recorders []MetricsRecorder
+
+func (rs recorders) ObserveRequest(route string, status, bytes int, d time.Duration) {
+	for _, r := range rs {
+		r.ObserveRequest(route, status, bytes, d)
+	}
+}
+
+func (rs recorders) ObserveUpstream(code string, d time.Duration) {
+	for _, r := range rs {
+		r.ObserveUpstream(code, d)
+	}
+}
+
+func (rs recorders) ObserveCache(result string) {
+	for _, r := range rs {
+		r.ObserveCache(result)
+	}
+}
+
+func (rs recorders) ObserveError(kind string) {
+	for _, r := range rs {
+		if er, ok := r.(ErrorRecorder); ok {
+			er.ObserveError(kind)
+		}
+	}
+}
+
+// PrometheusRecorder is a MetricsRecorder exposing its measurements in the
+// Prometheus text format. Config.Metrics serves the proxy's own at MetricsPath;
+// embedders can also create one and mount Handler wherever they like.
+type PrometheusRecorder struct {
+	registry *metrics.Registry
+	requests *metrics.Counter
+	duration *metrics.Histogram
+	upstream *metrics.Histogram
+	cache    *metrics.Counter
+	errors   *metrics.Counter
+}
+
+// NewPrometheusRecorder creates a recorder with the giscus_proxy_* metrics.
+func NewPrometheusRecorder() *PrometheusRecorder {
+	reg := metrics.NewRegistry()
+	return &PrometheusRecorder{
+		registry: reg,
+		requests: reg.Counter("giscus_proxy_requests_total", "Requests handled, by route and status code.", "route", "code"),
+		duration: reg.Histogram("giscus_proxy_request_duration_seconds", "Request latency by route.", nil, "route"),
+		upstream: reg.Histogram("giscus_proxy_upstream_duration_seconds", "Upstream request latency by status code (\"error\" for failed requests).", nil, "code"),
+		cache:    reg.Counter("giscus_proxy_cache_requests_total", "Cache lookups by result.", "result"),
+		errors:   reg.Counter("giscus_proxy_errors_total", "Errors by kind: upstream, upstream_budget, upstream_vetoed or response (5xx).", "kind"),
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *PrometheusRecorder) Handler() http.Handler {
+	return m.registry.Handler()
+}
+
+func (m *PrometheusRecorder) ObserveRequest(route string, status, _ int, d time.Duration) {
+	m.requests.Inc(route, strconv.Itoa(status))
+	m.duration.Observe(d.Seconds(), route)
+}
+
+func (m *PrometheusRecorder) ObserveUpstream(code string, d time.Duration) {
+	m.upstream.Observe(d.Seconds(), code)
+}
+
+func (m *PrometheusRecorder) ObserveCache(result string) {
+	m.cache.Inc(result)
+}
+
+func (m *PrometheusRecorder) ObserveError(kind string) {
+	m.errors.Inc(kind)
+}
+
+// instrument adds gauges for the proxy's in-flight requests and, when the cache
+// counts them, its evictions.
+func (m *PrometheusRecorder) instrument(c cache.Cache, inFlight *atomic.Int64) {
+	m.registry.GaugeFunc("giscus_proxy_in_flight_requests", "Requests currently being handled.", func() float64 {
+		return float64(inFlight.Load())
+	})
+	if ev, ok := cache.As[interface{ Evictions() uint64 }](c); ok {
+		m.registry.CounterFunc("giscus_proxy_cache_evictions_total", "Cache entries evicted to make room.", func() float64 {
+			return float64(ev.Evictions())
+		})
+	}
+}
+
+// observeRequest records a finished request from the values it is logged with.
+func (p *Proxy) observeRequest(route string, status, bytes int, d time.Duration, cacheState string) {
+	p.recorder.ObserveRequest(route, status, bytes, d)
+	switch cacheState {
+	case "HIT":
+		p.recorder.ObserveCache("hit")
+	case "MISS", "MISS:cached":
+		p.recorder.ObserveCache("miss")
+	}
+	if status >= 500 {
+		p.countError("response")
+	}
+}
+
+// track counts h's requests as in flight while they run.
+func (p *Proxy) track(h http.HandlerFunc) http.HandlerFunc {
+	if p.metrics == nil && p.vars == nil {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		p.active.Add(1)
+		defer p.active.Add(-1)
+		h(w, r)
+	}
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// minifiers maps supported media types to conservative, dependency-free minifiers.
+// JavaScript is deliberately absent: giscus ships pre-minified bundles, and a safe JS
+// minifier needs a full tokenizer.
+var minifiers = map[string]func([]byte) []byte{
+	"text/html": minifyHTML,
+	"text/css":  minifyCSS,
+}
+
+func normalizeMinify(types []string) ([]string, error) {
+	var out []string
+	for _, t := range types {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" {
+			continue
+		}
+		if _, ok := minifiers[t]; !ok {
+			return nil, fmt.Errorf("no minifier for %q (supported: text/html, text/css)", t)
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+// minifyType reports whether bodies of this content type are minified.
+func (p *Proxy) minifyType(contentType string) bool {
+	mt := mediaType(contentType)
+	for _, t := range p.minify {
+		if t == mt {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Proxy) minifyBody(contentType string, b []byte) []byte {
+	if !p.minifyType(contentType) {
+		return b
+	}
+	return minifiers[mediaType(contentType)](b)
+}
+
+var rawTextElements = []string{"script", "style", "pre", "textarea"}
+
+// minifyHTML drops comments (except conditional ones) and collapses whitespace runs
+// in text, leaving attribute values and raw text elements untouched.
+func minifyHTML(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case bytes.HasPrefix(b[i:], []byte("<!--")) && !bytes.HasPrefix(b[i:], []byte("<!--[if")):
+			end := bytes.Index(b[i+4:], []byte("-->"))
+			if end == -1 {
+				return append(out, b[i:]...)
+			}
+			i += 4 + end + 3
+		case c == '<' && i+1 < len(b) && (isASCIILetter(b[i+1]) || b[i+1] == '/' || b[i+1] == '!'):
+			end := tagEnd(b, i)
+			tag := b[i:end]
+			out = append(out, tag...)
+			i = end
+			if name := rawTextName(tag); name != "" {
+				closeAt := indexFold(b[i:], "</"+name)
+				if closeAt == -1 {
+					return append(out, b[i:]...)
+				}
+				out = append(out, b[i:i+closeAt]...)
+				i += closeAt
+			}
+		case isSpace(c):
+			j := i
+			for j < len(b) && isSpace(b[j]) {
+				j++
+			}
+			if len(out) == 0 || out[len(out)-1] != ' ' {
+				out = append(out, ' ')
+			}
+			i = j
+		default:
+			out = append(out, c)
+			i++
+		}
+	}
+	return out
+}
+
+// tagEnd returns the index just past the '>' closing the tag that starts at i,
+// honoring quoted attribute values.
+func tagEnd(b []byte, i int) int {
+	var quote byte
+	for j := i + 1; j < len(b); j++ {
+		switch c := b[j]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return j + 1
+		}
+	}
+	return len(b)
+}
+
+func rawTextName(tag []byte) string {
+	if len(tag) < 2 || tag[1] == '/' {
+		return ""
+	}
+	for _, name := range rawTextElements {
+		if len(tag) > len(name)+1 && bytes.EqualFold(tag[1:1+len(name)], []byte(name)) {
+			if next := tag[1+len(name)]; isSpace(next) || next == '>' || next == '/' {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func indexFold(b []byte, s string) int {
+	n := len(s)
+	for i := 0; i+n <= len(b); i++ {
+		if bytes.EqualFold(b[i:i+n], []byte(s)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// minifyCSS removes comments and collapses whitespace, trimming it around
+// punctuation where that can't change meaning. Strings are copied verbatim.
+func minifyCSS(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == '/' && i+1 < len(b) && b[i+1] == '*':
+			end := bytes.Index(b[i+2:], []byte("*/"))
+			if end == -1 {
+				return out
+			}
+			i += 2 + end + 2
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(b) && b[j] != c {
+				if b[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(b) {
+				return append(out, b[i:]...)
+			}
+			out = append(out, b[i:j+1]...)
+			i = j + 1
+		case isSpace(c):
+			for i < len(b) && isSpace(b[i]) {
+				i++
+			}
+			if len(out) == 0 || i == len(b) || strings.IndexByte("{};,>", out[len(out)-1]) != -1 || strings.IndexByte("{};,>", b[i]) != -1 {
+				continue
+			}
+			out = append(out, ' ')
+		case c == '}' && len(out) > 0 && out[len(out)-1] == ';':
+			out[len(out)-1] = '}'
+			i++
+		default:
+			out = append(out, c)
+			i++
+		}
+	}
+	return out
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+	"github.com/cdlus/giscus-proxy/internal/middleware"
+)
+
+// avatarOrigin serves GitHub avatars; the proxy mirrors it under /avatars/.
+const avatarOrigin = "https://avatars.githubusercontent.com"
+
+const (
+	defaultAvatarTTL = 24 * time.Hour
+	// immutableTTL is how long content-addressed static assets are kept.
+	immutableTTL = 365 * 24 * time.Hour
+	// maxMirrorBody bounds the assets the proxy buffers and caches.
+	maxMirrorBody = 4 << 20
+	// modernUserAgent makes Google Fonts serve WOFF2 stylesheets, which every
+	// browser giscus supports understands.
+	modernUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+)
+
+// mirror serves a third-party origin the widget loads from under a route of
+// the proxy, so visitors' browsers never contact it.
+type mirror struct {
+	route     string // e.g. "/avatars/"
+	name      string // route name in logs and metrics
+	origin    string
+	ttl       time.Duration
+	immutable bool
+	userAgent string
+}
+
+// staticMirrors are the origins of giscus's emoji images, icons and web fonts.
+var staticMirrors = []mirror{
+	{route: "/_static/githubassets/", name: "static", origin: "https://github.githubassets.com", ttl: immutableTTL, immutable: true},
+	{route: "/_static/fonts/", name: "static", origin: "https://fonts.gstatic.com", ttl: immutableTTL, immutable: true},
+	{route: "/_static/fonts-css/", name: "static", origin: "https://fonts.googleapis.com", ttl: 24 * time.Hour, userAgent: modernUserAgent},
+}
+
+// mirrorReplacers point URLs of the mirrored origins at the proxy's routes, or
+// are nil when nothing is mirrored.
+func (p *Proxy) mirrorReplacers(r *http.Request) []replacer {
+	if len(p.mirrors) == 0 {
+		return nil
+	}
+	base := p.proxyBase(r)
+	reps := make([]replacer, 0, len(p.mirrors))
+	for _, m := range p.mirrors {
+		reps = append(reps, replacer{from: m.origin + "/", to: base + m.route})
+	}
+	return reps
+}
+
+// mirrorType reports whether responses of this content type reference mirrored
+// assets: the widget document, the API's JSON and stylesheets.
+func mirrorType(contentType string) bool {
+	mt := mediaType(contentType)
+	return mt == "text/html" || mt == "application/json" || mt == "text/css"
+}
+
+// rewriteMirrors points mirrored URLs in a body of the given content type at the proxy.
+func (p *Proxy) rewriteMirrors(r *http.Request, contentType string, b []byte) []byte {
+	if reps := p.mirrorReplacers(r); reps != nil && mirrorType(contentType) {
+		return applyReplacements(b, reps)
+	}
+	return b
+}
+
+// handleMirror serves m.route+PATH from m.origin+PATH without passing on
+// anything about the visitor. Responses are cached for the mirror's TTL, or
+// longer when the origin allows it, and browsers may keep them as long.
+func (p *Proxy) handleMirror(m mirror) http.HandlerFunc {
+	maxAge := "public, max-age=" + strconv.Itoa(int(m.ttl.Seconds()))
+	if m.immutable {
+		maxAge += ", immutable"
+	}
+	ua := m.userAgent
+	if ua == "" {
+		ua = userAgent
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		var target string
+		cacheState := "BYPASS"
+		var ph phases
+		r, span := p.startSpan(r, m.name)
+		defer func() {
+			p.logLine(r, m.name, sw.status, sw.written, time.Since(start), cacheState, target)
+			p.logSlow(r, m.name, sw.status, time.Since(start), &ph)
+			p.endSpan(span, sw.status, cacheState, target)
+		}()
+		w = sw
+
+		if !p.checkSite(w, r) || !p.checkBot(w, r) {
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			p.httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		target = m.origin + "/" + strings.TrimPrefix(r.URL.Path, m.route)
+		if raw := r.URL.RawQuery; raw != "" {
+			target += "?" + raw
+		}
+		// Stylesheets embed the proxy's own URLs once rewritten.
+		key := "mirror " + r.URL.RequestURI() + " host=" + r.Host
+		if p.cacheable(r) {
+			if ent, ok := p.cache.Get(r.Context(), key); ok {
+				cacheState = "HIT"
+				writeMirrored(w, r, ent.Status, ent.Headers, maxAge, ent.Body)
+				return
+			}
+		}
+
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target, nil)
+		if err != nil {
+			p.httpError(w, r, "failed to build upstream request", http.StatusInternalServerError)
+			return
+		}
+		req.Header.Set("Accept", "*/*")
+		req.Header.Set("User-Agent", ua)
+		if id := middleware.RequestIDFrom(r.Context()); id != "" {
+			req.Header.Set(middleware.RequestIDHeader, id)
+		}
+		ph.begin()
+		resp, err := p.client.Do(req)
+		ph.end(&ph.upstream)
+		if err != nil {
+			p.upstreamError(w, r, err)
+			return
+		}
+		defer resp.Body.Close()
+		p.debugUpstream(req, resp)
+
+		ph.begin()
+		bin, err := io.ReadAll(io.LimitReader(resp.Body, maxMirrorBody+1))
+		ph.end(&ph.upstream)
+		if err != nil || len(bin) > maxMirrorBody {
+			p.httpError(w, r, "failed to read "+m.name+" asset", http.StatusBadGateway)
+			return
+		}
+		h := http.Header{}
+		copyIf(h, resp.Header, "Content-Type", "ETag", "Last-Modified")
+		if resp.StatusCode != http.StatusOK {
+			writeMirrored(w, r, resp.StatusCode, h, "no-store", bin)
+			return
+		}
+		if mirrorType(h.Get("Content-Type")) {
+			ph.begin()
+			bin = p.rewriteMirrors(r, h.Get("Content-Type"), bin)
+			h.Del("ETag")
+			ph.end(&ph.transform)
+		}
+		writeMirrored(w, r, resp.StatusCode, h, maxAge, bin)
+		if p.cacheable(r) {
+			ttl := m.ttl
+			if d, ok := parseMaxAge(resp.Header); ok && d > ttl {
+				ttl = d
+			}
+			p.cache.Set(r.Context(), key, cache.Entry{Status: resp.StatusCode, Headers: h, Body: bin, Expires: p.clock.Now().Add(ttl)})
+			cacheState = "MISS:cached"
+		}
+	}
+}
+
+func writeMirrored(w http.ResponseWriter, r *http.Request, status int, h http.Header, cacheControl string, body []byte) {
+	for k := range h {
+		w.Header().Set(k, h.Get(k))
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
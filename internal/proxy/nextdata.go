@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var nextDataRE = regexp.MustCompile(`(?s)(<script[^>]*\bid=["']?__NEXT_DATA__["']?[^>]*>)(.*?)(</script>)`)
+
+// nextDataOverride is a structured edit applied to the widget's __NEXT_DATA__ JSON.
+//
+// Two forms are supported:
+//   - PATH=JSON             set the value at a dot-separated path (array indexes are numbers);
+//     values that are not valid JSON are treated as plain strings
+//   - strings:OLD=>NEW      replace OLD with NEW inside every string value
+type nextDataOverride struct {
+	path  []string
+	value any
+	from  string
+	to    string
+}
+
+func parseNextDataOverrides(vals []string) ([]nextDataOverride, error) {
+	if len(vals) == 0 {
+		return nil, nil
+	}
+	var out []nextDataOverride
+	for _, raw := range vals {
+		if rest, ok := strings.CutPrefix(raw, "strings:"); ok {
+			from, to, ok := strings.Cut(rest, "=>")
+			if !ok || from == "" {
+				return nil, fmt.Errorf("bad next data override %q (use strings:OLD=>NEW)", raw)
+			}
+			out = append(out, nextDataOverride{from: from, to: to})
+			continue
+		}
+		path, val, ok := strings.Cut(raw, "=")
+		path = strings.TrimSpace(path)
+		if !ok || path == "" {
+			return nil, fmt.Errorf("bad next data override %q (use PATH=VALUE)", raw)
+		}
+		val = strings.TrimSpace(val)
+		var v any
+		dec := json.NewDecoder(strings.NewReader(val))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil || dec.More() {
+			v = val
+		}
+		out = append(out, nextDataOverride{path: strings.Split(path, "."), value: v})
+	}
+	return out, nil
+}
+
+// applyNextData rewrites the __NEXT_DATA__ script in b. Documents without the script are returned untouched.
+func applyNextData(b []byte, ovs []nextDataOverride) ([]byte, error) {
+	if len(ovs) == 0 {
+		return b, nil
+	}
+	loc := nextDataRE.FindSubmatchIndex(b)
+	if loc == nil {
+		return b, nil
+	}
+	var data any
+	dec := json.NewDecoder(bytes.NewReader(b[loc[4]:loc[5]]))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		return nil, fmt.Errorf("parse __NEXT_DATA__: %w", err)
+	}
+	for _, ov := range ovs {
+		if ov.path == nil {
+			data = replaceStrings(data, ov.from, ov.to)
+			continue
+		}
+		var err error
+		if data, err = setPath(data, ov.path, ov.value); err != nil {
+			return nil, fmt.Errorf("set %s: %w", strings.Join(ov.path, "."), err)
+		}
+	}
+	// json.Marshal escapes <, > and & so the payload can't terminate the script early.
+	enc, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(b)+len(enc)-(loc[5]-loc[4]))
+	out = append(out, b[:loc[4]]...)
+	out = append(out, enc...)
+	out = append(out, b[loc[5]:]...)
+	return out, nil
+}
+
+func setPath(node any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	key := path[0]
+	switch n := node.(type) {
+	case []any:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(n) {
+			return nil, fmt.Errorf("index %q out of range", key)
+		}
+		v, err := setPath(n[i], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = v
+		return n, nil
+	case map[string]any:
+		v, err := setPath(n[key], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		n[key] = v
+		return n, nil
+	case nil:
+		v, err := setPath(nil, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{key: v}, nil
+	default:
+		return nil, fmt.Errorf("cannot descend into %T at %q", node, key)
+	}
+}
+
+func replaceStrings(node any, from, to string) any {
+	switch n := node.(type) {
+	case string:
+		return strings.ReplaceAll(n, from, to)
+	case []any:
+		for i := range n {
+			n[i] = replaceStrings(n[i], from, to)
+		}
+	case map[string]any:
+		for k, v := range n {
+			n[k] = replaceStrings(v, from, to)
+		}
+	}
+	return node
+}
@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"log"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+)
+
+// Option sets one Config field for NewWithOptions.
+type Option func(*Config)
+
+// NewWithOptions builds a Proxy from the zero Config with opts applied in order.
+// It accepts the same settings as New; WithConfig covers fields without an
+// option of their own.
+func NewWithOptions(opts ...Option) *Proxy {
+	var cfg Config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return New(cfg)
+}
+
+// WithConfig replaces the whole Config; later options adjust it.
+func WithConfig(cfg Config) Option {
+	return func(c *Config) { *c = cfg }
+}
+
+// WithUpstream sets the giscus origin to proxy (default https://giscus.app).
+func WithUpstream(origin string) Option {
+	return func(c *Config) { c.UpstreamOrigin = origin }
+}
+
+// WithPublicOrigin sets the origin visitors use to reach the proxy.
+func WithPublicOrigin(origin string) Option {
+	return func(c *Config) { c.PublicOrigin = origin }
+}
+
+// WithBasePath mounts the proxy under a path prefix.
+func WithBasePath(path string) Option {
+	return func(c *Config) { c.BasePath = path }
+}
+
+// WithCache stores upstream responses in store.
+func WithCache(store cache.Cache) Option {
+	return func(c *Config) { c.Cache = store }
+}
+
+// WithClient sends upstream requests through client.
+func WithClient(client HTTPClient) Option {
+	return func(c *Config) { c.Client = client }
+}
+
+// WithTimeout bounds each upstream request made by the default client.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Config) { c.UpstreamTimeout = d }
+}
+
+// WithLogger writes access and diagnostic logs to logger.
+func WithLogger(logger *log.Logger) Option {
+	return func(c *Config) { c.Logger = logger }
+}
+
+// WithReplacements adds server-side LEFT=>RIGHT replacement rules.
+func WithReplacements(rules ...string) Option {
+	return func(c *Config) { c.Replacements = append(c.Replacements, rules...) }
+}
+
+// WithTransformers adds custom body rewrites after any added earlier.
+func WithTransformers(ts ...Transformer) Option {
+	return func(c *Config) { c.Transformers = append(c.Transformers, ts...) }
+}
+
+// WithSnippets adds HTML fragments injected into the widget document.
+func WithSnippets(snippets ...Snippet) Option {
+	return func(c *Config) { c.Snippets = append(c.Snippets, snippets...) }
+}
+
+// WithErrorReporter notifies reporter of failures and recovered panics.
+func WithErrorReporter(reporter ErrorReporter) Option {
+	return func(c *Config) { c.ErrorReporter = reporter }
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// originPattern matches a browser origin. Patterns look like "https://example.com",
+// "https://*.example.com" (any subdomain), "example.com" (any scheme) or "*".
+type originPattern struct {
+	scheme   string
+	host     string
+	wildcard bool
+	any      bool
+}
+
+func parseOriginPatterns(vals []string) []originPattern {
+	var out []originPattern
+	for _, v := range vals {
+		v = strings.ToLower(strings.TrimRight(strings.TrimSpace(v), "/"))
+		if v == "" {
+			continue
+		}
+		if v == "*" {
+			out = append(out, originPattern{any: true})
+			continue
+		}
+		var pat originPattern
+		if scheme, rest, ok := strings.Cut(v, "://"); ok {
+			pat.scheme, v = scheme, rest
+		}
+		if rest, ok := strings.CutPrefix(v, "*."); ok {
+			pat.wildcard, v = true, rest
+		}
+		pat.host = v
+		out = append(out, pat)
+	}
+	return out
+}
+
+func (o originPattern) match(scheme, host string) bool {
+	if o.any {
+		return true
+	}
+	if o.scheme != "" && o.scheme != scheme {
+		return false
+	}
+	if o.wildcard {
+		return strings.HasSuffix(host, "."+o.host)
+	}
+	return host == o.host
+}
+
+// matchOrigin reports whether origin (scheme://host[:port]) matches any pattern.
+func matchOrigin(patterns []originPattern, origin string) bool {
+	u, err := url.Parse(strings.ToLower(strings.TrimSpace(origin)))
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, pat := range patterns {
+		if pat.match(u.Scheme, u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsOrigin returns the Access-Control-Allow-Origin value for r and whether the
+// request's Origin is allowed. Requests without an Origin header are always allowed.
+func (p *Proxy) corsOrigin(r *http.Request) (string, bool) {
+	if len(p.allowedOrigins) == 0 {
+		return "*", true
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return "", true
+	}
+	if matchOrigin(p.allowedOrigins, origin) {
+		return origin, true
+	}
+	return "", false
+}
+
+// checkOrigin rejects requests from origins outside the allowlist with 403.
+func (p *Proxy) checkOrigin(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := p.corsOrigin(r); ok {
+		return true
+	}
+	w.Header().Add("Vary", "Origin")
+	p.httpError(w, r, "origin not allowed", http.StatusForbidden)
+	return false
+}
+
+// writeCORS sets the CORS headers for r. With an origin allowlist the answer
+// depends on Origin, so it is listed in Vary even for requests without one:
+// otherwise a shared cache could hand their response to an allowed origin.
+func (p *Proxy) writeCORS(w http.ResponseWriter, r *http.Request) {
+	if len(p.allowedOrigins) > 0 {
+		w.Header().Add("Vary", "Origin")
+	}
+	origin, ok := p.corsOrigin(r)
+	if !ok || origin == "" {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	w.Header().Set("Access-Control-Allow-Methods", "GET,HEAD,OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization,Accept")
+}
+
+// requestSite returns the origin of the page that issued r, from Origin or Referer.
+func requestSite(r *http.Request) string {
+	if o := r.Header.Get("Origin"); o != "" && o != "null" {
+		return o
+	}
+	u, err := url.Parse(r.Header.Get("Referer"))
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// siteAllowed reports whether r comes from an allowed embedding site: one of
+// its tenant's Sites, or of AllowedSites. Requests from the proxy's own pages
+// (the widget loading its assets) always pass.
+func (p *Proxy) siteAllowed(r *http.Request) bool {
+	allowed := p.allowedSites
+	if t := p.tenantFor(r); t != nil && len(t.sites) > 0 {
+		allowed = t.sites
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	site := requestSite(r)
+	if site == "" {
+		return p.allowEmptyRef
+	}
+	if u, err := url.Parse(site); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	if p.publicOrigin != "" && strings.EqualFold(site, p.publicOrigin) {
+		return true
+	}
+	return matchOrigin(allowed, site)
+}
+
+// checkSite rejects requests from embedding sites outside the allowlist with 403.
+func (p *Proxy) checkSite(w http.ResponseWriter, r *http.Request) bool {
+	if isWarm(r) || p.siteAllowed(r) {
+		return true
+	}
+	p.httpError(w, r, "embedding site not allowed", http.StatusForbidden)
+	return false
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	patterns := parseOriginPatterns([]string{
+		"https://blog.example.com/",
+		"*.example.org",
+		"HTTP://Local.Test:8080",
+	})
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://blog.example.com", true},
+		{"HTTPS://BLOG.EXAMPLE.COM", true},
+		{"http://blog.example.com", false},
+		{"https://blog.example.com:8443", false},
+		{"https://www.example.com", false},
+		{"https://a.example.org", true},
+		{"http://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://evilexample.org", false},
+		{"http://local.test:8080", true},
+		{"http://local.test", false},
+		{"null", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := matchOrigin(patterns, tt.origin); got != tt.want {
+			t.Errorf("matchOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+	if !matchOrigin(parseOriginPatterns([]string{"*"}), "https://anything.test") {
+		t.Error(`"*" does not match every origin`)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	upstream := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = io.WriteString(w, "widget")
+	}
+	tests := []struct {
+		name        string
+		allowed     []string
+		method      string
+		origin      string
+		wantStatus  int
+		wantAllow   string
+		wantVary    bool
+		wantMethods bool
+	}{
+		{"no allowlist", nil, http.MethodGet, "https://any.test", http.StatusOK, "*", false, true},
+		{"no allowlist without origin", nil, http.MethodGet, "", http.StatusOK, "*", false, true},
+		{"allowed", []string{"https://blog.test"}, http.MethodGet, "https://blog.test", http.StatusOK, "https://blog.test", true, true},
+		{"allowed by wildcard", []string{"*.blog.test"}, http.MethodGet, "https://www.blog.test", http.StatusOK, "https://www.blog.test", true, true},
+		{"without origin", []string{"https://blog.test"}, http.MethodGet, "", http.StatusOK, "", true, false},
+		{"rejected", []string{"https://blog.test"}, http.MethodGet, "https://evil.test", http.StatusForbidden, "", true, false},
+		{"preflight allowed", []string{"https://blog.test"}, http.MethodOptions, "https://blog.test", http.StatusNoContent, "https://blog.test", true, true},
+		{"preflight rejected", []string{"https://blog.test"}, http.MethodOptions, "https://evil.test", http.StatusForbidden, "", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProxy(t, Config{AllowedOrigins: tt.allowed}, upstream)
+			r := httptest.NewRequest(tt.method, "/widget?repo=o/r", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			rec := serve(p, r)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			h := rec.Header()
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.wantAllow {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantAllow)
+			}
+			if got := slices.Contains(h.Values("Vary"), "Origin"); got != tt.wantVary {
+				t.Errorf("Vary = %q, want Origin listed: %v", h.Values("Vary"), tt.wantVary)
+			}
+			if got := h.Get("Access-Control-Allow-Methods") != ""; got != tt.wantMethods {
+				t.Errorf("Access-Control-Allow-Methods = %q, want set: %v", h.Get("Access-Control-Allow-Methods"), tt.wantMethods)
+			}
+		})
+	}
+}
+
+func TestCORSCached(t *testing.T) {
+	// A response cached for one origin must not carry its
+	// Access-Control-Allow-Origin to another.
+	var hits int
+	p := newTestProxy(t, Config{AllowedOrigins: []string{"*.blog.test"}, Cache: cache.NewMemoryCache(16)},
+		func(w http.ResponseWriter, r *http.Request) {
+			hits++
+			w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+			w.Header().Set("Cache-Control", "public, max-age=3600")
+			_, _ = io.WriteString(w, "client")
+		})
+	for _, origin := range []string{"https://a.blog.test", "https://b.blog.test", ""} {
+		r := httptest.NewRequest(http.MethodGet, "/client.js", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		rec := serve(p, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%q: status %d", origin, rec.Code)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != origin {
+			t.Errorf("%q: Access-Control-Allow-Origin = %q", origin, got)
+		}
+	}
+	if hits != 1 {
+		t.Errorf("upstream hit %d times, want 1", hits)
+	}
+}
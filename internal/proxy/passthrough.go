@@ -1,13 +1,15 @@
 package proxy
 
 import (
-	"fmt"
+	"bytes"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
-	"giscus-proxy/internal/cache"
+	"github.com/cdlus/giscus-proxy/internal/cache"
+	"github.com/cdlus/giscus-proxy/internal/middleware"
 )
 
 func (p *Proxy) handlePassthrough(w http.ResponseWriter, r *http.Request) {
@@ -15,31 +17,48 @@ func (p *Proxy) handlePassthrough(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 	var target string
 	cacheState := "BYPASS"
+	var ph phases
+	r, span := p.startSpan(r, "passthrough")
 	defer func() {
-		p.logLine("pass", r.Method, r.URL.RequestURI(), sw.status, sw.written, time.Since(start), cacheState, target)
+		p.logLine(r, "pass", sw.status, sw.written, time.Since(start), cacheState, target)
+		p.logSlow(r, "pass", sw.status, time.Since(start), &ph)
+		p.endSpan(span, sw.status, cacheState, target)
 	}()
 	w = sw
 
+	if !p.checkOrigin(w, r) || !p.checkSite(w, r) || !p.checkBot(w, r) {
+		return
+	}
 	if r.Method == http.MethodOptions {
-		writeCORS(w)
+		p.writeCORS(w, r)
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 	if r.Method != http.MethodGet && r.Method != http.MethodHead {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		p.httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if p.stripTelemetry && p.blockTelemetry(w, r) {
+		cacheState = "BLOCKED"
+		return
+	}
+	if !p.passthroughPaths.allowed(r.URL.Path) {
+		p.httpError(w, r, "404 page not found", http.StatusNotFound)
 		return
 	}
 
-	target = p.upstreamOrigin + r.URL.Path
+	target = p.upstreamFor(r) + r.URL.Path
 	if raw := r.URL.RawQuery; raw != "" {
 		target += "?" + raw
 	}
 
-	if p.cache != nil && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
-		if ent, ok := p.cache.Get(p.cacheKey(r)); ok {
+	if p.cacheable(r) && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		if ent, ok := p.cache.Get(r.Context(), p.cacheKey(r)); ok {
+			p.writeCORS(w, r)
 			for _, k := range p.cacheHeaders {
 				if v := ent.Headers.Get(k); v != "" {
-					w.Header().Set(k, v)
+					mergeHeader(w.Header(), k, v)
 				}
 			}
 			w.WriteHeader(ent.Status)
@@ -47,62 +66,128 @@ func (p *Proxy) handlePassthrough(w http.ResponseWriter, r *http.Request) {
 				_, _ = w.Write(ent.Body)
 			}
 			cacheState = "HIT"
+			p.debugf("cache hit path=%s expires=%s", p.redactURL(r.URL.RequestURI()), ent.Expires.Format(time.RFC3339))
 			return
 		}
+		p.debugf("cache miss path=%s", p.redactURL(r.URL.RequestURI()))
 	}
 
-	req, err := http.NewRequest(http.MethodGet, target, nil)
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target, nil)
 	if err != nil {
-		http.Error(w, "failed to build upstream request", http.StatusInternalServerError)
+		p.httpError(w, r, "failed to build upstream request", http.StatusInternalServerError)
 		return
 	}
-	if ae := r.Header.Get("Accept-Encoding"); ae != "" {
+	p.headerPolicy.forward(req.Header, r.Header)
+	if id := middleware.RequestIDFrom(r.Context()); id != "" {
+		req.Header.Set(middleware.RequestIDHeader, id)
+	}
+	// With passthrough transforms enabled, leave Accept-Encoding to the transport so
+	// bodies arrive decoded and can be rewritten.
+	if ae := r.Header.Get("Accept-Encoding"); ae != "" && !p.passthroughTransforms(r) {
 		req.Header.Set("Accept-Encoding", ae)
 	}
 	req.Header.Set("Accept", "*/*")
-	req.Header.Set("User-Agent", "giscus-proxy/clean-1.0")
+	req.Header.Set("User-Agent", userAgent)
 
+	ph.begin()
 	resp, err := p.client.Do(req)
+	ph.end(&ph.upstream)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("upstream error: %v", err), http.StatusBadGateway)
+		p.upstreamError(w, r, err)
 		return
 	}
 	defer resp.Body.Close()
+	p.debugUpstream(req, resp)
 
-	writeCORS(w)
+	p.writeCORS(w, r)
 
-	enc := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
-	if p.cache != nil && r.Method == http.MethodGet && (enc == "" || enc == "identity") && resp.StatusCode == http.StatusOK {
-		bin, err := io.ReadAll(resp.Body)
+	if r.Method == http.MethodGet && resp.StatusCode == http.StatusOK && p.transformable(r, resp.Header.Get("Content-Type")) {
+		body, clean, err := decompressIfNeeded(resp.Header, resp.Body)
 		if err == nil {
-			copyIf(w.Header(), resp.Header, p.cacheHeaders...)
-			w.WriteHeader(resp.StatusCode)
-			_, _ = w.Write(bin)
-
-			if ttl, ok := parseMaxAge(resp.Header); ok {
-				h := http.Header{}
-				for _, k := range p.cacheHeaders {
-					if v := resp.Header.Get(k); v != "" {
-						h.Set(k, v)
-					}
-				}
-				p.cache.Set(p.cacheKey(r), cache.Entry{Status: resp.StatusCode, Headers: h, Body: bin, Expires: time.Now().Add(ttl)})
-				cacheState = "MISS:cached"
+			defer clean()
+			ph.begin()
+			buf, err := readPooled(body)
+			defer putBuffer(buf)
+			bin := buf.Bytes()
+			ph.end(&ph.upstream)
+			if err != nil {
+				p.httpError(w, r, "failed to read upstream body", http.StatusBadGateway)
 				return
 			}
+			ph.begin()
+			bin = p.transformPassthrough(r, resp.Header.Get("Content-Type"), bin)
+			ph.end(&ph.transform)
+			// The body was decoded and rewritten, so upstream encoding and validators no longer apply.
+			h := p.cacheableHeaders(resp.Header, "Content-Encoding", "ETag")
+			ph.begin()
+			cacheState = p.writeBody(w, r, resp, h, bin)
+			ph.end(&ph.write)
+			return
 		}
-		copyIf(w.Header(), resp.Header, p.cacheHeaders...)
-		w.WriteHeader(resp.StatusCode)
-		if err == nil {
-			_, _ = w.Write(bin)
+	}
+
+	enc := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if p.cacheable(r) && r.Method == http.MethodGet && (enc == "" || enc == "identity") && resp.StatusCode == http.StatusOK {
+		ph.begin()
+		buf, err := readPooled(resp.Body)
+		defer putBuffer(buf)
+		bin := buf.Bytes()
+		ph.end(&ph.upstream)
+		if err != nil {
+			p.httpError(w, r, "failed to read upstream body", http.StatusBadGateway)
+			return
 		}
-		cacheState = "MISS"
+		ph.begin()
+		cacheState = p.writeBody(w, r, resp, p.cacheableHeaders(resp.Header), bin)
+		ph.end(&ph.write)
 		return
 	}
 
 	copyIf(w.Header(), resp.Header, p.cacheHeaders...)
 	w.WriteHeader(resp.StatusCode)
 	if r.Method != http.MethodHead {
+		ph.begin()
 		_, _ = io.Copy(w, resp.Body)
+		ph.end(&ph.write)
+	}
+}
+
+// cacheableHeaders copies the configured cache headers from h, skipping the excluded keys.
+func (p *Proxy) cacheableHeaders(h http.Header, exclude ...string) http.Header {
+	out := http.Header{}
+	for _, k := range p.cacheHeaders {
+		if slices.ContainsFunc(exclude, func(e string) bool { return strings.EqualFold(e, k) }) {
+			continue
+		}
+		if v := h.Get(k); v != "" {
+			out.Set(k, v)
+		}
+	}
+	return out
+}
+
+// writeBody sends a fully read upstream body and stores a copy in the cache when
+// the response carries a max-age, as bin may be a pooled buffer. It returns the
+// resulting cache state for logging.
+func (p *Proxy) writeBody(w http.ResponseWriter, r *http.Request, resp *http.Response, h http.Header, bin []byte) string {
+	for k := range h {
+		mergeHeader(w.Header(), k, h.Get(k))
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(bin)
+
+	if !p.cacheable(r) {
+		return "BYPASS"
+	}
+	ttl, ok := parseMaxAge(resp.Header)
+	if d := RequestOptionsFrom(r.Context()).CacheTTL; d > 0 {
+		ttl, ok = d, true
+	}
+	if !ok {
+		p.debugf("cache skip path=%s: no max-age in Cache-Control %q", p.redactURL(r.URL.RequestURI()), resp.Header.Get("Cache-Control"))
+		return "MISS"
 	}
+	p.debugf("cache store path=%s ttl=%s", p.redactURL(r.URL.RequestURI()), ttl)
+	p.cache.Set(r.Context(), p.cacheKey(r), cache.Entry{Status: resp.StatusCode, Headers: h, Body: bytes.Clone(bin), Expires: p.clock.Now().Add(ttl)})
+	return "MISS:cached"
 }
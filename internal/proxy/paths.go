@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"path"
+	"strings"
+)
+
+// DefaultPassthroughAllow lists the upstream paths the widget needs: the client
+// script, Next.js assets, the giscus API, built-in themes and localized widgets.
+var DefaultPassthroughAllow = []string{
+	"/client.js",
+	"/_next/",
+	"/api/",
+	"/themes/",
+	"/*/widget",
+	"/favicon.ico",
+}
+
+// pathRules decides which paths the passthrough handler forwards. Patterns
+// containing "*" are matched with path.Match (one segment per "*"); all others are
+// prefixes. Deny patterns win over allow patterns.
+type pathRules struct {
+	allow []string
+	deny  []string
+}
+
+func newPathRules(allow, deny []string) pathRules {
+	if allow == nil {
+		allow = DefaultPassthroughAllow
+	}
+	return pathRules{allow: cleanPatterns(allow), deny: cleanPatterns(deny)}
+}
+
+func cleanPatterns(vals []string) []string {
+	var out []string
+	for _, v := range vals {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func matchPathPattern(pattern, p string) bool {
+	if strings.Contains(pattern, "*") {
+		ok, _ := path.Match(pattern, p)
+		return ok
+	}
+	return strings.HasPrefix(p, pattern)
+}
+
+func (pr pathRules) allowed(p string) bool {
+	for _, pat := range pr.deny {
+		if matchPathPattern(pat, p) {
+			return false
+		}
+	}
+	for _, pat := range pr.allow {
+		if matchPathPattern(pat, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+)
+
+// pinnedCopyTTL is how long a copy matching the pin is kept to stand in for
+// divergent upstream content.
+const pinnedCopyTTL = 30 * 24 * time.Hour
+
+// buildIDRE finds the Next.js build ID in the widget's __NEXT_DATA__.
+var buildIDRE = regexp.MustCompile(`"buildId"\s*:\s*"([^"]+)"`)
+
+// widgetFetchKey marks the upstream request for the widget document.
+type widgetFetchKey struct{}
+
+// pins holds the known-good client script hash and widget build, and what
+// upstream served last.
+type pins struct {
+	clientSHA256  string
+	widgetBuildID string
+
+	mu         sync.Mutex
+	clientSeen string
+	widgetSeen string
+}
+
+// pinClient checks upstream responses for /client.js and the widget against the
+// pins. Matching responses are kept in the cache; divergent ones are reported
+// and replaced by the kept copy when there is one, so a breaking giscus release
+// doesn't reach visitors before the transforms are updated.
+type pinClient struct {
+	HTTPClient
+	p *Proxy
+}
+
+func (c *pinClient) Do(req *http.Request) (*http.Response, error) {
+	pins := c.p.pins
+	var what, want string
+	var version func([]byte) string
+	switch {
+	case req.Context().Value(widgetFetchKey{}) != nil && pins.widgetBuildID != "":
+		what, want, version = "widget", pins.widgetBuildID, widgetBuildID
+	case req.URL.Path == "/client.js" && pins.clientSHA256 != "":
+		what, want, version = "client.js", pins.clientSHA256, sha256Hex
+	default:
+		return c.HTTPClient.Do(req)
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK || req.Method != http.MethodGet {
+		return resp, err
+	}
+	body, clean, err := decompressIfNeeded(resp.Header, resp.Body)
+	if err != nil {
+		return resp, nil
+	}
+	b, err := io.ReadAll(body)
+	clean()
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Set("Content-Length", strconv.Itoa(len(b)))
+	resp.ContentLength = int64(len(b))
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+
+	key := "pin " + req.URL.String()
+	got := version(b)
+	if got == want {
+		if c.p.cache != nil {
+			h := http.Header{}
+			copyIf(h, resp.Header, "Content-Type", "Cache-Control", "ETag", "Last-Modified")
+			c.p.cache.Set(req.Context(), key, cache.Entry{Status: resp.StatusCode, Headers: h, Body: b, Expires: c.p.clock.Now().Add(pinnedCopyTTL)})
+		}
+		pins.seen(what, got)
+		return resp, nil
+	}
+	if pins.seen(what, got) {
+		c.p.reportError(req, "pin", fmt.Errorf("upstream %s diverged from the pin: got %s, pinned %s", what, got, want))
+	}
+	if c.p.cache == nil {
+		return resp, nil
+	}
+	ent, ok := c.p.cache.Get(req.Context(), key)
+	if !ok {
+		c.p.warnf("no pinned copy of %s, serving the divergent upstream version", req.URL.Path)
+		return resp, nil
+	}
+	pinned := &http.Response{
+		Status:        strconv.Itoa(ent.Status) + " " + http.StatusText(ent.Status),
+		StatusCode:    ent.Status,
+		Proto:         resp.Proto,
+		ProtoMajor:    resp.ProtoMajor,
+		ProtoMinor:    resp.ProtoMinor,
+		Header:        ent.Headers.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(ent.Body)),
+		ContentLength: int64(len(ent.Body)),
+		Request:       req,
+	}
+	pinned.Header.Set("Content-Length", strconv.Itoa(len(ent.Body)))
+	return pinned, nil
+}
+
+// seen records the version upstream served and reports whether it changed.
+func (ps *pins) seen(what, version string) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	last := &ps.clientSeen
+	if what == "widget" {
+		last = &ps.widgetSeen
+	}
+	changed := *last != version
+	*last = version
+	return changed
+}
+
+// status describes the pins and what upstream served last, for the admin API.
+func (ps *pins) status() map[string]string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return map[string]string{
+		"client_sha256":        ps.clientSHA256,
+		"client_sha256_seen":   ps.clientSeen,
+		"widget_build_id":      ps.widgetBuildID,
+		"widget_build_id_seen": ps.widgetSeen,
+	}
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func widgetBuildID(b []byte) string {
+	if m := buildIDRE.FindSubmatch(b); m != nil {
+		return string(m[1])
+	}
+	return ""
+}
+
+// pinStatus returns the pins' status, or nil when nothing is pinned.
+func (p *Proxy) pinStatus() map[string]string {
+	if p.pins == nil {
+		return nil
+	}
+	return p.pins.status()
+}
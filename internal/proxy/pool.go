@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// maxPooledBuffer is the largest buffer returned to the pool; bigger ones, from
+// unusually large bodies, are left to the garbage collector so the pool doesn't
+// pin their memory.
+const maxPooledBuffer = 4 << 20
+
+var bufPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	return bufPool.Get().(*bytes.Buffer)
+}
+
+// putBuffer returns buf to the pool. Its bytes must no longer be in use.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufPool.Put(buf)
+}
+
+// readPooled reads r to the end into a pooled buffer, which the caller hands
+// back with putBuffer once done with its bytes, even when reading failed.
+func readPooled(r io.Reader) (*bytes.Buffer, error) {
+	buf := getBuffer()
+	_, err := buf.ReadFrom(r)
+	return buf, err
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+)
+
+var previewFields = []struct {
+	Name, Label, Default string
+}{
+	{"repo", "Repository (owner/name)", ""},
+	{"repo-id", "Repository ID", ""},
+	{"category", "Category", ""},
+	{"category-id", "Category ID", ""},
+	{"mapping", "Mapping", "pathname"},
+	{"term", "Term (for specific/number mapping)", ""},
+	{"theme", "Theme", "preferred_color_scheme"},
+	{"lang", "Language", "en"},
+	{"reactions-enabled", "Reactions enabled (1/0)", "1"},
+	{"input-position", "Input position (top/bottom)", "bottom"},
+}
+
+var previewTmpl = template.Must(template.New("preview").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>giscus-proxy preview</title>
+<style>
+body{font-family:system-ui,sans-serif;max-width:52rem;margin:2rem auto;padding:0 1rem}
+form{display:grid;grid-template-columns:max-content 1fr;gap:.4rem 1rem;align-items:center;margin-bottom:2rem}
+label{font-size:.9rem}
+input{padding:.3rem;font:inherit}
+button{grid-column:2;justify-self:start;padding:.4rem 1rem}
+</style>
+</head>
+<body>
+<h1>giscus-proxy preview</h1>
+<p>Widget and client are served from <code>{{.Origin}}</code>.</p>
+<form method="get">
+{{range .Fields}}<label for="{{.Name}}">{{.Label}}</label><input id="{{.Name}}" name="{{.Name}}" value="{{.Value}}">
+{{end}}<button type="submit">Load widget</button>
+</form>
+{{if .Ready}}<script src="{{.Origin}}/client.js"{{range .Fields}} {{.Attr}}{{end}} crossorigin="anonymous" async></script>
+<div class="giscus"></div>
+{{else}}<p>Fill in at least the repository, repository ID and category ID to load the widget.</p>
+{{end}}</body>
+</html>
+`))
+
+type previewField struct {
+	Name, Label, Value string
+	// Attr is the pre-escaped data-* attribute for the giscus script tag.
+	Attr template.HTMLAttr
+}
+
+// handlePreview serves a playground page that embeds the proxied widget with
+// parameters taken from the query string.
+func (p *Proxy) handlePreview(w http.ResponseWriter, r *http.Request) {
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	defer func() {
+		p.logLine(r, "prev", sw.status, sw.written, time.Since(start), "", "")
+	}()
+	w = sw
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		p.httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	fields := make([]previewField, 0, len(previewFields))
+	for _, f := range previewFields {
+		v := q.Get(f.Name)
+		if v == "" {
+			v = f.Default
+		}
+		attr := template.HTMLAttr("data-" + f.Name + `="` + template.HTMLEscapeString(v) + `"`)
+		fields = append(fields, previewField{Name: f.Name, Label: f.Label, Value: v, Attr: attr})
+	}
+	data := struct {
+		Origin string
+		Fields []previewField
+		Ready  bool
+	}{
+		Origin: p.proxyBase(r),
+		Fields: fields,
+		Ready:  q.Get("repo") != "" && q.Get("repo-id") != "" && q.Get("category-id") != "",
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err := previewTmpl.Execute(w, data); err != nil {
+		p.reportError(r, "preview render", err)
+	}
+}
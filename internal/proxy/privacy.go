@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// telemetryHosts are third-party analytics and beacon origins removed in privacy mode.
+var telemetryHosts = []string{
+	`(?:www\.|ssl\.)?google-analytics\.com`,
+	`(?:www\.)?googletagmanager\.com`,
+	`stats\.g\.doubleclick\.net`,
+	`va\.vercel-scripts\.com`,
+	`vitals\.vercel-insights\.com`,
+	`static\.cloudflareinsights\.com`,
+	`cloudflareinsights\.com`,
+	`plausible\.io`,
+	`cdn\.segment\.com`,
+	`api\.segment\.io`,
+	`(?:[a-z0-9-]+\.)?sentry\.io`,
+	`browser\.sentry-cdn\.com`,
+}
+
+// telemetryPaths are first-party beacon endpoints on the upstream that are
+// answered locally in privacy mode instead of being forwarded.
+var telemetryPaths = []string{
+	"/_vercel/insights/",
+	"/_vercel/speed-insights/",
+	"/cdn-cgi/rum",
+}
+
+var (
+	telemetryHostRE = "(?:" + strings.Join(telemetryHosts, "|") + ")"
+	telemetryPathRE = `/_vercel/(?:speed-)?insights/`
+
+	telemetryScriptRE = regexp.MustCompile(`(?is)<script\b[^>]*\bsrc=["']?[^"'>\s]*(?:` + telemetryHostRE + `|` + telemetryPathRE + `)[^>]*>.*?</script>`)
+	telemetryLinkRE   = regexp.MustCompile(`(?is)<link\b[^>]*\bhref=["']?[^"'>\s]*(?:` + telemetryHostRE + `|` + telemetryPathRE + `)[^>]*>`)
+	telemetryURLRE    = regexp.MustCompile(`(?i)(?:https?:)?//` + telemetryHostRE + `[^"'\x60\s)]*`)
+)
+
+// stripTelemetry removes tracking scripts and preload links from HTML and blanks
+// out absolute tracker URLs in scripts, so beacons have nowhere to go.
+func stripTelemetry(b []byte, contentType string) []byte {
+	if isHTML(contentType) {
+		b = telemetryScriptRE.ReplaceAll(b, nil)
+		b = telemetryLinkRE.ReplaceAll(b, nil)
+	}
+	return telemetryURLRE.ReplaceAll(b, nil)
+}
+
+// telemetryType reports whether responses of this content type are scrubbed in privacy mode.
+func telemetryType(contentType string) bool {
+	mt := mediaType(contentType)
+	return mt == "text/html" || strings.HasSuffix(mt, "/javascript") || strings.HasSuffix(mt, "/ecmascript")
+}
+
+func isTelemetryPath(path string) bool {
+	for _, prefix := range telemetryPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockTelemetry answers beacon requests locally. It reports whether the request was handled.
+func (p *Proxy) blockTelemetry(w http.ResponseWriter, r *http.Request) bool {
+	if !isTelemetryPath(r.URL.Path) {
+		return false
+	}
+	p.writeCORS(w, r)
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Profile bundles widget settings under a name, so embeds can ask for
+// ?profile=NAME instead of repeating them in every URL.
+type Profile struct {
+	Name string
+	// Replacements are applied after the global (or tenant) rules and before
+	// rep= parameters.
+	Replacements []string
+	// Theme is the theme parameter used when the URL sets none.
+	Theme string
+	// Lang selects the giscus locale, e.g. "fr" fetches /fr/widget upstream.
+	Lang string
+}
+
+type profile struct {
+	replacers []replacer
+	theme     string
+	lang      string
+}
+
+// newProfiles parses the configured profiles, skipping unnamed ones and
+// ignoring replacements that don't parse.
+func (p *Proxy) newProfiles(cfgs []Profile) map[string]*profile {
+	if len(cfgs) == 0 {
+		return nil
+	}
+	out := make(map[string]*profile, len(cfgs))
+	for _, c := range cfgs {
+		name := strings.TrimSpace(c.Name)
+		if name == "" {
+			p.warnf("ignoring profile without a name")
+			continue
+		}
+		pr := &profile{theme: c.Theme, lang: strings.Trim(c.Lang, "/ ")}
+		if len(c.Replacements) > 0 {
+			reps, err := parseReplacers(c.Replacements)
+			if err != nil {
+				p.warnf("profile %s: ignoring replacements: %v", name, err)
+			} else {
+				pr.replacers = reps
+			}
+		}
+		out[name] = pr
+	}
+	return out
+}
+
+// profileFor returns the profile named by r's profile parameter, nil when there
+// is none, or an error for an unknown name.
+func (p *Proxy) profileFor(r *http.Request) (*profile, error) {
+	name := r.URL.Query().Get("profile")
+	if name == "" {
+		return nil, nil
+	}
+	pr, ok := p.profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+	return pr, nil
+}
+
+// widgetSource returns the upstream path of the widget, in the profile's locale
+// when it sets one.
+func (p *Proxy) widgetSource(pr *profile) string {
+	if pr == nil || pr.lang == "" {
+		return p.widgetSourcePath
+	}
+	return "/" + pr.lang + "/widget"
+}
+
+func profileNames(m map[string]*profile) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
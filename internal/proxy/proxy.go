@@ -1,11 +1,22 @@
 package proxy
 
 import (
+	"expvar"
 	"log"
 	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"giscus-proxy/internal/cache"
+	"github.com/cdlus/giscus-proxy/internal/cache"
+	"github.com/cdlus/giscus-proxy/internal/clock"
+	"github.com/cdlus/giscus-proxy/internal/middleware"
+	"github.com/cdlus/giscus-proxy/internal/statsd"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 // HTTPClient represents the subset of *http.Client used by the proxy.
@@ -22,72 +33,872 @@ type Config struct {
 	Client           HTTPClient
 	Cache            cache.Cache
 	Logger           *log.Logger
+	// UpstreamTimeout bounds each upstream request when Client is nil (default 25s).
+	UpstreamTimeout time.Duration
+	// Clock drives cache expiry, readiness memoization, signature expiry, capture
+	// sessions, stats windows and summaries (default the wall clock). It is also
+	// handed to a Cache with a SetClock method.
+	Clock clock.Clock
+
+	// APIOrigin, when set, serves the /api/ routes (discussions, reactions and
+	// sign-in) instead of UpstreamOrigin, which keeps serving the widget UI and
+	// assets, e.g. to pair the public giscus.app widget with a self-hosted backend.
+	APIOrigin string
+
+	// PublicOrigin is the origin visitors use to reach the proxy (e.g. https://comments.example.com).
+	// When empty it is derived from each request.
+	PublicOrigin string
+	// BasePath mounts the proxy under a path prefix (e.g. "/giscus"). The prefix is
+	// stripped from requests and added to proxy_origin and root-relative widget URLs.
+	BasePath string
+
+	// Replacements are LEFT=>RIGHT rules, using the same syntax as the rep query
+	// parameter, applied server-side to every widget response. Right-hand sides may
+	// use {{proxy_origin}}, {{request_host}}, {{upstream_origin}} and {{query.NAME}},
+	// escaped for the response's content type.
+	Replacements []string
+	// StringOverrides maps visible widget strings (e.g. "Sign in with GitHub") to
+	// replacements. They run after Replacements wherever those apply.
+	StringOverrides map[string]string
+	// WidgetSigningKey requires widget URLs to carry a valid HMAC signature (see
+	// SignWidgetURL), so visitors can't alter their parameters or replacements.
+	WidgetSigningKey string
+	// DisableQueryReplacements ignores rep query parameters sent by visitors.
+	DisableQueryReplacements bool
+	// QueryReplacementAllowlist restricts rep query parameters to values fully matching
+	// one of these regular expressions. Empty allows any value.
+	QueryReplacementAllowlist []string
+	// LightTheme and DarkTheme are the giscus themes picked by /widget/auto for
+	// visitors preferring a light or dark color scheme. They default to "light" and "dark".
+	LightTheme string
+	DarkTheme  string
+	// AllowedOrigins restricts cross-origin requests to matching Origin values, which are
+	// echoed back instead of "*". Entries look like "https://example.com",
+	// "https://*.example.com" or "*.example.com". Empty allows every origin.
+	AllowedOrigins []string
+	// AllowedSites restricts the widget and passthrough routes to requests whose
+	// Origin or Referer matches one of these patterns (same syntax as AllowedOrigins).
+	// Requests from the proxy's own pages always pass. Empty disables the check.
+	AllowedSites []string
+	// AllowEmptyReferer lets requests without Origin or Referer through when
+	// AllowedSites is set. Privacy tools often strip the Referer, but any
+	// embedder can too with referrerpolicy="no-referrer", so it is opt-in.
+	AllowEmptyReferer bool
+	// BlockBots rejects widget and passthrough requests whose User-Agent matches
+	// DefaultBotUserAgents or BlockUserAgents (case-insensitive regular expressions);
+	// BlockEmptyUserAgent also rejects requests without one. AllowUserAgents patterns
+	// are exempt from blocking.
+	BlockBots           bool
+	BlockEmptyUserAgent bool
+	BlockUserAgents     []string
+	AllowUserAgents     []string
+	// TrustedProxies lists CIDRs (or IPs) of reverse proxies whose X-Forwarded-For
+	// header is trusted when resolving the client IP.
+	TrustedProxies []string
+	// IPAllow and IPDeny are CIDR (or IP) lists checked before any routing. Deny wins;
+	// a non-empty allow list admits only matching clients.
+	IPAllow []string
+	IPDeny  []string
+	// RateLimitRPS enables per-client-IP rate limiting at this many requests per
+	// second, with bursts of up to RateLimitBurst (defaults to the rate).
+	RateLimitRPS   float64
+	RateLimitBurst int
+	// UpstreamRPS caps requests sent upstream across all visitors at this many per
+	// second, with bursts of up to UpstreamBurst. Requests over budget get 503.
+	UpstreamRPS   float64
+	UpstreamBurst int
+	// ModifyUpstreamRequest decorates every request before it is sent upstream,
+	// e.g. to add auth or tracing headers or query parameters a self-hosted giscus
+	// expects. It runs before OnUpstreamRequest.
+	ModifyUpstreamRequest func(*http.Request)
+	// OnUpstreamRequest is called with every request before it is sent upstream. It
+	// may change the request, e.g. add headers; returning an error vetoes it and
+	// the visitor gets 403.
+	OnUpstreamRequest func(*http.Request) error
+	// OnUpstreamResponse is called with every upstream response and its request
+	// before the body is read, e.g. to record custom metrics.
+	OnUpstreamResponse func(*http.Response, *http.Request)
+	// ErrorHandler writes error responses for the widget, preview and passthrough
+	// routes. The default sends a minimal HTML page, which retries temporary
+	// upstream failures, to iframes and page loads and plain text to the rest.
+	ErrorHandler ErrorHandler
+	// ErrorReporter is notified of upstream failures, transformation errors and
+	// recovered panics, e.g. to forward them to Sentry.
+	ErrorReporter ErrorReporter
+	// TracerProvider receives a server span per widget and passthrough request and
+	// a client span per upstream call. Nil disables tracing.
+	TracerProvider trace.TracerProvider
+	// ReadyTimeout bounds the upstream check behind /readyz (default 3s).
+	ReadyTimeout time.Duration
+	// Metrics exposes Prometheus metrics at MetricsPath (default "/metrics").
+	Metrics     bool
+	MetricsPath string
+	// StatsD, when set, receives request, cache, upstream and error metrics pushed
+	// over UDP, for platforms where scraping MetricsPath isn't practical.
+	StatsD *statsd.Client
+	// MetricsRecorder receives the same measurements as Metrics and StatsD, for
+	// other telemetry backends. It may also implement ErrorRecorder.
+	MetricsRecorder MetricsRecorder
+	// SlowThreshold, when positive, logs a separate "slow" line for widget and
+	// passthrough requests taking at least this long, broken down by phase.
+	SlowThreshold time.Duration
+	// SummaryInterval, when positive, logs a summary line at this interval with the
+	// cache hit ratio, p50/p95 upstream latency and error rate of the last interval.
+	SummaryInterval time.Duration
+	// MaxInFlight caps requests handled at once; requests beyond it are shed
+	// immediately with 503. Zero means unlimited.
+	MaxInFlight int
+	// SecurityHeaders enables HSTS, X-Content-Type-Options, Referrer-Policy and
+	// Content-Security-Policy headers on every response.
+	SecurityHeaders bool
+	// ContentSecurityPolicy overrides middleware.DefaultCSP when SecurityHeaders is set.
+	ContentSecurityPolicy string
+	// AdminToken and AdminUser/AdminPassword protect the admin endpoints under
+	// AdminPrefix (default "/_admin") with a bearer token and/or basic auth.
+	// Admin endpoints are disabled unless at least one credential is set.
+	AdminToken    string
+	AdminUser     string
+	AdminPassword string
+	AdminPrefix   string
+	// Pprof exposes net/http/pprof under /debug/pprof/ behind the admin credentials.
+	Pprof bool
+	// Capture enables the AdminPrefix+"/capture" endpoint, which records full
+	// upstream requests and responses for a limited time when triggered.
+	Capture bool
+	// Expvar serves runtime statistics and proxy counters at /debug/vars behind the
+	// admin credentials.
+	Expvar bool
+	// Stats collects per-path request counts, bytes served and cache states over a
+	// rolling StatsWindow (default one hour), reported at AdminPrefix+"/stats".
+	Stats       bool
+	StatsWindow time.Duration
+	// LogLevel is "debug", "info" (default), "warn" or "error". Info logs a line per
+	// request; debug adds cache decisions and upstream request/response headers.
+	LogLevel string
+	// AuditLogger receives one JSON line per admin request (actor, action, client IP,
+	// status). Nil writes them to Logger with an "audit" prefix.
+	AuditLogger *log.Logger
+	// SiteUser/SitePassword (basic auth) and/or SiteToken require credentials on every
+	// route except health checks and the admin endpoints, which have their own auth.
+	// The token is accepted as a "token" query parameter (then kept in a cookie) or a
+	// bearer token.
+	SiteUser     string
+	SitePassword string
+	SiteToken    string
+	// RedactNames lists query parameters and headers (case-insensitive) whose values
+	// are replaced with REDACTED in log lines and captures, on top of
+	// DefaultRedactNames.
+	RedactNames []string
+	// PassthroughAllow lists path prefixes (or path.Match patterns containing "*")
+	// forwarded by the passthrough handler; everything else gets 404. Nil means
+	// DefaultPassthroughAllow; use "/" to forward every path. PassthroughDeny
+	// patterns are checked first and always win.
+	PassthroughAllow []string
+	PassthroughDeny  []string
+	// ForwardHeaders is the set of client request headers copied to upstream
+	// requests; empty means DefaultForwardHeaders. StripHeaders, set instead,
+	// forwards every header but the listed ones, DefaultStripHeaders being a
+	// reasonable start. Names ending in "*" match by prefix.
+	ForwardHeaders []string
+	StripHeaders   []string
+	// DisableAuthProxy stops forwarding the giscus sign-in flow (/api/oauth/) and
+	// authenticated or non-GET /api/ calls, which then get the plain passthrough
+	// treatment: GET only, without the visitor's credentials.
+	DisableAuthProxy bool
+	// RewriteAuthCallback also moves redirect_uri parameters pointing at the
+	// upstream onto the proxy, for a self-hosted giscus whose GitHub App callback
+	// URL is the proxy. Leave it off for giscus.app, whose callback is fixed.
+	RewriteAuthCallback bool
+	// GitHubToken enables direct mode: read-only /api/discussions requests from
+	// visitors who aren't signed in are answered from GitHub's GraphQL API with
+	// this token instead of going upstream, which keeps serving everything else.
+	// The token only needs read access to the discussions' repositories.
+	GitHubToken string
+	// GitHubGraphQLURL overrides DefaultGitHubGraphQLURL, e.g. for GitHub Enterprise.
+	GitHubGraphQLURL string
+	// GitHubCacheTTL is how long direct mode caches a discussion (default 1m).
+	GitHubCacheTTL time.Duration
+	// GitHubRepos limits what direct mode reads with GitHubToken to these
+	// OWNER/NAME repositories. Private repositories are never read, listed or not.
+	GitHubRepos []string
+	// ProxyAvatars serves GitHub avatars from /avatars/ and points avatar URLs in
+	// the widget and API responses there, so visitors' browsers never contact
+	// GitHub. Avatars are cached for AvatarCacheTTL (default 24h).
+	ProxyAvatars   bool
+	AvatarCacheTTL time.Duration
+	// MirrorStaticAssets serves GitHub's emoji images and icons and Google Fonts
+	// from /_static/ with immutable cache headers, pointing references in the
+	// widget, API responses and stylesheets there.
+	MirrorStaticAssets bool
+	// Tenants lets one proxy serve several sites with their own settings,
+	// selected by the site query parameter or the embedding page's origin.
+	Tenants []Tenant
+	// Profiles are bundles of widget settings selected with ?profile=NAME.
+	Profiles []Profile
+	// Snapshot serves /snapshot, a crawlable HTML rendering of a discussion's
+	// comments, cached for SnapshotCacheTTL (default 10m).
+	Snapshot         bool
+	SnapshotCacheTTL time.Duration
+	// FeedRepo (OWNER/NAME) serves the newest comments of the repository's
+	// discussions, optionally only those in FeedCategory, as RSS, Atom and JSON
+	// feeds under /feed/. It reads them with GitHubToken, which is required, and
+	// caches feeds for FeedCacheTTL (default 5m).
+	FeedRepo     string
+	FeedCategory string
+	FeedCacheTTL time.Duration
+	// GitHubWebhookSecret and WebhookRelayURL enable /hooks/github, which
+	// accepts GitHub webhooks signed with the secret and posts a notification
+	// about each discussion_comment event to the URL. WebhookRelayFormat is
+	// RelaySlack, RelayDiscord or RelayJSON, by default picked from the URL.
+	GitHubWebhookSecret string
+	WebhookRelayURL     string
+	WebhookRelayFormat  string
+	// PinClientSHA256 (hex SHA-256 of upstream /client.js) and PinWidgetBuildID
+	// (the widget's Next.js buildId) pin known-good giscus versions. Upstream
+	// content that diverges is reported, and the last matching copy kept in the
+	// cache is served instead.
+	PinClientSHA256  string
+	PinWidgetBuildID string
+	// RemoteThemes routes custom theme URLs in widget requests through
+	// /remote-theme, which only fetches public https stylesheets, optionally
+	// only from RemoteThemeHosts (exact hosts or "*.example.com"), and caches
+	// them for RemoteThemeCacheTTL (default 1h).
+	RemoteThemes        bool
+	RemoteThemeHosts    []string
+	RemoteThemeCacheTTL time.Duration
+	// ReactionsCacheTTL is how long /reactions caches a summary (default 1m).
+	ReactionsCacheTTL time.Duration
+	// Preview enables the /preview playground page.
+	Preview bool
+	// HideVersion drops the /version endpoint and the version response header.
+	HideVersion bool
+	// StripTelemetry removes known analytics scripts and beacons from the widget and
+	// scripts, and answers first-party beacon endpoints locally.
+	StripTelemetry bool
+	// DisableFooterRemoval keeps the "powered by giscus" footer in the widget.
+	DisableFooterRemoval bool
+	// DisableBasePathRewrite leaves root-relative URLs in the widget, text assets
+	// and client script alone when BasePath is set, for a front server that
+	// rewrites them itself.
+	DisableBasePathRewrite bool
+	// SRI controls integrity attributes in the widget HTML: SRIAuto (default),
+	// SRIKeep, SRIStrip or SRIRecompute.
+	SRI string
+	// Minify lists media types ("text/html", "text/css") whose transformed bodies are
+	// minified before being served.
+	Minify []string
+	// TransformContentTypes opts passthrough responses whose media type starts with one
+	// of these prefixes (e.g. "text/html", "application/javascript") into the
+	// server-side Replacements. Transformed bodies are served decoded.
+	TransformContentTypes []string
+	// DOMRules are "SELECTOR => ACTION [ARGS]" operations applied to the parsed
+	// widget HTML before any string replacements run.
+	DOMRules []string
+	// NextDataOverrides are structured edits ("PATH=JSON" or "strings:OLD=>NEW")
+	// applied to the widget's __NEXT_DATA__ JSON payload.
+	NextDataOverrides []string
+	// Snippets are HTML fragments injected into the widget document.
+	Snippets []Snippet
+	// Transformers are custom body rewrites run in order after the built-in ones;
+	// see Transformer.
+	Transformers []Transformer
+	// BaseHref, RobotsMeta and ReferrerPolicy inject <base href>, <meta name="robots">
+	// and <meta name="referrer"> tags at the start of the widget's <head>.
+	BaseHref       string
+	RobotsMeta     string
+	ReferrerPolicy string
 }
 
 // Proxy coordinates the handlers that proxy traffic to giscus.
 type Proxy struct {
 	upstreamOrigin   string
+	apiOrigin        string
+	publicOrigin     string
+	basePath         string
+	baseReplacers    []replacer
 	widgetSourcePath string
 	widgetPaths      []string
 	cacheHeaders     []string
 	client           HTTPClient
 	cache            cache.Cache
 	logger           *log.Logger
+	logLevel         logLevel
+	replacers        []replacer
+	queryReplacers   bool
+	repCache         *replacerCache
+	repAllowlist     []*regexp.Regexp
+	signingKey       string
+	transformTypes   []string
+	passthroughPaths pathRules
+	headerPolicy     headerPolicy
+	preview          bool
+	hideVersion      bool
+	stripTelemetry   bool
+	removeFooter     bool
+	authProxy        bool
+	authCallbacks    bool
+	github           *githubDirect
+	mirrors          []mirror
+	tenants          []*tenant
+	profiles         map[string]*profile
+	snapshot         bool
+	feed             *feed
+	relay            *webhookRelay
+	pins             *pins
+	remoteThemes     *remoteThemes
+	reactionsTTL     time.Duration
+	snapshotTTL      time.Duration
+	sri              string
+	sriSums          sriSums
+	minify           []string
+	allowedOrigins   []originPattern
+	allowedSites     []originPattern
+	allowEmptyRef    bool
+	bots             botFilter
+	clientIP         *middleware.ClientIP
+	rateLimiter      *middleware.RateLimiter
+	inFlight         *middleware.InFlight
+	active           atomic.Int64
+	draining         atomic.Bool
+	done             chan struct{}
+	closeOnce        sync.Once
+	serveOnce        sync.Once
+	served           http.Handler
+	background       sync.WaitGroup
+	vars             *expvar.Map
+	stats            *pathStats
+	requestID        *middleware.RequestID
+	metrics          *PrometheusRecorder
+	recorder         MetricsRecorder
+	tracer           trace.Tracer
+	clock            clock.Clock
+	reporter         ErrorReporter
+	errorHandler     ErrorHandler
+	readyTimeout     time.Duration
+	readiness        readiness
+	metricsPath      string
+	summary          *summary
+	slowThreshold    time.Duration
+	ipFilter         *middleware.IPFilter
+	security         *middleware.SecurityHeaders
+	adminAuth        middleware.AdminAuth
+	siteAuth         middleware.SiteAuth
+	adminPrefix      string
+	pprof            bool
+	capture          *capture
+	auditLogger      *log.Logger
+	redact           map[string]bool
+	lightTheme       string
+	darkTheme        string
+	domRules         []domRule
+	nextData         []nextDataOverride
+	snippets         []Snippet
+	transformers     []Transformer
+	middleware       []func(http.Handler) http.Handler
 }
 
 // New constructs a Proxy from the provided configuration, applying sensible defaults.
 func New(cfg Config) *Proxy {
 	p := &Proxy{
+		done:             make(chan struct{}),
+		clock:            clock.Or(cfg.Clock),
 		upstreamOrigin:   cfg.UpstreamOrigin,
+		apiOrigin:        strings.TrimRight(cfg.APIOrigin, "/"),
+		publicOrigin:     strings.TrimRight(cfg.PublicOrigin, "/"),
+		basePath:         cleanBasePath(cfg.BasePath),
 		widgetSourcePath: cfg.WidgetSourcePath,
 		widgetPaths:      append([]string(nil), cfg.WidgetPaths...),
 		cacheHeaders:     append([]string(nil), cfg.CacheHeaders...),
 		client:           cfg.Client,
 		cache:            cfg.Cache,
 		logger:           cfg.Logger,
+		queryReplacers:   !cfg.DisableQueryReplacements,
+		repCache:         newReplacerCache(maxReplacerSets),
+		signingKey:       cfg.WidgetSigningKey,
+		preview:          cfg.Preview,
+		hideVersion:      cfg.HideVersion,
+		passthroughPaths: newPathRules(cfg.PassthroughAllow, cfg.PassthroughDeny),
+		headerPolicy:     newHeaderPolicy(cfg.ForwardHeaders, cfg.StripHeaders),
+		allowedOrigins:   parseOriginPatterns(cfg.AllowedOrigins),
+		allowedSites:     parseOriginPatterns(cfg.AllowedSites),
+		allowEmptyRef:    cfg.AllowEmptyReferer,
+		adminAuth:        middleware.AdminAuth{Token: cfg.AdminToken, User: cfg.AdminUser, Password: cfg.AdminPassword},
+		adminPrefix:      strings.TrimRight(cfg.AdminPrefix, "/"),
+		pprof:            cfg.Pprof,
+		auditLogger:      cfg.AuditLogger,
+		redact:           newRedactNames(cfg.RedactNames),
+		lightTheme:       cfg.LightTheme,
+		darkTheme:        cfg.DarkTheme,
+		stripTelemetry:   cfg.StripTelemetry,
+		removeFooter:     !cfg.DisableFooterRemoval,
+		authProxy:        !cfg.DisableAuthProxy,
+		authCallbacks:    cfg.RewriteAuthCallback,
+		readyTimeout:     cfg.ReadyTimeout,
+		reporter:         cfg.ErrorReporter,
+		errorHandler:     cfg.ErrorHandler,
+		slowThreshold:    cfg.SlowThreshold,
 	}
 
 	if p.upstreamOrigin == "" {
 		p.upstreamOrigin = "https://giscus.app"
 	}
+	if !cfg.DisableBasePathRewrite {
+		p.baseReplacers = basePathReplacers(p.basePath)
+	}
 	if p.widgetSourcePath == "" {
 		p.widgetSourcePath = "/en/widget"
 	}
 	if len(p.widgetPaths) == 0 {
 		p.widgetPaths = []string{"/widget", "/en/widget"}
 	}
+	if p.readyTimeout <= 0 {
+		p.readyTimeout = 3 * time.Second
+	}
+	if p.adminPrefix == "" {
+		p.adminPrefix = "/_admin"
+	}
+	if p.lightTheme == "" {
+		p.lightTheme = "light"
+	}
+	if p.darkTheme == "" {
+		p.darkTheme = "dark"
+	}
 	if len(p.cacheHeaders) == 0 {
 		p.cacheHeaders = []string{"Content-Type", "Content-Encoding", "Cache-Control", "ETag", "Last-Modified", "Vary"}
 	}
+	if cfg.Clock != nil {
+		if c, ok := cache.As[interface{ SetClock(clock.Clock) }](p.cache); ok {
+			c.SetClock(cfg.Clock)
+		}
+	}
 	if p.client == nil {
-		p.client = &http.Client{Timeout: 25 * time.Second}
+		timeout := cfg.UpstreamTimeout
+		if timeout <= 0 {
+			timeout = 25 * time.Second
+		}
+		p.client = &http.Client{Timeout: timeout}
+	}
+	if cfg.ProxyAvatars {
+		ttl := cfg.AvatarCacheTTL
+		if ttl <= 0 {
+			ttl = defaultAvatarTTL
+		}
+		p.mirrors = append(p.mirrors, mirror{route: "/avatars/", name: "avatars", origin: avatarOrigin, ttl: ttl})
+	}
+	if cfg.MirrorStaticAssets {
+		p.mirrors = append(p.mirrors, staticMirrors...)
+	}
+	if cfg.GitHubToken != "" {
+		p.github = &githubDirect{token: cfg.GitHubToken, endpoint: cfg.GitHubGraphQLURL, ttl: cfg.GitHubCacheTTL}
+		for _, repo := range cfg.GitHubRepos {
+			if repo = strings.ToLower(strings.TrimSpace(repo)); repo != "" {
+				p.github.repos = append(p.github.repos, repo)
+			}
+		}
+		if p.github.endpoint == "" {
+			p.github.endpoint = DefaultGitHubGraphQLURL
+		}
+		if p.github.ttl <= 0 {
+			p.github.ttl = defaultDirectTTL
+		}
+	}
+	p.reactionsTTL = cfg.ReactionsCacheTTL
+	if p.reactionsTTL <= 0 {
+		p.reactionsTTL = defaultReactionsTTL
+	}
+	if cfg.RemoteThemes {
+		p.remoteThemes = newRemoteThemes(cfg.RemoteThemeHosts, cfg.RemoteThemeCacheTTL)
+	}
+	if hc, ok := p.client.(*http.Client); ok && p.authProxy {
+		p.client = keepAuthRedirects(hc)
 	}
 	if p.logger == nil {
 		p.logger = log.Default()
 	}
+	lvl, err := parseLogLevel(cfg.LogLevel)
+	if err != nil {
+		p.warnf("%v, using info", err)
+	}
+	p.logLevel = lvl
+	for _, err := range cfg.problems() {
+		p.warnf("invalid config: %v", err)
+	}
+	if len(cfg.Replacements) > 0 {
+		reps, err := parseReplacers(cfg.Replacements)
+		if err != nil {
+			p.warnf("ignoring server-side replacements: %v", err)
+		} else {
+			p.replacers = reps
+		}
+	}
+	p.replacers = append(p.replacers, stringOverrideReplacers(cfg.StringOverrides)...)
+	p.tenants = p.newTenants(cfg)
+	p.profiles = p.newProfiles(cfg.Profiles)
+	if cfg.FeedRepo != "" {
+		owner, name, ok := strings.Cut(strings.TrimSpace(cfg.FeedRepo), "/")
+		switch {
+		case !ok || owner == "" || name == "":
+			p.warnf("ignoring FeedRepo %q: must be OWNER/NAME", cfg.FeedRepo)
+		case p.github == nil:
+			p.warnf("ignoring FeedRepo: feeds need GitHubToken")
+		default:
+			p.feed = &feed{owner: owner, name: name, category: cfg.FeedCategory, ttl: cfg.FeedCacheTTL}
+			if p.feed.ttl <= 0 {
+				p.feed.ttl = defaultFeedTTL
+			}
+		}
+	}
+	switch {
+	case cfg.GitHubWebhookSecret == "" && cfg.WebhookRelayURL == "":
+	case cfg.GitHubWebhookSecret == "" || cfg.WebhookRelayURL == "":
+		p.warnf("ignoring webhook relay: set both GitHubWebhookSecret and WebhookRelayURL")
+	default:
+		p.relay = newWebhookRelay(cfg.GitHubWebhookSecret, cfg.WebhookRelayURL, cfg.WebhookRelayFormat)
+	}
+	if cfg.Snapshot {
+		p.snapshot = true
+		p.snapshotTTL = cfg.SnapshotCacheTTL
+		if p.snapshotTTL <= 0 {
+			p.snapshotTTL = defaultSnapshotTTL
+		}
+	}
+	for _, t := range cfg.TransformContentTypes {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			p.transformTypes = append(p.transformTypes, t)
+		}
+	}
+	for _, pat := range cfg.QueryReplacementAllowlist {
+		re, err := regexp.Compile("^(?:" + pat + ")$")
+		if err != nil {
+			// Fail closed: an unusable allowlist must not silently allow everything.
+			p.warnf("invalid rep allowlist pattern %q, disabling query replacements: %v", pat, err)
+			p.queryReplacers = false
+			p.repAllowlist = nil
+			break
+		}
+		p.repAllowlist = append(p.repAllowlist, re)
+	}
+	clientIP, err := middleware.NewClientIP(cfg.TrustedProxies)
+	if err != nil {
+		p.warnf("ignoring trusted proxies: %v", err)
+		clientIP, _ = middleware.NewClientIP(nil)
+	}
+	p.clientIP = clientIP
+	p.requestID = middleware.NewRequestID(p.clientIP)
+	if len(cfg.IPAllow) > 0 || len(cfg.IPDeny) > 0 {
+		f, err := middleware.NewIPFilter(cfg.IPAllow, cfg.IPDeny, p.clientIP)
+		if err != nil {
+			// Fail closed: a typo in an allow list must not open the proxy to everyone.
+			p.warnf("invalid IP filter, rejecting all clients: %v", err)
+			f = middleware.RejectAll()
+		}
+		p.ipFilter = f
+	}
+	if cfg.Capture && p.adminAuth.Enabled() {
+		p.capture = &capture{clock: p.clock}
+		p.client = &captureClient{HTTPClient: p.client, p: p}
+	}
+	if cfg.TracerProvider != nil {
+		p.tracer = cfg.TracerProvider.Tracer(tracerName)
+		p.client = &tracingClient{HTTPClient: p.client, tracer: p.tracer, redact: p.redactURL}
+	} else {
+		p.tracer = noop.NewTracerProvider().Tracer(tracerName)
+	}
+	if cfg.Metrics {
+		p.metrics = NewPrometheusRecorder()
+		p.metrics.instrument(p.cache, &p.active)
+		p.metricsPath = cfg.MetricsPath
+		if p.metricsPath == "" {
+			p.metricsPath = "/metrics"
+		}
+	}
+	if cfg.SummaryInterval > 0 {
+		p.summary = &summary{}
+		p.background.Go(func() { p.logSummaries(cfg.SummaryInterval) })
+	}
+	if cfg.Expvar {
+		p.vars = p.newVars()
+	}
+	var recs recorders
+	if p.metrics != nil {
+		recs = append(recs, p.metrics)
+	}
+	if cfg.StatsD != nil {
+		recs = append(recs, statsdMetrics{c: cfg.StatsD})
+	}
+	if p.vars != nil {
+		recs = append(recs, varsRecorder{p.vars})
+	}
+	if p.summary != nil {
+		recs = append(recs, p.summary)
+	}
+	if cfg.MetricsRecorder != nil {
+		recs = append(recs, cfg.MetricsRecorder)
+	}
+	p.recorder = NopRecorder{}
+	if len(recs) > 0 {
+		p.recorder = recs
+	}
+	if cfg.Stats {
+		window := cfg.StatsWindow
+		if window <= 0 {
+			window = time.Hour
+		}
+		p.stats = newPathStats(window)
+	}
+	if len(recs) > 0 {
+		p.client = &observedClient{HTTPClient: p.client, observe: p.recorder.ObserveUpstream}
+	}
+	if cfg.UpstreamRPS > 0 {
+		p.client = &budgetClient{HTTPClient: p.client, limiter: middleware.NewRateLimiter(cfg.UpstreamRPS, cfg.UpstreamBurst, nil)}
+	}
+	if cfg.ModifyUpstreamRequest != nil || cfg.OnUpstreamRequest != nil || cfg.OnUpstreamResponse != nil {
+		p.client = &hookClient{
+			HTTPClient: p.client,
+			modify:     cfg.ModifyUpstreamRequest,
+			onRequest:  cfg.OnUpstreamRequest,
+			onResponse: cfg.OnUpstreamResponse,
+		}
+	}
+	if cfg.PinClientSHA256 != "" || cfg.PinWidgetBuildID != "" {
+		p.pins = &pins{clientSHA256: strings.ToLower(strings.TrimSpace(cfg.PinClientSHA256)), widgetBuildID: strings.TrimSpace(cfg.PinWidgetBuildID)}
+		if p.cache == nil {
+			p.warnf("pins without a cache only report divergent upstream content")
+		}
+		p.client = &pinClient{HTTPClient: p.client, p: p}
+	}
+	p.bots.blockEmpty = cfg.BlockEmptyUserAgent
+	p.bots.allow = p.compileUserAgentPatterns("allowed", cfg.AllowUserAgents)
+	if cfg.BlockBots {
+		p.bots.block = p.compileUserAgentPatterns("blocked", DefaultBotUserAgents)
+	}
+	p.bots.block = append(p.bots.block, p.compileUserAgentPatterns("blocked", cfg.BlockUserAgents)...)
+	p.siteAuth = middleware.SiteAuth{
+		User:     cfg.SiteUser,
+		Password: cfg.SitePassword,
+		Token:    cfg.SiteToken,
+		Exempt:   []string{"/healthz", "/readyz", "/version", p.adminPrefix + "/", "/debug/", "/hooks/"},
+	}
+	if p.pprof && !p.adminAuth.Enabled() {
+		p.warnf("pprof requires admin credentials, not registering /debug/pprof/")
+	}
+	if p.vars != nil && !p.adminAuth.Enabled() {
+		p.warnf("expvar requires admin credentials, not registering /debug/vars")
+	}
+	if cfg.Capture && !p.adminAuth.Enabled() {
+		p.warnf("capture requires admin credentials, not registering %s/capture", p.adminPrefix)
+	}
+	if p.stats != nil && !p.adminAuth.Enabled() {
+		p.warnf("stats require admin credentials, not registering %s/stats", p.adminPrefix)
+	}
+	if cfg.MaxInFlight > 0 {
+		p.inFlight = middleware.NewInFlight(cfg.MaxInFlight)
+	}
+	if cfg.RateLimitRPS > 0 {
+		p.rateLimiter = middleware.NewRateLimiter(cfg.RateLimitRPS, cfg.RateLimitBurst, p.clientIP)
+	}
+	if cfg.SecurityHeaders {
+		sec := middleware.DefaultSecurityHeaders()
+		if cfg.ContentSecurityPolicy != "" {
+			sec.ContentSecurityPolicy = cfg.ContentSecurityPolicy
+		}
+		p.security = &sec
+	}
+	sri, err := normalizeSRI(cfg.SRI)
+	if err != nil {
+		p.warnf("%v, using auto", err)
+		sri = SRIAuto
+	}
+	p.sri = sri
+	if p.minify, err = normalizeMinify(cfg.Minify); err != nil {
+		p.warnf("ignoring minify settings: %v", err)
+	}
+	if len(cfg.DOMRules) > 0 {
+		rules, err := parseDOMRules(cfg.DOMRules)
+		if err != nil {
+			p.warnf("ignoring dom rules: %v", err)
+		} else {
+			p.domRules = rules
+		}
+	}
+	if len(cfg.NextDataOverrides) > 0 {
+		ovs, err := parseNextDataOverrides(cfg.NextDataOverrides)
+		if err != nil {
+			p.warnf("ignoring next data overrides: %v", err)
+		} else {
+			p.nextData = ovs
+		}
+	}
+	if meta := metaSnippet(cfg); meta.HTML != "" {
+		cfg.Snippets = append([]Snippet{meta}, cfg.Snippets...)
+	}
+	if len(cfg.Snippets) > 0 {
+		snippets, err := normalizeSnippets(cfg.Snippets)
+		if err != nil {
+			p.warnf("ignoring snippets: %v", err)
+		} else {
+			p.snippets = snippets
+		}
+	}
+	for _, t := range cfg.Transformers {
+		if t != nil {
+			p.transformers = append(p.transformers, t)
+		}
+	}
 
 	return p
 }
 
+// Use adds middleware to every route the proxy registers, for example the
+// embedder's own authentication, rate limiting or logging. Middleware runs in
+// the order added, inside the proxy's built-in middleware; call Use before
+// Register or Handler. The health probes Handler answers early skip it.
+func (p *Proxy) Use(mw ...func(http.Handler) http.Handler) {
+	p.middleware = append(p.middleware, mw...)
+}
+
 // Register attaches the proxy handlers to the provided mux.
 func (p *Proxy) Register(mux *http.ServeMux) {
-	for _, path := range p.widgetPaths {
-		mux.HandleFunc(path, p.handleWidget)
+	for _, rt := range p.Routes() {
+		mux.Handle(rt.Pattern, rt.Handler)
 	}
-	mux.HandleFunc("/", p.handlePassthrough)
 }
 
-// Handler returns a ready-to-use HTTP handler that serves the proxy.
+// Handler returns a ready-to-use HTTP handler that serves the proxy, wrapped in
+// the configured middleware.
 func (p *Proxy) Handler() http.Handler {
 	mux := http.NewServeMux()
 	p.Register(mux)
-	return mux
+	return p.mountBasePath(p.builtin(mux, true))
 }
 
-func (p *Proxy) logf(format string, args ...any) {
-	if p.logger == nil {
-		log.Printf(format, args...)
-		return
+// Middleware wraps h in the proxy's built-in middleware: request IDs, panic
+// recovery, connection and rate limits, IP filtering, security headers, site
+// authentication and the version header. Use it on a router group holding the
+// Routes; the base path and the early health probes are left to the router.
+func (p *Proxy) Middleware(h http.Handler) http.Handler {
+	return p.builtin(h, false)
+}
+
+// builtin wraps h in the built-in middleware, answering the health probes ahead
+// of it when probes is set.
+func (p *Proxy) builtin(h http.Handler, probes bool) http.Handler {
+	if p.siteAuth.Enabled() {
+		h = p.siteAuth.Middleware(h)
+	}
+	if p.security != nil {
+		h = p.security.Middleware(h)
+	}
+	if p.rateLimiter != nil {
+		h = p.rateLimiter.Middleware(h)
+	}
+	if p.ipFilter != nil {
+		h = p.ipFilter.Middleware(h)
+	}
+	if p.inFlight != nil {
+		h = p.inFlight.Middleware(h)
+	}
+	h = middleware.Recoverer{OnPanic: p.recovered, Respond: p.panicResponse}.Middleware(h)
+	h = p.requestID.Middleware(h)
+	if probes {
+		h = p.healthBypass(h)
+	}
+	if !p.hideVersion {
+		h = p.versionHeader(h)
+	}
+	return h
+}
+
+// ServeHTTP serves the proxy, so a *Proxy can be mounted on any router. It builds
+// the Handler on first use; call Use before the first request.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.serveOnce.Do(func() { p.served = p.Handler() })
+	p.served.ServeHTTP(w, r)
+}
+
+// Drain marks the proxy as shutting down: /readyz starts failing so load
+// balancers stop sending new traffic, while requests keep being served.
+func (p *Proxy) Drain() {
+	p.draining.Store(true)
+}
+
+// Draining reports whether Drain has been called, by the process or through the
+// admin API.
+func (p *Proxy) Draining() bool {
+	return p.draining.Load()
+}
+
+// Close stops the proxy's background work, logging a final summary when periodic
+// summaries are enabled. Call it once the server has stopped serving.
+func (p *Proxy) Close() {
+	p.closeOnce.Do(func() { close(p.done) })
+	p.background.Wait()
+}
+
+// repAllowed reports whether a raw rep query value passes the allowlist.
+func (p *Proxy) repAllowed(raw string) bool {
+	if len(p.repAllowlist) == 0 {
+		return true
+	}
+	for _, re := range p.repAllowlist {
+		if re.MatchString(raw) {
+			return true
+		}
+	}
+	return false
+}
+
+// passthroughTransforms reports whether any passthrough response may be rewritten.
+func (p *Proxy) passthroughTransforms(r *http.Request) bool {
+	return (len(p.replacers) > 0 && len(p.transformTypes) > 0) || p.stripTelemetry || len(p.minify) > 0 || len(p.baseReplacers) > 0 || len(p.mirrors) > 0 ||
+		len(p.transformers) > 0 || len(requestTransformers(r)) > 0
+}
+
+// transformable reports whether a passthrough response of the given content type is rewritten.
+func (p *Proxy) transformable(r *http.Request, contentType string) bool {
+	return p.replaceable(contentType) || (p.stripTelemetry && telemetryType(contentType)) || p.minifyType(contentType) ||
+		(len(p.mirrors) > 0 && mirrorType(contentType)) ||
+		((len(p.baseReplacers) > 0 || len(p.transformers) > 0 || len(requestTransformers(r)) > 0) && textType(contentType))
+}
+
+// replaceable reports whether the server-side replacements apply to a passthrough content type.
+func (p *Proxy) replaceable(contentType string) bool {
+	if len(p.replacers) == 0 || len(p.transformTypes) == 0 {
+		return false
+	}
+	mt := mediaType(contentType)
+	for _, t := range p.transformTypes {
+		if strings.HasPrefix(mt, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// transformPassthrough applies the passthrough transform stage to a decoded body.
+func (p *Proxy) transformPassthrough(r *http.Request, contentType string, b []byte) []byte {
+	if p.replaceable(contentType) {
+		b = replacements(p.expandReplacers(p.replacers, r, contentType)).Transform(contentType, b)
+	}
+	if len(p.baseReplacers) > 0 && textType(contentType) {
+		b = replacements(p.baseReplacers).Transform(contentType, b)
+		if r.URL.Path == "/client.js" {
+			b = rebaseClient(b, p.basePath)
+		}
+	}
+	if p.stripTelemetry && telemetryType(contentType) {
+		b = stripTelemetry(b, contentType)
 	}
-	p.logger.Printf(format, args...)
+	b = p.rewriteMirrors(r, contentType, b)
+	if textType(contentType) {
+		b = transform(contentType, b, p.transformers...)
+		b = transform(contentType, b, requestTransformers(r)...)
+	}
+	return p.minifyBody(contentType, b)
+}
+
+// bufferedTransforms reports whether any transform needs the whole widget document at once.
+func (p *Proxy) bufferedTransforms(r *http.Request) bool {
+	return len(p.domRules) > 0 || len(p.nextData) > 0 || len(p.snippets) > 0 || len(p.transformers) > 0 ||
+		len(requestTransformers(r)) > 0 || p.stripTelemetry || p.sriActive(r) || p.minifyType("text/html")
 }
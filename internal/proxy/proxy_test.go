@@ -0,0 +1,30 @@
+package proxy
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestProxy returns a proxy in front of an upstream served by h.
+func newTestProxy(t *testing.T, cfg Config, h http.HandlerFunc) *Proxy {
+	t.Helper()
+	up := httptest.NewServer(h)
+	t.Cleanup(up.Close)
+	cfg.UpstreamOrigin = up.URL
+	if cfg.Logger == nil {
+		cfg.Logger = log.New(io.Discard, "", 0)
+	}
+	p := New(cfg)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// serve sends r to p and returns the recorded response.
+func serve(p *Proxy, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, r)
+	return rec
+}
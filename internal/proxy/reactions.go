@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+)
+
+const defaultReactionsTTL = time.Minute
+
+// reactionEmoji lists GitHub's reactions in the order giscus shows them.
+var reactionEmoji = []struct{ content, emoji string }{
+	{"THUMBS_UP", "👍"},
+	{"THUMBS_DOWN", "👎"},
+	{"LAUGH", "😄"},
+	{"HOORAY", "🎉"},
+	{"CONFUSED", "😕"},
+	{"HEART", "❤️"},
+	{"ROCKET", "🚀"},
+	{"EYES", "👀"},
+}
+
+type reactionCount struct {
+	Content string `json:"content"`
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+}
+
+// reactionSummary is what /reactions returns.
+type reactionSummary struct {
+	URL       string          `json:"url"`
+	Total     int             `json:"total"`
+	Comments  int             `json:"comments"`
+	Replies   int             `json:"replies"`
+	Reactions []reactionCount `json:"reactions"`
+}
+
+// handleReactions returns the reaction counts and comment totals of the
+// discussion selected by giscus's parameters as JSON, so sites can show them
+// outside the widget. A discussion that doesn't exist yet has zero counts and
+// an empty url. Summaries are cached for ReactionsCacheTTL.
+func (p *Proxy) handleReactions(w http.ResponseWriter, r *http.Request) {
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	var target string
+	cacheState := "BYPASS"
+	var ph phases
+	r, span := p.startSpan(r, "reactions")
+	defer func() {
+		p.logLine(r, "react", sw.status, sw.written, time.Since(start), cacheState, target)
+		p.logSlow(r, "reactions", sw.status, time.Since(start), &ph)
+		p.endSpan(span, sw.status, cacheState, target)
+	}()
+	w = sw
+
+	if !p.checkOrigin(w, r) || !p.checkSite(w, r) || !p.checkBot(w, r) || !p.checkRepo(w, r) {
+		return
+	}
+	if r.Method == http.MethodOptions {
+		p.writeCORS(w, r)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		p.httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	uq, ok := discussionQuery(r.URL.Query())
+	if !ok {
+		p.httpError(w, r, "repo and term or number are required", http.StatusBadRequest)
+		return
+	}
+	// Comments aren't needed, only their totals.
+	uq.Del("last")
+	uq.Set("first", "1")
+	p.writeCORS(w, r)
+	maxAge := "public, max-age=" + strconv.Itoa(int(p.reactionsTTL.Seconds()))
+	key := "reactions " + uq.Encode() + p.cacheNamespace(r)
+	if p.cacheable(r) {
+		if ent, ok := p.cache.Get(r.Context(), key); ok {
+			cacheState = "HIT"
+			writeMirrored(w, r, ent.Status, ent.Headers, maxAge, ent.Body)
+			return
+		}
+	}
+
+	ph.begin()
+	status, body, err := p.discussion(r, uq, &target)
+	ph.end(&ph.upstream)
+	if err != nil {
+		p.upstreamError(w, r, err)
+		return
+	}
+	if status != http.StatusOK && status != http.StatusNotFound {
+		p.httpError(w, r, fmt.Sprintf("upstream returned %d", status), http.StatusBadGateway)
+		return
+	}
+	var data struct {
+		Discussion struct {
+			URL               string `json:"url"`
+			ReactionCount     int    `json:"reactionCount"`
+			TotalCommentCount int    `json:"totalCommentCount"`
+			TotalReplyCount   int    `json:"totalReplyCount"`
+			Reactions         map[string]struct {
+				Count int `json:"count"`
+			} `json:"reactions"`
+		} `json:"discussion"`
+	}
+	if status == http.StatusOK {
+		if err := json.Unmarshal(body, &data); err != nil {
+			p.httpError(w, r, "failed to parse upstream discussion", http.StatusBadGateway)
+			return
+		}
+	}
+	d := data.Discussion
+	sum := reactionSummary{URL: d.URL, Total: d.ReactionCount, Comments: d.TotalCommentCount, Replies: d.TotalReplyCount}
+	for _, re := range reactionEmoji {
+		sum.Reactions = append(sum.Reactions, reactionCount{Content: re.content, Emoji: re.emoji, Count: d.Reactions[re.content].Count})
+	}
+	out, err := json.Marshal(sum)
+	if err != nil {
+		p.httpError(w, r, "failed to encode reactions", http.StatusInternalServerError)
+		return
+	}
+	h := http.Header{"Content-Type": {"application/json"}}
+	writeMirrored(w, r, http.StatusOK, h, maxAge, out)
+	if p.cacheable(r) {
+		p.cache.Set(r.Context(), key, cache.Entry{Status: http.StatusOK, Headers: h, Body: out, Expires: p.clock.Now().Add(p.reactionsTTL)})
+		cacheState = "MISS:cached"
+	}
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// DefaultRedactNames lists query parameters and headers whose values never reach
+// the logs: credentials, giscus session tokens, OAuth codes and URL signatures.
+var DefaultRedactNames = []string{
+	"token", "access_token", "refresh_token", "id_token", "session", "giscus",
+	"code", "sig", "signature", "key", "secret", "password",
+	"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+}
+
+const redacted = "REDACTED"
+
+// newRedactNames returns the lower-cased set of DefaultRedactNames and names.
+// The defaults always apply, so configuring names can't expose credentials.
+func newRedactNames(names []string) map[string]bool {
+	out := make(map[string]bool, len(DefaultRedactNames)+len(names))
+	for _, n := range slices.Concat(DefaultRedactNames, names) {
+		if n = strings.ToLower(strings.TrimSpace(n)); n != "" {
+			out[n] = true
+		}
+	}
+	return out
+}
+
+// redactURL masks the values of sensitive query parameters in a request URI or
+// absolute URL, leaving everything else byte-for-byte intact.
+func (p *Proxy) redactURL(s string) string {
+	base, query, ok := strings.Cut(s, "?")
+	if !ok || len(p.redact) == 0 {
+		return s
+	}
+	parts := strings.Split(query, "&")
+	for i, part := range parts {
+		k, _, hasValue := strings.Cut(part, "=")
+		name, err := url.QueryUnescape(k)
+		if err != nil {
+			name = k
+		}
+		if hasValue && p.redact[strings.ToLower(name)] {
+			parts[i] = k + "=" + redacted
+		}
+	}
+	return base + "?" + strings.Join(parts, "&")
+}
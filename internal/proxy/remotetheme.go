@@ -0,0 +1,266 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+	"github.com/cdlus/giscus-proxy/internal/middleware"
+)
+
+const (
+	defaultRemoteThemeTTL = time.Hour
+	// maxRemoteTheme bounds remote stylesheets; giscus themes are a few KiB.
+	maxRemoteTheme = 512 << 10
+	// maxThemeRedirects is how many redirects a remote theme may go through,
+	// each one checked like the original URL.
+	maxThemeRedirects = 3
+)
+
+// cgnat is the shared address space (RFC 6598), private in practice.
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// remoteThemes fetches custom theme stylesheets on behalf of the widget.
+type remoteThemes struct {
+	hosts []string // exact hosts or "*.example.com"
+	ttl   time.Duration
+	// lookup resolves hosts to check they are public; swapped in tests.
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+	// client fetches themes. It is separate from the upstream client, whose
+	// budget, capture and pins are about giscus, and without an allowlist it
+	// only connects to public addresses.
+	client *http.Client
+}
+
+func newRemoteThemes(hosts []string, ttl time.Duration) *remoteThemes {
+	rt := &remoteThemes{ttl: ttl, lookup: net.DefaultResolver.LookupIPAddr}
+	for _, h := range hosts {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			rt.hosts = append(rt.hosts, h)
+		}
+	}
+	if rt.ttl <= 0 {
+		rt.ttl = defaultRemoteThemeTTL
+	}
+	rt.client = &http.Client{
+		Transport: newThemeTransport(len(rt.hosts) == 0),
+		// fetchTheme follows redirects itself, checking each hop.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		Timeout:       30 * time.Second,
+	}
+	return rt
+}
+
+// isRemoteTheme reports whether a theme parameter is a stylesheet URL rather
+// than the name of a built-in theme. Plain http themes are left alone; the
+// widget's page would block them as mixed content anyway.
+func isRemoteTheme(theme string) bool {
+	return strings.HasPrefix(theme, "https://")
+}
+
+// remoteThemeURL points a remote theme at /remote-theme.
+func (p *Proxy) remoteThemeURL(r *http.Request, theme string) string {
+	return p.proxyBase(r) + "/remote-theme?url=" + url.QueryEscape(theme)
+}
+
+// listed reports whether host is in the RemoteThemeHosts allowlist.
+func (rt *remoteThemes) listed(host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range rt.hosts {
+		if suffix, ok := strings.CutPrefix(h, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+// check rejects URLs the proxy must not fetch: anything but https on the
+// default port, hosts outside the allowlist when there is one, and hosts
+// resolving to loopback, private or link-local addresses. Listed hosts are
+// trusted without a lookup. The lookup gives a clear early answer; the client's
+// dialer enforces the same rule on the address it connects to.
+func (rt *remoteThemes) check(ctx context.Context, u *url.URL) error {
+	if u.Scheme != "https" || u.Host == "" {
+		return errors.New("theme URL must be https")
+	}
+	if u.User != nil || (u.Port() != "" && u.Port() != "443") {
+		return errors.New("theme URL must not carry credentials or a port")
+	}
+	host := u.Hostname()
+	if len(rt.hosts) > 0 {
+		if !rt.listed(host) {
+			return fmt.Errorf("theme host %s not allowed", host)
+		}
+		return nil
+	}
+	addrs, err := rt.lookup(ctx, host)
+	if err != nil {
+		return fmt.Errorf("resolve theme host: %w", err)
+	}
+	for _, a := range addrs {
+		ip, ok := netip.AddrFromSlice(a.IP)
+		if !ok || !publicAddr(ip.Unmap()) {
+			return fmt.Errorf("theme host %s resolves to a non-public address", host)
+		}
+	}
+	return nil
+}
+
+func publicAddr(ip netip.Addr) bool {
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !cgnat.Contains(ip)
+}
+
+// handleRemoteTheme serves the stylesheet at the url parameter, which widgets
+// using a custom theme load through the proxy instead of from its host. Only
+// public https URLs are fetched, redirects are checked hop by hop, and the
+// response must be a stylesheet (or plain text, as gists serve) of at most
+// 512 KiB. It is always served as text/css and cached for RemoteThemeCacheTTL.
+func (p *Proxy) handleRemoteTheme(w http.ResponseWriter, r *http.Request) {
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	var target string
+	cacheState := "BYPASS"
+	var ph phases
+	r, span := p.startSpan(r, "remote-theme")
+	defer func() {
+		p.logLine(r, "theme", sw.status, sw.written, time.Since(start), cacheState, target)
+		p.logSlow(r, "remote-theme", sw.status, time.Since(start), &ph)
+		p.endSpan(span, sw.status, cacheState, target)
+	}()
+	w = sw
+
+	if !p.checkSite(w, r) || !p.checkBot(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		p.httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	target = r.URL.Query().Get("url")
+	u, err := url.Parse(target)
+	if err != nil || target == "" {
+		p.httpError(w, r, "url must be a theme stylesheet URL", http.StatusBadRequest)
+		return
+	}
+	if err := p.remoteThemes.check(r.Context(), u); err != nil {
+		p.httpError(w, r, err.Error(), http.StatusForbidden)
+		return
+	}
+	maxAge := "public, max-age=" + strconv.Itoa(int(p.remoteThemes.ttl.Seconds()))
+	// Mirrored font URLs in the stylesheet point at the request host.
+	key := "remote-theme " + target + " host=" + r.Host
+	if p.cacheable(r) {
+		if ent, ok := p.cache.Get(r.Context(), key); ok {
+			cacheState = "HIT"
+			writeTheme(w, r, ent.Status, maxAge, ent.Body)
+			return
+		}
+	}
+
+	ph.begin()
+	resp, err := p.fetchTheme(r, u)
+	ph.end(&ph.upstream)
+	if err != nil {
+		var fe *themeError
+		if errors.As(err, &fe) {
+			p.httpError(w, r, fe.msg, fe.status)
+			return
+		}
+		p.upstreamError(w, r, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		p.httpError(w, r, fmt.Sprintf("theme URL returned %d", resp.StatusCode), http.StatusBadGateway)
+		return
+	}
+	if mt := mediaType(resp.Header.Get("Content-Type")); mt != "text/css" && mt != "text/plain" {
+		p.httpError(w, r, "theme URL is not a stylesheet", http.StatusUnsupportedMediaType)
+		return
+	}
+	ph.begin()
+	bin, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteTheme+1))
+	ph.end(&ph.upstream)
+	if err != nil {
+		p.httpError(w, r, "failed to read theme", http.StatusBadGateway)
+		return
+	}
+	if len(bin) > maxRemoteTheme {
+		p.httpError(w, r, "theme stylesheet too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	bin = p.rewriteMirrors(r, "text/css", bin)
+	writeTheme(w, r, http.StatusOK, maxAge, bin)
+	if p.cacheable(r) {
+		p.cache.Set(r.Context(), key, cache.Entry{Status: http.StatusOK, Headers: http.Header{"Content-Type": {"text/css; charset=utf-8"}}, Body: bin, Expires: p.clock.Now().Add(p.remoteThemes.ttl)})
+		cacheState = "MISS:cached"
+	}
+}
+
+// themeError is a rejection of the theme URL or one it redirects to.
+type themeError struct {
+	status int
+	msg    string
+}
+
+func (e *themeError) Error() string { return e.msg }
+
+// fetchTheme GETs u without passing on anything about the visitor, following
+// redirects itself so every hop goes through the same checks.
+func (p *Proxy) fetchTheme(r *http.Request, u *url.URL) (*http.Response, error) {
+	for hop := 0; ; hop++ {
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, &themeError{http.StatusBadRequest, "url must be a theme stylesheet URL"}
+		}
+		req.Header.Set("Accept", "text/css,*/*;q=0.1")
+		req.Header.Set("User-Agent", userAgent)
+		if id := middleware.RequestIDFrom(r.Context()); id != "" {
+			req.Header.Set(middleware.RequestIDHeader, id)
+		}
+		resp, err := p.remoteThemes.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		p.debugUpstream(req, resp)
+		loc := resp.Header.Get("Location")
+		if resp.StatusCode < 300 || resp.StatusCode >= 400 || loc == "" {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if hop == maxThemeRedirects {
+			return nil, &themeError{http.StatusBadGateway, "theme URL redirects too often"}
+		}
+		next, err := u.Parse(loc)
+		if err != nil {
+			return nil, &themeError{http.StatusBadGateway, "theme URL redirects to an invalid location"}
+		}
+		if err := p.remoteThemes.check(r.Context(), next); err != nil {
+			return nil, &themeError{http.StatusForbidden, "theme redirect: " + err.Error()}
+		}
+		u = next
+	}
+}
+
+func writeTheme(w http.ResponseWriter, r *http.Request, status int, cacheControl string, body []byte) {
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", cacheControl)
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// maxReplacerSets bounds how many parsed rep value sets the widget keeps.
+const maxReplacerSets = 256
+
+// replacerCache keeps the most recently used parsed rep value sets, so embeds
+// whose URLs repeat the same rep values skip parsing and regexp compilation.
+// Parse errors are kept too, sparing the complexity checks for repeated bad
+// values. Cached replacer slices are shared and must not be modified.
+type replacerCache struct {
+	mu    sync.Mutex
+	max   int
+	order *list.List // of *replacerSet, most recent first
+	sets  map[string]*list.Element
+}
+
+type replacerSet struct {
+	key  string
+	reps []replacer
+	err  error
+}
+
+func newReplacerCache(max int) *replacerCache {
+	return &replacerCache{max: max, order: list.New(), sets: make(map[string]*list.Element)}
+}
+
+// parse returns parseQueryReplacers(vals), from the cache when it holds vals.
+func (c *replacerCache) parse(vals []string) ([]replacer, error) {
+	key := strings.Join(vals, "\x00")
+	c.mu.Lock()
+	if el, ok := c.sets[key]; ok {
+		c.order.MoveToFront(el)
+		set := el.Value.(*replacerSet)
+		c.mu.Unlock()
+		return set.reps, set.err
+	}
+	c.mu.Unlock()
+
+	reps, err := parseQueryReplacers(vals)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.sets[key]; !ok {
+		c.sets[key] = c.order.PushFront(&replacerSet{key: key, reps: reps, err: err})
+		if c.order.Len() > c.max {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.sets, oldest.Value.(*replacerSet).key)
+		}
+	}
+	return reps, err
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/cdlus/giscus-proxy/internal/middleware"
+)
+
+// ErrorReporter receives failures that visitors only see as degraded responses:
+// upstream errors, transformation errors and recovered panics. Implementations must
+// not block; tags carry the failing stage, path and request ID.
+type ErrorReporter interface {
+	Report(ctx context.Context, err error, tags map[string]string)
+}
+
+// PanicError wraps a value recovered from a panicking handler, with its stack.
+type PanicError struct {
+	Value any
+	stack []byte
+}
+
+func (e *PanicError) Error() string { return fmt.Sprintf("panic: %v", e.Value) }
+
+// Stack returns the goroutine stack captured when the panic was recovered.
+func (e *PanicError) Stack() []byte { return e.stack }
+
+// reportError logs a failure while serving r and hands it to the ErrorReporter.
+func (p *Proxy) reportError(r *http.Request, stage string, err error) {
+	p.errorf("%s failed: %v", stage, err)
+	if p.reporter == nil {
+		return
+	}
+	p.reporter.Report(r.Context(), err, map[string]string{
+		"stage":      stage,
+		"method":     r.Method,
+		"path":       r.URL.Path,
+		"request_id": middleware.RequestIDFrom(r.Context()),
+	})
+}
+
+// recovered reports a panic caught by the recovery middleware.
+func (p *Proxy) recovered(r *http.Request, v any, stack []byte) {
+	p.errorf("panic serving %s: %v\n%s", p.redactURL(r.URL.RequestURI()), v, stack)
+	if p.reporter == nil {
+		return
+	}
+	p.reporter.Report(r.Context(), &PanicError{Value: v, stack: stack}, map[string]string{
+		"stage":      "panic",
+		"method":     r.Method,
+		"path":       r.URL.Path,
+		"request_id": middleware.RequestIDFrom(r.Context()),
+	})
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestOptions override proxy settings for a single request. Embedders attach
+// them to the request context with WithRequestOptions before handing the request
+// to the proxy, e.g. to route some sites to another upstream.
+type RequestOptions struct {
+	// UpstreamOrigin replaces Config.UpstreamOrigin, and Config.APIOrigin for
+	// /api/ requests.
+	UpstreamOrigin string
+	// Transformers run after Config.Transformers on this request's widget
+	// document or passthrough response. Such responses are never cached, since
+	// other requests wouldn't get the same rewrites.
+	Transformers []Transformer
+	// NoCache neither reads nor stores cached responses.
+	NoCache bool
+	// CacheTTL, when positive, stores the response for this long regardless of
+	// the upstream max-age.
+	CacheTTL time.Duration
+}
+
+type requestOptionsKey struct{}
+
+// WithRequestOptions returns a copy of ctx carrying opts for the proxy.
+func WithRequestOptions(ctx context.Context, opts RequestOptions) context.Context {
+	return context.WithValue(ctx, requestOptionsKey{}, opts)
+}
+
+// RequestOptionsFrom returns the options attached to ctx, or the zero value.
+func RequestOptionsFrom(ctx context.Context) RequestOptions {
+	opts, _ := ctx.Value(requestOptionsKey{}).(RequestOptions)
+	return opts
+}
+
+// upstreamFor returns the upstream origin serving r: the tenant's when it sets
+// one, the API origin for /api/ requests when one is configured, otherwise the
+// widget origin.
+func (p *Proxy) upstreamFor(r *http.Request) string {
+	return p.upstreamForPath(r, r.URL.Path)
+}
+
+// upstreamForPath is upstreamFor for a request to path on behalf of r.
+func (p *Proxy) upstreamForPath(r *http.Request, path string) string {
+	if o := RequestOptionsFrom(r.Context()).UpstreamOrigin; o != "" {
+		return strings.TrimRight(o, "/")
+	}
+	if t := p.tenantFor(r); t != nil && t.upstream != "" {
+		return t.upstream
+	}
+	if p.apiOrigin != "" && strings.HasPrefix(path, "/api/") {
+		return p.apiOrigin
+	}
+	return p.upstreamOrigin
+}
+
+// requestTransformers returns the transformers attached to r.
+func requestTransformers(r *http.Request) []Transformer {
+	return RequestOptionsFrom(r.Context()).Transformers
+}
+
+// cacheable reports whether r may use the shared cache.
+func (p *Proxy) cacheable(r *http.Request) bool {
+	opts := RequestOptionsFrom(r.Context())
+	return p.cache != nil && !opts.NoCache && len(opts.Transformers) == 0
+}
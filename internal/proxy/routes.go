@@ -0,0 +1,74 @@
+package proxy
+
+import "net/http"
+
+// Route is one entry of the proxy's route table.
+type Route struct {
+	// Pattern uses ServeMux syntax: a trailing slash matches the whole subtree,
+	// and "/" is the passthrough catch-all.
+	Pattern string
+	// Name identifies the route, e.g. "widget", "api", "passthrough" or "admin/purge".
+	Name    string
+	Handler http.Handler
+}
+
+// Routes returns the route table Register installs, with the passthrough
+// catch-all last, for mounting on other routers. Handlers include the Use
+// middleware but not the built-in middleware; wrap them with Middleware.
+func (p *Proxy) Routes() []Route {
+	rt := routeTable{middleware: p.middleware}
+	for _, path := range p.widgetPaths {
+		rt.add(path, "widget", p.track(p.requireSignature(p.handleWidget)))
+	}
+	rt.add("/widget/auto", "widget_auto", p.track(p.requireSignature(p.handleAutoTheme)))
+	rt.add("/lazy.js", "lazy", p.track(p.handleLazy))
+	rt.add("/reactions", "reactions", p.track(p.handleReactions))
+	if p.remoteThemes != nil {
+		rt.add("/remote-theme", "remote_theme", p.track(p.handleRemoteTheme))
+	}
+	if p.preview {
+		rt.add("/preview", "preview", p.track(p.handlePreview))
+	}
+	if p.snapshot {
+		rt.add("/snapshot", "snapshot", p.track(p.handleSnapshot))
+	}
+	rt.add("/healthz", "healthz", http.HandlerFunc(p.handleHealth))
+	rt.add("/readyz", "readyz", http.HandlerFunc(p.handleReady))
+	if !p.hideVersion {
+		rt.add("/version", "version", http.HandlerFunc(p.handleVersion))
+	}
+	if p.metrics != nil {
+		rt.add(p.metricsPath, "metrics", p.metrics.Handler())
+	}
+	p.registerAdmin(&rt)
+	if p.authProxy {
+		rt.add("/api/", "api", p.track(p.handleAPI))
+	}
+	for _, m := range p.mirrors {
+		rt.add(m.route, m.name, p.track(p.handleMirror(m)))
+	}
+	if p.github != nil {
+		rt.add("/api/discussions", "discussions", p.track(p.handleDiscussions))
+	}
+	if p.feed != nil {
+		rt.add("/feed/", "feed", p.track(p.handleFeed))
+	}
+	if p.relay != nil {
+		rt.add("/hooks/github", "hook", p.track(p.handleGitHubHook))
+	}
+	rt.add("/", "passthrough", p.track(p.handlePassthrough))
+	return rt.routes
+}
+
+// routeTable collects routes, wrapping each in the Use middleware.
+type routeTable struct {
+	middleware []func(http.Handler) http.Handler
+	routes     []Route
+}
+
+func (rt *routeTable) add(pattern, name string, h http.Handler) {
+	for i := len(rt.middleware) - 1; i >= 0; i-- {
+		h = rt.middleware[i](h)
+	}
+	rt.routes = append(rt.routes, Route{Pattern: pattern, Name: name, Handler: h})
+}
@@ -0,0 +1,41 @@
+//go:build !js
+
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/server"
+)
+
+// serveShutdownTimeout bounds how long ServeListener lets in-flight requests
+// finish once its context is cancelled.
+const serveShutdownTimeout = 25 * time.Second
+
+// Server returns an http.Server for p.Handler() with the proxy's logger and the
+// same header timeout as the binary. Callers set Addr, TLSConfig or further
+// limits before serving it.
+func (p *Proxy) Server() *http.Server {
+	return &http.Server{
+		Handler:           p.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		ErrorLog:          p.logger,
+	}
+}
+
+// ServeListener serves the proxy on ln, which the caller owns: wrap it with
+// tls.NewListener for TLS, or pass a socket from a supervisor or test. When ctx
+// is cancelled readiness starts failing, in-flight requests get up to 25s to
+// finish and the proxy is closed. A clean shutdown returns nil.
+func (p *Proxy) ServeListener(ctx context.Context, ln net.Listener) error {
+	srv := p.Server()
+	err := server.Drain{Timeout: serveShutdownTimeout}.Run(ctx, srv, func() error { return srv.Serve(ln) }, func() {
+		p.Drain()
+		srv.SetKeepAlivesEnabled(false)
+	})
+	p.Close()
+	return err
+}
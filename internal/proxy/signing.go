@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SignWidgetURL returns the query for a widget URL signed with key. The signature
+// covers the path and every query parameter, including the optional expiry; pass
+// the zero time for URLs that never expire.
+func SignWidgetURL(key, path string, q url.Values, exp time.Time) url.Values {
+	out := url.Values{}
+	for k, vs := range q {
+		if k != "sig" {
+			out[k] = append([]string(nil), vs...)
+		}
+	}
+	if !exp.IsZero() {
+		out.Set("exp", strconv.FormatInt(exp.Unix(), 10))
+	}
+	out.Set("sig", widgetSignature(key, path, out))
+	return out
+}
+
+func widgetSignature(key, path string, q url.Values) string {
+	unsigned := url.Values{}
+	for k, vs := range q {
+		if k != "sig" {
+			unsigned[k] = vs
+		}
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(path + "?" + unsigned.Encode()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyWidgetSignature checks the sig and exp parameters of a widget request.
+func (p *Proxy) verifyWidgetSignature(r *http.Request) (bool, string) {
+	q := r.URL.Query()
+	sig := q.Get("sig")
+	if sig == "" {
+		return false, "missing signature"
+	}
+	want := widgetSignature(p.signingKey, r.URL.Path, q)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return false, "invalid signature"
+	}
+	if exp := q.Get("exp"); exp != "" {
+		secs, err := strconv.ParseInt(exp, 10, 64)
+		if err != nil || p.clock.Now().Unix() > secs {
+			return false, "signature expired"
+		}
+	}
+	return true, ""
+}
+
+// requireSignature rejects widget requests without a valid signature when a signing key is configured.
+func (p *Proxy) requireSignature(next http.HandlerFunc) http.HandlerFunc {
+	if p.signingKey == "" {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodOptions {
+			if ok, reason := p.verifyWidgetSignature(r); !ok {
+				p.logLine(r, "widget", http.StatusForbidden, 0, 0, "", reason)
+				p.httpError(w, r, reason, http.StatusForbidden)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
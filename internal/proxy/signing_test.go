@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/clock"
+)
+
+func TestWidgetSignature(t *testing.T) {
+	const key = "secret"
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	clk := clock.NewFake(now)
+	p := newTestProxy(t, Config{WidgetSigningKey: key, Clock: clk}, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = io.WriteString(w, "widget")
+	})
+
+	params := url.Values{"repo": {"o/r"}, "term": {"a b"}, "sig": {"stale"}}
+	signed := SignWidgetURL(key, "/widget", params, time.Time{}).Encode()
+	expiring := SignWidgetURL(key, "/widget", params, now.Add(time.Minute)).Encode()
+	tests := []struct {
+		name    string
+		method  string
+		query   string
+		advance time.Duration
+		want    int
+		reason  string
+	}{
+		{"valid", http.MethodGet, signed, 0, http.StatusOK, ""},
+		{"parameters reordered", http.MethodGet, reorder(signed), 0, http.StatusOK, ""},
+		{"missing", http.MethodGet, "repo=o%2Fr&term=a+b", 0, http.StatusForbidden, "missing signature"},
+		{"changed parameter", http.MethodGet, strings.Replace(signed, "term=a+b", "term=c", 1), 0, http.StatusForbidden, "invalid signature"},
+		{"added parameter", http.MethodGet, signed + "&theme=dark", 0, http.StatusForbidden, "invalid signature"},
+		{"wrong key", http.MethodGet, SignWidgetURL("other", "/widget", params, time.Time{}).Encode(), 0, http.StatusForbidden, "invalid signature"},
+		{"other path", http.MethodGet, SignWidgetURL(key, "/other", params, time.Time{}).Encode(), 0, http.StatusForbidden, "invalid signature"},
+		{"before expiry", http.MethodGet, expiring, time.Minute, http.StatusOK, ""},
+		{"expired", http.MethodGet, expiring, time.Minute + time.Second, http.StatusForbidden, "signature expired"},
+		{"expiry removed", http.MethodGet, dropParam(expiring, "exp"), time.Hour, http.StatusForbidden, "invalid signature"},
+		{"malformed expiry", http.MethodGet, SignWidgetURL(key, "/widget", url.Values{"repo": {"o/r"}, "exp": {"soon"}}, time.Time{}).Encode(), 0, http.StatusForbidden, "signature expired"},
+		{"preflight", http.MethodOptions, "", 0, http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk.Set(now.Add(tt.advance))
+			rec := serve(p, httptest.NewRequest(tt.method, "/widget?"+tt.query, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.want, strings.TrimSpace(rec.Body.String()))
+			}
+			if tt.reason != "" && !strings.Contains(rec.Body.String(), tt.reason) {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.reason)
+			}
+		})
+	}
+}
+
+// reorder reverses the parameters of an encoded query.
+func reorder(query string) string {
+	parts := strings.Split(query, "&")
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	return strings.Join(parts, "&")
+}
+
+// dropParam removes key from an encoded query.
+func dropParam(query, key string) string {
+	q, _ := url.ParseQuery(query)
+	q.Del(key)
+	return q.Encode()
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/middleware"
+)
+
+// phases accumulates where a request spent its time: fetching from upstream
+// (including reading the body), transforming it, and writing to the client.
+// Streamed responses count as writing, since reading and writing interleave.
+type phases struct {
+	upstream  time.Duration
+	transform time.Duration
+	write     time.Duration
+	mark      time.Time
+}
+
+// begin starts timing a phase; end adds the elapsed time to d.
+func (ph *phases) begin() { ph.mark = time.Now() }
+
+func (ph *phases) end(d *time.Duration) { *d += time.Since(ph.mark) }
+
+func (ph *phases) slowest() string {
+	name, d := "upstream", ph.upstream
+	if ph.transform > d {
+		name, d = "transform", ph.transform
+	}
+	if ph.write > d {
+		name = "write"
+	}
+	return name
+}
+
+// logSlow logs a separate warning line for requests over the slow threshold.
+func (p *Proxy) logSlow(r *http.Request, kind string, status int, total time.Duration, ph *phases) {
+	if p.slowThreshold <= 0 || total < p.slowThreshold {
+		return
+	}
+	id := middleware.RequestIDFrom(r.Context())
+	if id == "" {
+		id = "-"
+	}
+	p.warnf("slow request kind=%s status=%d dur=%s upstream=%s transform=%s write=%s slowest=%s path=%s id=%s",
+		kind, status, total.Round(time.Millisecond), ph.upstream.Round(time.Millisecond), ph.transform.Round(time.Millisecond),
+		ph.write.Round(time.Millisecond), ph.slowest(), p.redactURL(r.URL.RequestURI()), id)
+}
@@ -0,0 +1,235 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+	"github.com/cdlus/giscus-proxy/internal/middleware"
+)
+
+const defaultSnapshotTTL = 10 * time.Minute
+
+// discussionParams are the giscus /api/discussions parameters that select a
+// discussion and its comments.
+var discussionParams = []string{"repo", "term", "number", "category", "strict", "first", "last"}
+
+// discussionQuery returns the discussion parameters of q, or false when q
+// doesn't name a discussion.
+func discussionQuery(q url.Values) (url.Values, bool) {
+	if q.Get("repo") == "" || (q.Get("term") == "" && q.Get("number") == "") {
+		return nil, false
+	}
+	uq := url.Values{}
+	for _, k := range discussionParams {
+		if v := q.Get(k); v != "" {
+			uq.Set(k, v)
+		}
+	}
+	return uq, true
+}
+
+var snapshotTmpl = template.Must(template.New("snapshot").Funcs(template.FuncMap{
+	"date": func(s string) string {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t.Format("January 2, 2006")
+		}
+		return s
+	},
+}).Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{if .URL}}<link rel="alternate" href="{{.URL}}">
+{{end}}<style>
+body{font-family:system-ui,sans-serif;max-width:48rem;margin:2rem auto;padding:0 1rem;line-height:1.5}
+article article{margin-left:1.5rem}
+header{display:flex;align-items:center;gap:.5rem;font-size:.9rem}
+header img{border-radius:50%}
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Comments}}{{range .Comments}}{{template "comment" .}}{{end}}{{else}}<p>No comments yet.</p>
+{{end}}{{if .URL}}<p><a href="{{.URL}}">Join the discussion on GitHub</a></p>
+{{end}}</body>
+</html>
+{{define "comment"}}<article itemscope itemtype="https://schema.org/Comment" id="{{.ID}}">
+<header><img src="{{.Author.AvatarURL}}" alt="" width="24" height="24" loading="lazy"> <a itemprop="author" href="{{.Author.URL}}">{{.Author.Login}}</a> <time itemprop="dateCreated" datetime="{{.CreatedAt}}">{{date .CreatedAt}}</time></header>
+<div itemprop="text">{{.Body}}</div>
+{{range .Replies}}{{template "comment" .}}{{end}}</article>
+{{end}}`))
+
+// snapshotComment is the part of a giscus comment the snapshot renders.
+type snapshotComment struct {
+	ID          string            `json:"id"`
+	Author      ghUser            `json:"author"`
+	CreatedAt   string            `json:"createdAt"`
+	BodyHTML    string            `json:"bodyHTML"`
+	DeletedAt   *string           `json:"deletedAt"`
+	IsMinimized bool              `json:"isMinimized"`
+	Replies     []snapshotComment `json:"replies"`
+}
+
+// Body is the comment's HTML, which GitHub has already sanitized.
+func (c snapshotComment) Body() template.HTML {
+	return template.HTML(c.BodyHTML)
+}
+
+// visible drops deleted and minimized comments, which giscus hides too.
+func visible(cs []snapshotComment) []snapshotComment {
+	out := cs[:0:0]
+	for _, c := range cs {
+		if c.DeletedAt != nil || c.IsMinimized {
+			continue
+		}
+		c.Replies = visible(c.Replies)
+		out = append(out, c)
+	}
+	return out
+}
+
+// handleSnapshot renders a discussion's comments as a plain HTML page that
+// search engines can index, unlike the widget's iframe. It takes giscus's
+// discussion parameters (repo with term or number, category, strict) and reads
+// the discussion from GitHub in direct mode, otherwise from the upstream API.
+func (p *Proxy) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	var target string
+	cacheState := "BYPASS"
+	var ph phases
+	r, span := p.startSpan(r, "snapshot")
+	defer func() {
+		p.logLine(r, "snap", sw.status, sw.written, time.Since(start), cacheState, target)
+		p.logSlow(r, "snapshot", sw.status, time.Since(start), &ph)
+		p.endSpan(span, sw.status, cacheState, target)
+	}()
+	w = sw
+
+	if !p.checkSite(w, r) || !p.checkBot(w, r) || !p.checkRepo(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		p.httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	uq, ok := discussionQuery(q)
+	if !ok {
+		p.httpError(w, r, "repo and term or number are required", http.StatusBadRequest)
+		return
+	}
+	maxAge := "public, max-age=" + strconv.Itoa(int(p.snapshotTTL.Seconds()))
+	// Avatar URLs point at the proxy when mirrored.
+	key := "snapshot " + uq.Encode() + " host=" + r.Host + p.cacheNamespace(r)
+	if p.cacheable(r) {
+		if ent, ok := p.cache.Get(r.Context(), key); ok {
+			cacheState = "HIT"
+			writeSnapshot(w, r, ent.Status, maxAge, ent.Body)
+			return
+		}
+	}
+
+	ph.begin()
+	status, body, err := p.discussion(r, uq, &target)
+	ph.end(&ph.upstream)
+	if err != nil {
+		p.upstreamError(w, r, err)
+		return
+	}
+	if status != http.StatusOK && status != http.StatusNotFound {
+		p.httpError(w, r, fmt.Sprintf("upstream returned %d", status), http.StatusBadGateway)
+		return
+	}
+
+	ph.begin()
+	var data struct {
+		Discussion struct {
+			URL      string            `json:"url"`
+			Comments []snapshotComment `json:"comments"`
+		} `json:"discussion"`
+	}
+	if status == http.StatusOK {
+		if err := json.Unmarshal(p.rewriteMirrors(r, "application/json", body), &data); err != nil {
+			ph.end(&ph.transform)
+			p.httpError(w, r, "failed to parse upstream discussion", http.StatusBadGateway)
+			return
+		}
+	}
+	title := q.Get("term")
+	if title == "" {
+		title = q.Get("repo") + " #" + q.Get("number")
+	}
+	var buf bytes.Buffer
+	err = snapshotTmpl.Execute(&buf, map[string]any{
+		"Title":    "Comments on " + title,
+		"URL":      data.Discussion.URL,
+		"Comments": visible(data.Discussion.Comments),
+	})
+	ph.end(&ph.transform)
+	if err != nil {
+		p.reportError(r, "snapshot render", err)
+		p.httpError(w, r, "failed to render snapshot", http.StatusInternalServerError)
+		return
+	}
+	writeSnapshot(w, r, status, maxAge, buf.Bytes())
+	if p.cacheable(r) {
+		p.cache.Set(r.Context(), key, cache.Entry{Status: status, Headers: http.Header{"Content-Type": {"text/html; charset=utf-8"}}, Body: buf.Bytes(), Expires: p.clock.Now().Add(p.snapshotTTL)})
+		cacheState = "MISS:cached"
+	}
+}
+
+// discussion reads the discussion selected by uq, from GitHub in direct mode and
+// otherwise from the upstream API, in the shape giscus's /api/discussions
+// returns. It sets *target to where it was read from, for logs.
+func (p *Proxy) discussion(r *http.Request, uq url.Values, target *string) (int, []byte, error) {
+	if p.github != nil {
+		*target = p.github.endpoint
+		return p.github.discussion(r.Context(), p.client, uq)
+	}
+	*target = p.upstreamForPath(r, "/api/discussions") + "/api/discussions?" + uq.Encode()
+	return p.fetchDiscussion(r, *target)
+}
+
+// fetchDiscussion reads a discussion from giscus's /api/discussions at target.
+func (p *Proxy) fetchDiscussion(r *http.Request, target string) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	if id := middleware.RequestIDFrom(r.Context()); id != "" {
+		req.Header.Set(middleware.RequestIDHeader, id)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	p.debugUpstream(req, resp)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxGraphQLResponse))
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, body, nil
+}
+
+func writeSnapshot(w http.ResponseWriter, r *http.Request, status int, cacheControl string, body []byte) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", cacheControl)
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
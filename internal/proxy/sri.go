@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Subresource Integrity handling modes for Config.SRI.
+const (
+	// SRIAuto strips integrity attributes only when passthrough transforms are enabled.
+	SRIAuto = "auto"
+	// SRIKeep leaves integrity attributes untouched.
+	SRIKeep = "keep"
+	// SRIStrip removes every integrity attribute from the widget HTML.
+	SRIStrip = "strip"
+	// SRIRecompute re-hashes upstream assets after the passthrough transform stage and
+	// rewrites their integrity attributes, stripping them when that fails.
+	SRIRecompute = "recompute"
+)
+
+const maxSRISums = 256
+
+var (
+	integrityTagRE  = regexp.MustCompile(`(?is)<(?:script|link)\b[^>]*\bintegrity\s*=\s*(?:"[^"]*"|'[^']*'|[^\s>]+)[^>]*>`)
+	integrityAttrRE = regexp.MustCompile(`(?is)\s+integrity\s*=\s*(?:"[^"]*"|'[^']*'|[^\s>]+)`)
+	refAttrRE       = regexp.MustCompile(`(?is)\s(?:src|href)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// sriSums memoizes recomputed hashes for upstream assets.
+type sriSums struct {
+	mu   sync.Mutex
+	sums map[string]string
+}
+
+func (s *sriSums) get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.sums[key]
+	return v, ok
+}
+
+func (s *sriSums) set(key, sum string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sums == nil || len(s.sums) >= maxSRISums {
+		s.sums = make(map[string]string)
+	}
+	s.sums[key] = sum
+}
+
+func normalizeSRI(mode string) (string, error) {
+	switch m := strings.ToLower(strings.TrimSpace(mode)); m {
+	case "", SRIAuto:
+		return SRIAuto, nil
+	case SRIKeep, SRIStrip, SRIRecompute:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown SRI mode %q (use auto, keep, strip or recompute)", mode)
+	}
+}
+
+// sriActive reports whether integrity attributes in the widget need attention.
+func (p *Proxy) sriActive(r *http.Request) bool {
+	switch p.sri {
+	case SRIStrip, SRIRecompute:
+		return true
+	case SRIAuto:
+		return p.passthroughTransforms(r)
+	}
+	return false
+}
+
+// fixIntegrity strips or recomputes integrity attributes in the widget HTML.
+func (p *Proxy) fixIntegrity(r *http.Request, b []byte) []byte {
+	return integrityTagRE.ReplaceAllFunc(b, func(tag []byte) []byte {
+		if p.sri == SRIRecompute {
+			target, ours := p.assetURL(r, tag)
+			if !ours {
+				// Third-party assets are served untouched, so their hashes still hold.
+				return tag
+			}
+			sum, err := p.recomputeIntegrity(r, target)
+			if err == nil {
+				return integrityAttrRE.ReplaceAll(tag, []byte(` integrity="`+sum+`"`))
+			}
+			p.reportError(r, "sri recompute", fmt.Errorf("%s: %w", p.redactURL(target), err))
+		}
+		return integrityAttrRE.ReplaceAll(tag, nil)
+	})
+}
+
+// assetURL resolves the src/href of tag to an upstream URL when the asset is served through the proxy.
+func (p *Proxy) assetURL(r *http.Request, tag []byte) (string, bool) {
+	m := refAttrRE.FindSubmatch(tag)
+	if m == nil {
+		return "", false
+	}
+	ref := string(m[1]) + string(m[2]) + string(m[3])
+	u, err := url.Parse(strings.TrimSpace(ref))
+	if err != nil {
+		return "", false
+	}
+	if u.Host != "" {
+		origin := u.Scheme + "://" + u.Host
+		if u.Scheme == "" {
+			origin = "https://" + u.Host
+		}
+		if origin != p.upstreamFor(r) && origin != p.proxyOrigin(r) {
+			return "", false
+		}
+	}
+	if !strings.HasPrefix(u.Path, "/") {
+		return "", false
+	}
+	if p.basePath != "" {
+		u.Path = strings.TrimPrefix(u.Path, p.basePath)
+	}
+	target := p.upstreamFor(r) + u.Path
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	return target, true
+}
+
+func (p *Proxy) recomputeIntegrity(r *http.Request, target string) (string, error) {
+	key := r.Host + " " + target
+	// Per-request transformers make the hash specific to this request.
+	memo := len(requestTransformers(r)) == 0
+	if sum, ok := p.sriSums.get(key); ok && memo {
+		return sum, nil
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "*/*")
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("upstream status %d", resp.StatusCode)
+	}
+	body, clean, err := decompressIfNeeded(resp.Header, resp.Body)
+	if err != nil {
+		return "", err
+	}
+	defer clean()
+	buf, err := readPooled(body)
+	defer putBuffer(buf)
+	if err != nil {
+		return "", err
+	}
+	bin := buf.Bytes()
+	if ct := resp.Header.Get("Content-Type"); p.transformable(r, ct) {
+		bin = p.transformPassthrough(r, ct, bin)
+	}
+	h := sha512.Sum384(bin)
+	sum := "sha384-" + base64.StdEncoding.EncodeToString(h[:])
+	if memo {
+		p.sriSums.set(key, sum)
+	}
+	return sum, nil
+}
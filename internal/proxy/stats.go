@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// statsBuckets is the number of slices a stats window is divided into; the
+	// window rolls forward one bucket at a time.
+	statsBuckets = 60
+	// maxStatsPaths bounds the distinct paths tracked per bucket. Further paths
+	// are counted under statsOtherPath so a crawler can't grow memory unbounded.
+	maxStatsPaths  = 1000
+	statsOtherPath = "(other)"
+)
+
+// pathStats counts requests per path over a rolling window.
+type pathStats struct {
+	mu      sync.Mutex
+	window  time.Duration
+	width   time.Duration
+	buckets [statsBuckets]statsBucket
+}
+
+type statsBucket struct {
+	start time.Time
+	paths map[string]*pathCounts
+}
+
+type pathCounts struct {
+	Requests uint64            `json:"requests"`
+	Bytes    uint64            `json:"bytes"`
+	Errors   uint64            `json:"errors"`
+	Cache    map[string]uint64 `json:"cache,omitempty"`
+}
+
+func (c *pathCounts) add(o *pathCounts) {
+	c.Requests += o.Requests
+	c.Bytes += o.Bytes
+	c.Errors += o.Errors
+	for k, v := range o.Cache {
+		if c.Cache == nil {
+			c.Cache = make(map[string]uint64)
+		}
+		c.Cache[k] += v
+	}
+}
+
+func newPathStats(window time.Duration) *pathStats {
+	width := (window / statsBuckets).Truncate(time.Second)
+	if width < time.Second {
+		width = time.Second
+	}
+	return &pathStats{window: width * statsBuckets, width: width}
+}
+
+// observe records a finished request. Only the path is kept, never the query.
+func (s *pathStats) observe(now time.Time, path string, status, bytes int, cacheState string) {
+	start := now.Truncate(s.width)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := &s.buckets[int(start.UnixNano()/int64(s.width))%statsBuckets]
+	if !b.start.Equal(start) {
+		b.start, b.paths = start, make(map[string]*pathCounts)
+	}
+	c, ok := b.paths[path]
+	if !ok {
+		if len(b.paths) >= maxStatsPaths {
+			path = statsOtherPath
+		}
+		if c, ok = b.paths[path]; !ok {
+			c = &pathCounts{}
+			b.paths[path] = c
+		}
+	}
+	c.Requests++
+	c.Bytes += uint64(max(bytes, 0))
+	if status >= 500 {
+		c.Errors++
+	}
+	if cacheState != "" {
+		if c.Cache == nil {
+			c.Cache = make(map[string]uint64)
+		}
+		c.Cache[cacheState]++
+	}
+}
+
+type pathReport struct {
+	Path string `json:"path"`
+	pathCounts
+}
+
+// top merges the buckets inside the window ending at now and returns the totals
+// and the n most requested paths.
+func (s *pathStats) top(now time.Time, n int) (pathCounts, []pathReport) {
+	since := now.Truncate(s.width).Add(s.width - s.window)
+	merged := make(map[string]*pathCounts)
+	s.mu.Lock()
+	for i := range s.buckets {
+		b := &s.buckets[i]
+		if b.start.Before(since) {
+			continue
+		}
+		for path, c := range b.paths {
+			m, ok := merged[path]
+			if !ok {
+				m = &pathCounts{}
+				merged[path] = m
+			}
+			m.add(c)
+		}
+	}
+	s.mu.Unlock()
+
+	var total pathCounts
+	out := make([]pathReport, 0, len(merged))
+	for path, c := range merged {
+		total.add(c)
+		out = append(out, pathReport{Path: path, pathCounts: *c})
+	}
+	slices.SortFunc(out, func(a, b pathReport) int {
+		if c := cmp.Compare(b.Requests, a.Requests); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return total, out
+}
+
+// handleAdminStats reports the most requested paths over the stats window with
+// their bytes served, 5xx count and cache state breakdown. ?top=N sets how many
+// paths are listed (default 20).
+func (p *Proxy) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n := 20
+	if v := r.URL.Query().Get("top"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 1 {
+			http.Error(w, "invalid top", http.StatusBadRequest)
+			return
+		}
+		n = i
+	}
+	total, paths := p.stats.top(p.clock.Now(), n)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"window": p.stats.window.String(),
+		"total":  total,
+		"paths":  paths,
+	})
+}
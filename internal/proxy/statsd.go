@@ -0,0 +1,30 @@
+package proxy
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/statsd"
+)
+
+// statsdMetrics pushes the same measurements as the Prometheus endpoint to StatsD.
+type statsdMetrics struct {
+	c *statsd.Client
+}
+
+func (m statsdMetrics) ObserveRequest(route string, status, _ int, d time.Duration) {
+	m.c.Count("requests", 1, "route:"+route, "code:"+strconv.Itoa(status))
+	m.c.Timing("request_duration", d, "route:"+route)
+}
+
+func (m statsdMetrics) ObserveUpstream(code string, d time.Duration) {
+	m.c.Timing("upstream_duration", d, "code:"+code)
+}
+
+func (m statsdMetrics) ObserveCache(result string) {
+	m.c.Count("cache", 1, "result:"+result)
+}
+
+func (m statsdMetrics) ObserveError(kind string) {
+	m.c.Count("errors", 1, "kind:"+kind)
+}
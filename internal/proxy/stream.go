@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// streamReplacer applies a single literal replacement to a byte stream, holding back
+// just enough trailing bytes to catch a match that straddles two writes.
+type streamReplacer struct {
+	w    io.Writer
+	from []byte
+	to   []byte
+	buf  []byte
+}
+
+func (s *streamReplacer) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	start := 0
+	for {
+		i := bytes.Index(s.buf[start:], s.from)
+		if i == -1 {
+			break
+		}
+		if _, err := s.w.Write(s.buf[start : start+i]); err != nil {
+			return 0, err
+		}
+		if _, err := s.w.Write(s.to); err != nil {
+			return 0, err
+		}
+		start += i + len(s.from)
+	}
+	if keep := len(s.from) - 1; len(s.buf)-start > keep {
+		end := len(s.buf) - keep
+		if _, err := s.w.Write(s.buf[start:end]); err != nil {
+			return 0, err
+		}
+		start = end
+	}
+	s.buf = append(s.buf[:0], s.buf[start:]...)
+	return len(p), nil
+}
+
+func (s *streamReplacer) flush() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	_, err := s.w.Write(s.buf)
+	s.buf = s.buf[:0]
+	return err
+}
+
+// replaceChain pipes writes through a series of streamReplacers, preserving the
+// rule-by-rule semantics of applyReplacements.
+type replaceChain struct {
+	stages []*streamReplacer
+	out    io.Writer
+}
+
+func newReplaceChain(w io.Writer, reps []replacer) *replaceChain {
+	c := &replaceChain{out: w}
+	next := w
+	stages := make([]*streamReplacer, len(reps))
+	for i := len(reps) - 1; i >= 0; i-- {
+		stages[i] = &streamReplacer{w: next, from: []byte(reps[i].from), to: []byte(reps[i].to)}
+		next = stages[i]
+	}
+	c.stages = stages
+	return c
+}
+
+func (c *replaceChain) Write(p []byte) (int, error) {
+	if len(c.stages) == 0 {
+		return c.out.Write(p)
+	}
+	return c.stages[0].Write(p)
+}
+
+// Close drains every stage in order so held-back bytes reach the underlying writer.
+func (c *replaceChain) Close() error {
+	for _, s := range c.stages {
+		if err := s.flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// streamable reports whether reps can be applied incrementally.
+func streamable(reps []replacer) bool {
+	for _, r := range reps {
+		if r.useRegex || r.from == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// streamReplace copies src to w through the replacers, flushing after every chunk.
+func streamReplace(w http.ResponseWriter, src io.Reader, reps []replacer) error {
+	chain := newReplaceChain(w, reps)
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := chain.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = chain.Close()
+			return err
+		}
+	}
+	if err := chain.Close(); err != nil {
+		return err
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return nil
+}
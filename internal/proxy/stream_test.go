@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// chunkReader returns at most n bytes per Read, so matches land on every
+// possible read boundary.
+type chunkReader struct {
+	r io.Reader
+	n int
+}
+
+func (c chunkReader) Read(p []byte) (int, error) {
+	if len(p) > c.n {
+		p = p[:c.n]
+	}
+	return c.r.Read(p)
+}
+
+func mustReplacers(t *testing.T, rules ...string) []replacer {
+	t.Helper()
+	reps, err := parseReplacers(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reps
+}
+
+func TestStreamReplace(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []string
+		in    string
+		want  string
+	}{
+		{"no rules", nil, "powered by giscus", "powered by giscus"},
+		{"empty body", []string{"giscus=>proxy"}, "", ""},
+		{"no match", []string{"giscus=>proxy"}, "nothing to see here", "nothing to see here"},
+		{"whole body", []string{"giscus=>proxy"}, "giscus", "proxy"},
+		{"at start and end", []string{"giscus=>proxy"}, "giscus and giscus", "proxy and proxy"},
+		{"repeated", []string{"ab=>X"}, "abababab", "XXXX"},
+		{"overlapping candidates", []string{"aa=>b"}, "aaaaa", "bba"},
+		{"self-similar pattern", []string{"aab=>X"}, "aaaab aab", "aaX X"},
+		{"partial match at EOF", []string{"giscus=>proxy"}, "powered by gisc", "powered by gisc"},
+		{"partial then full", []string{"giscus=>proxy"}, "giscgiscus", "giscproxy"},
+		{"replacement contains pattern", []string{"a=>aa"}, "banana", "baanaanaa"},
+		{"replacement removes", []string{"<a>=>"}, "x<a>y<a>z", "xyz"},
+		{"multi-byte", []string{"été=>summer"}, "un été chaud, été", "un summer chaud, summer"},
+		{"single byte pattern", []string{"/=>|"}, "/a/b/", "|a|b|"},
+		{"chained rules", []string{"a=>bb", "bbb=>c"}, "aab", "cbb"},
+		{"chain feeds later rule", []string{"Comments=>giscus", "giscus=>Discussion"}, "Comments by giscus", "Discussion by Discussion"},
+		{"chain order", []string{"b=>a", "a=>b"}, "ab", "bb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reps := mustReplacers(t, tt.rules...)
+			if !streamable(reps) {
+				t.Fatalf("streamable(%q) = false", tt.rules)
+			}
+			if got := string(applyReplacements([]byte(tt.in), reps)); got != tt.want {
+				t.Fatalf("applyReplacements = %q, want %q", got, tt.want)
+			}
+			for n := 1; n <= len(tt.in)+1; n++ {
+				rec := httptest.NewRecorder()
+				if err := streamReplace(rec, chunkReader{strings.NewReader(tt.in), n}, reps); err != nil {
+					t.Fatalf("chunks of %d: %v", n, err)
+				}
+				if got := rec.Body.String(); got != tt.want {
+					t.Errorf("chunks of %d: got %q, want %q", n, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestReplaceChainWrites(t *testing.T) {
+	// Writes of every size, including empty ones, must give the same output as
+	// a single write of the whole body.
+	reps := mustReplacers(t, "giscus=>proxy", "proxy.app=>example.com")
+	in := "<a href=\"https://giscus.app\">giscus</a> giscus.app"
+	want := `<a href="https://example.com">proxy</a> example.com`
+	for n := 1; n <= len(in); n++ {
+		var out strings.Builder
+		c := newReplaceChain(&out, reps)
+		for s := in; s != ""; {
+			k := min(n, len(s))
+			if _, err := c.Write(nil); err != nil {
+				t.Fatal(err)
+			}
+			if m, err := c.Write([]byte(s[:k])); err != nil || m != k {
+				t.Fatalf("Write = %d, %v; want %d, nil", m, err, k)
+			}
+			s = s[k:]
+		}
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != want {
+			t.Errorf("writes of %d: got %q, want %q", n, out.String(), want)
+		}
+	}
+}
+
+func TestStreamReplaceReadError(t *testing.T) {
+	errBoom := errors.New("boom")
+	reps := mustReplacers(t, "giscus=>proxy")
+	rec := httptest.NewRecorder()
+	src := io.MultiReader(strings.NewReader("powered by gisc"), iotest.ErrReader(errBoom))
+	if err := streamReplace(rec, src, reps); !errors.Is(err, errBoom) {
+		t.Fatalf("streamReplace error = %v, want %v", err, errBoom)
+	}
+	// The bytes held back for a possible match are still written.
+	if got := rec.Body.String(); got != "powered by gisc" {
+		t.Errorf("body = %q, want %q", got, "powered by gisc")
+	}
+}
+
+func TestStreamable(t *testing.T) {
+	tests := []struct {
+		rules []string
+		want  bool
+	}{
+		{nil, true},
+		{[]string{"a=>b", "c=>d"}, true},
+		{[]string{"a=>b", "re:a+=>b"}, false},
+		{[]string{"=>b"}, false},
+	}
+	for _, tt := range tests {
+		if got := streamable(mustReplacers(t, tt.rules...)); got != tt.want {
+			t.Errorf("streamable(%q) = %v, want %v", tt.rules, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxSummarySamples bounds the upstream latencies kept per interval; beyond it,
+// reservoir sampling keeps a uniform sample.
+const maxSummarySamples = 4096
+
+// summary accumulates the statistics of the current summary interval.
+type summary struct {
+	mu  sync.Mutex
+	cur summaryStats
+}
+
+type summaryStats struct {
+	requests int
+	errors   int
+	hits     int
+	misses   int
+	upstream int
+	samples  []time.Duration
+}
+
+func (s *summary) ObserveRequest(_ string, status, _ int, _ time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cur.requests++
+	if status >= 500 {
+		s.cur.errors++
+	}
+}
+
+func (s *summary) ObserveCache(result string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch result {
+	case "hit":
+		s.cur.hits++
+	case "miss":
+		s.cur.misses++
+	}
+}
+
+func (s *summary) ObserveUpstream(_ string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cur.upstream++
+	if len(s.cur.samples) < maxSummarySamples {
+		s.cur.samples = append(s.cur.samples, d)
+	} else if i := rand.IntN(s.cur.upstream); i < maxSummarySamples {
+		s.cur.samples[i] = d
+	}
+}
+
+// flush formats the interval's statistics and starts a new interval.
+func (s *summary) flush(interval time.Duration) string {
+	s.mu.Lock()
+	cur := s.cur
+	s.cur = summaryStats{}
+	s.mu.Unlock()
+
+	hitRatio, errRate := "-", "-"
+	if n := cur.hits + cur.misses; n > 0 {
+		hitRatio = fmt.Sprintf("%.2f", float64(cur.hits)/float64(n))
+	}
+	if cur.requests > 0 {
+		errRate = fmt.Sprintf("%.3f", float64(cur.errors)/float64(cur.requests))
+	}
+	slices.Sort(cur.samples)
+	return fmt.Sprintf("summary interval=%s requests=%d hit_ratio=%s upstream=%d upstream_p50=%s upstream_p95=%s errors=%d error_rate=%s",
+		interval, cur.requests, hitRatio, cur.upstream, percentile(cur.samples, 0.50), percentile(cur.samples, 0.95), cur.errors, errRate)
+}
+
+// percentile returns the nearest-rank percentile of sorted durations.
+func percentile(sorted []time.Duration, q float64) string {
+	if len(sorted) == 0 {
+		return "-"
+	}
+	i := int(float64(len(sorted))*q+0.5) - 1
+	i = max(0, min(i, len(sorted)-1))
+	return sorted[i].Round(time.Millisecond).String()
+}
+
+func (p *Proxy) logSummaries(interval time.Duration) {
+	start := p.clock.Now()
+	for {
+		select {
+		case <-p.clock.After(interval):
+			start = p.clock.Now()
+			p.infof("%s", p.summary.flush(interval))
+		case <-p.done:
+			p.infof("%s", p.summary.flush(p.clock.Now().Sub(start).Round(time.Second)))
+			return
+		}
+	}
+}
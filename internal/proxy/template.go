@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var placeholderRE = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.\-]+)\s*\}\}`)
+
+// expandReplacers resolves {{placeholders}} in replacement values for a single request
+// whose response has the given content type. Supported names are proxy_origin,
+// request_host, upstream_origin and query.NAME; proxy_origin includes the base path.
+// Values may come from the visitor's request, so they are escaped with
+// escapePlaceholder.
+func (p *Proxy) expandReplacers(reps []replacer, r *http.Request, contentType string) []replacer {
+	var out []replacer
+	for i, rep := range reps {
+		if !strings.Contains(rep.to, "{{") {
+			if out != nil {
+				out = append(out, rep)
+			}
+			continue
+		}
+		if out == nil {
+			out = append(make([]replacer, 0, len(reps)), reps[:i]...)
+		}
+		rep.to = placeholderRE.ReplaceAllStringFunc(rep.to, func(m string) string {
+			name := placeholderRE.FindStringSubmatch(m)[1]
+			v, ok := p.placeholder(name, r)
+			if !ok {
+				return m
+			}
+			return escapePlaceholder(contentType, v)
+		})
+		out = append(out, rep)
+	}
+	if out == nil {
+		return reps
+	}
+	return out
+}
+
+// escapePlaceholder escapes every character of v but ASCII letters, digits and
+// ./:_~- for the language of the document it is inserted into: numeric
+// character references in HTML, \u escapes in JavaScript and JSON, and \
+// escapes in CSS. The result can't end a string literal, tag or attribute, so it
+// is safe in HTML text and attributes and in JavaScript, JSON and CSS strings.
+// Script and style elements of HTML documents don't decode character
+// references, so there the value is inert but not restored. The result contains
+// no $, which keeps it literal in regex replacements.
+func escapePlaceholder(contentType, v string) string {
+	mt := mediaType(contentType)
+	var b strings.Builder
+	for _, c := range v {
+		if c < utf8.RuneSelf && placeholderSafe(byte(c)) {
+			b.WriteRune(c)
+			continue
+		}
+		switch {
+		case mt == "application/json" || strings.HasSuffix(mt, "javascript"):
+			for _, u := range utf16.Encode([]rune{c}) {
+				fmt.Fprintf(&b, `\u%04x`, u)
+			}
+		case mt == "text/css":
+			fmt.Fprintf(&b, `\%x `, c)
+		default:
+			fmt.Fprintf(&b, "&#%d;", c)
+		}
+	}
+	return b.String()
+}
+
+func placeholderSafe(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("./:_~-", c) >= 0
+}
+
+func (p *Proxy) placeholder(name string, r *http.Request) (string, bool) {
+	switch name {
+	case "proxy_origin":
+		return p.proxyBase(r), true
+	case "request_host":
+		return r.Host, true
+	case "upstream_origin":
+		return p.upstreamFor(r), true
+	}
+	if key, ok := strings.CutPrefix(name, "query."); ok {
+		return r.URL.Query().Get(key), true
+	}
+	return "", false
+}
+
+// proxyOrigin returns the configured public origin, or one derived from the request.
+func (p *Proxy) proxyOrigin(r *http.Request) string {
+	if p.publicOrigin != "" {
+		return p.publicOrigin
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if fp := strings.TrimSpace(strings.Split(r.Header.Get("X-Forwarded-Proto"), ",")[0]); fp != "" {
+		scheme = fp
+	}
+	return scheme + "://" + r.Host
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Tenant holds the settings of one of several sites served by a single proxy.
+// A request belongs to the tenant named by its site query parameter (or that of
+// the proxy page that issued it, for the widget's own assets), otherwise to the
+// first tenant whose Sites match its Origin or Referer. Requests matching no
+// tenant use the global settings. Empty fields fall back to the global ones.
+type Tenant struct {
+	// Name selects the tenant with site=NAME and namespaces its cache entries.
+	Name string
+	// Sites are Origin/Referer patterns, in AllowedSites syntax, that select the
+	// tenant. They also replace AllowedSites for the tenant's requests.
+	Sites []string
+	// UpstreamOrigin replaces Config.UpstreamOrigin and Config.APIOrigin.
+	UpstreamOrigin string
+	// Replacements replace Config.Replacements on the widget.
+	Replacements []string
+	// LightTheme and DarkTheme replace the themes picked by /widget/auto.
+	LightTheme string
+	DarkTheme  string
+	// Repos restricts the widget's repo parameter to these OWNER/NAME values.
+	Repos []string
+}
+
+// tenant is a Tenant with its rules parsed.
+type tenant struct {
+	name       string
+	sites      []originPattern
+	upstream   string
+	replacers  []replacer
+	lightTheme string
+	darkTheme  string
+	repos      []string
+}
+
+// newTenants parses the configured tenants, dropping unnamed ones and ignoring
+// replacements that don't parse. StringOverrides apply on top of a tenant's
+// replacements as they do on top of the global ones.
+func (p *Proxy) newTenants(cfg Config) []*tenant {
+	var out []*tenant
+	for _, c := range cfg.Tenants {
+		name := strings.TrimSpace(c.Name)
+		if name == "" {
+			p.warnf("ignoring tenant without a name")
+			continue
+		}
+		t := &tenant{
+			name:       name,
+			sites:      parseOriginPatterns(c.Sites),
+			upstream:   strings.TrimRight(c.UpstreamOrigin, "/"),
+			lightTheme: c.LightTheme,
+			darkTheme:  c.DarkTheme,
+		}
+		if len(c.Replacements) > 0 {
+			reps, err := parseReplacers(c.Replacements)
+			if err != nil {
+				p.warnf("tenant %s: ignoring replacements: %v", name, err)
+			} else {
+				t.replacers = append(reps, stringOverrideReplacers(cfg.StringOverrides)...)
+			}
+		}
+		for _, repo := range c.Repos {
+			if repo = strings.ToLower(strings.TrimSpace(repo)); repo != "" {
+				t.repos = append(t.repos, repo)
+			}
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// tenantFor returns the tenant r belongs to, or nil.
+func (p *Proxy) tenantFor(r *http.Request) *tenant {
+	if len(p.tenants) == 0 {
+		return nil
+	}
+	name := r.URL.Query().Get("site")
+	if name == "" {
+		// The widget's assets and API calls carry the widget URL as Referer.
+		if u, err := url.Parse(r.Header.Get("Referer")); err == nil && p.ownPage(r, u) {
+			name = u.Query().Get("site")
+		}
+	}
+	if name != "" {
+		for _, t := range p.tenants {
+			if t.name == name {
+				return t
+			}
+		}
+		return nil
+	}
+	if site := requestSite(r); site != "" {
+		for _, t := range p.tenants {
+			if matchOrigin(t.sites, site) {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// ownPage reports whether u is a page served by the proxy itself.
+func (p *Proxy) ownPage(r *http.Request, u *url.URL) bool {
+	if u.Host == "" {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host) || (p.publicOrigin != "" && strings.EqualFold(u.Scheme+"://"+u.Host, p.publicOrigin))
+}
+
+// checkRepo rejects requests for a repo outside the tenant's Repos with 403.
+func (p *Proxy) checkRepo(w http.ResponseWriter, r *http.Request) bool {
+	t := p.tenantFor(r)
+	if t == nil || t.repoAllowed(r.URL.Query().Get("repo")) {
+		return true
+	}
+	p.httpError(w, r, "repository not allowed", http.StatusForbidden)
+	return false
+}
+
+// repoAllowed reports whether the tenant may embed discussions of repo.
+func (t *tenant) repoAllowed(repo string) bool {
+	if len(t.repos) == 0 {
+		return true
+	}
+	repo = strings.ToLower(strings.TrimSpace(repo))
+	for _, r := range t.repos {
+		if r == repo {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheNamespace returns the cache key suffix separating r's tenant from others.
+func (p *Proxy) cacheNamespace(r *http.Request) string {
+	if t := p.tenantFor(r); t != nil {
+		return " tenant=" + t.name
+	}
+	return ""
+}
+
+func tenantNames(ts []*tenant) []string {
+	names := make([]string, 0, len(ts))
+	for _, t := range ts {
+		names = append(names, t.name)
+	}
+	return names
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+)
+
+// colorScheme extracts the preferred color scheme from the prefers query parameter
+// or the Sec-CH-Prefers-Color-Scheme client hint.
+func colorScheme(r *http.Request) string {
+	v := r.URL.Query().Get("prefers")
+	if v == "" {
+		v = r.Header.Get("Sec-CH-Prefers-Color-Scheme")
+	}
+	switch strings.ToLower(strings.Trim(strings.TrimSpace(v), `"`)) {
+	case "dark":
+		return "dark"
+	case "light":
+		return "light"
+	}
+	return ""
+}
+
+// handleAutoTheme serves the widget with its theme parameter chosen from the visitor's
+// color scheme hint, falling back to the theme already present in the query.
+func (p *Proxy) handleAutoTheme(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Accept-CH", "Sec-CH-Prefers-Color-Scheme")
+	w.Header().Set("Critical-CH", "Sec-CH-Prefers-Color-Scheme")
+	w.Header().Add("Vary", "Sec-CH-Prefers-Color-Scheme")
+
+	light, dark := p.lightTheme, p.darkTheme
+	if t := p.tenantFor(r); t != nil {
+		if t.lightTheme != "" {
+			light = t.lightTheme
+		}
+		if t.darkTheme != "" {
+			dark = t.darkTheme
+		}
+	}
+	q := r.URL.Query()
+	switch colorScheme(r) {
+	case "dark":
+		q.Set("theme", dark)
+	case "light":
+		q.Set("theme", light)
+	}
+	q.Del("prefers")
+
+	r2 := r.Clone(r.Context())
+	r2.URL.RawQuery = q.Encode()
+	r2.RequestURI = r2.URL.RequestURI()
+	p.handleWidget(w, r2)
+}
@@ -0,0 +1,38 @@
+//go:build !js
+
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// newThemeTransport returns the transport remote themes are fetched with. With
+// publicOnly set it refuses to connect to non-public addresses, checked on the
+// address actually dialled so a host can't pass the lookup in check and then
+// resolve to an internal one. Environment proxies are ignored for the same
+// reason: the check would apply to the proxy instead of the theme host.
+func newThemeTransport(publicOnly bool) http.RoundTripper {
+	d := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	if publicOnly {
+		d.Control = func(network, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil || !publicAddr(ap.Addr().Unmap()) {
+				return fmt.Errorf("theme host connects to non-public address %s", address)
+			}
+			return nil
+		}
+	}
+	return &http.Transport{
+		DialContext:           d.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 15 * time.Second,
+	}
+}
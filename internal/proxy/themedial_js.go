@@ -0,0 +1,12 @@
+//go:build js
+
+package proxy
+
+import "net/http"
+
+// newThemeTransport returns the runtime's fetch-backed transport: the
+// WebAssembly build can't dial sockets, and edge runtimes don't reach private
+// networks from fetch.
+func newThemeTransport(bool) http.RoundTripper {
+	return http.DefaultTransport
+}
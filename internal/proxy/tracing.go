@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "giscus-proxy"
+
+// startSpan opens the server span for a proxied request, continuing any trace
+// context sent by a load balancer in front of the proxy. The returned request
+// carries the span so upstream calls become its children.
+func (p *Proxy) startSpan(r *http.Request, route string) (*http.Request, trace.Span) {
+	ctx := propagation.TraceContext{}.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := p.tracer.Start(ctx, route, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("http.request.method", r.Method),
+		attribute.String("url.path", r.URL.Path),
+		attribute.String("http.route", route),
+	))
+	return r.WithContext(ctx), span
+}
+
+// endSpan records the outcome of a proxied request and ends its span.
+func (p *Proxy) endSpan(span trace.Span, status int, cacheState, target string) {
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if cacheState != "" {
+		span.SetAttributes(attribute.String("giscus_proxy.cache", cacheState))
+	}
+	if target != "" {
+		span.SetAttributes(attribute.String("giscus_proxy.target", p.redactURL(target)))
+	}
+	if status >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// tracingClient wraps upstream requests in client spans. Trace context is not
+// propagated upstream, so giscus.app never sees the proxy's trace IDs.
+type tracingClient struct {
+	HTTPClient
+	tracer trace.Tracer
+	redact func(string) string
+}
+
+func (c *tracingClient) Do(req *http.Request) (*http.Response, error) {
+	ctx, span := c.tracer.Start(req.Context(), "upstream "+req.Method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Host),
+		attribute.String("url.full", c.redact(req.URL.String())),
+	))
+	defer span.End()
+	resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, "upstream status "+strconv.Itoa(resp.StatusCode))
+	}
+	return resp, nil
+}
@@ -0,0 +1,38 @@
+package proxy
+
+// Transformer rewrites a decoded response body. Transformers configured in
+// Config.Transformers run in order on every widget document and on HTML, CSS,
+// JSON and JavaScript passthrough responses, after the built-in rewrites and
+// before minification. They must return the body unchanged for content they
+// don't handle, and must not keep it once they return: it may be a pooled
+// buffer that later requests reuse.
+type Transformer interface {
+	Transform(contentType string, body []byte) []byte
+}
+
+// TransformerFunc adapts a function to Transformer.
+type TransformerFunc func(contentType string, body []byte) []byte
+
+// Transform calls f.
+func (f TransformerFunc) Transform(contentType string, body []byte) []byte {
+	return f(contentType, body)
+}
+
+// replacements applies replacer rules in order; it is the Transformer behind the
+// server-side replacements and the footer swap.
+type replacements []replacer
+
+func (rs replacements) Transform(_ string, body []byte) []byte {
+	return applyReplacements(body, rs)
+}
+
+// widgetFooterSwap removes the "powered by giscus" footer from widget documents.
+var widgetFooterSwap Transformer = replacements(footerReplacers)
+
+// transform runs body through each transformer in turn.
+func transform(contentType string, body []byte, chain ...Transformer) []byte {
+	for _, t := range chain {
+		body = t.Transform(contentType, body)
+	}
+	return body
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/middleware"
+)
+
+// userAgent identifies the proxy on the requests it makes itself, upstream and
+// elsewhere, instead of passing on the visitor's.
+const userAgent = "giscus-proxy/clean-1.0"
+
+// errUpstreamBudget is returned when the global upstream request budget is exhausted.
+var errUpstreamBudget = errors.New("upstream request budget exhausted")
+
+// errUpstreamVetoed wraps the error of an OnUpstreamRequest hook that rejected a request.
+var errUpstreamVetoed = errors.New("upstream request vetoed")
+
+// hookClient runs the embedder's ModifyUpstreamRequest, OnUpstreamRequest and
+// OnUpstreamResponse hooks around every upstream request. It wraps the other
+// clients, so a vetoed request never spends upstream budget and captures and
+// traces show the modified request.
+type hookClient struct {
+	HTTPClient
+	modify     func(*http.Request)
+	onRequest  func(*http.Request) error
+	onResponse func(*http.Response, *http.Request)
+}
+
+func (c *hookClient) Do(req *http.Request) (*http.Response, error) {
+	if c.modify != nil {
+		c.modify(req)
+	}
+	if c.onRequest != nil {
+		if err := c.onRequest(req); err != nil {
+			return nil, fmt.Errorf("%w: %w", errUpstreamVetoed, err)
+		}
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err == nil && c.onResponse != nil {
+		c.onResponse(resp, req)
+	}
+	return resp, err
+}
+
+// budgetClient caps the rate of requests sent upstream across all visitors, so a
+// traffic surge never turns the proxy into a flood against giscus.app.
+type budgetClient struct {
+	HTTPClient
+	limiter *middleware.RateLimiter
+}
+
+func (c *budgetClient) Do(req *http.Request) (*http.Response, error) {
+	if ok, wait := c.limiter.Allow("upstream"); !ok {
+		return nil, &budgetError{wait: wait.Seconds()}
+	}
+	return c.HTTPClient.Do(req)
+}
+
+type budgetError struct {
+	wait float64
+}
+
+func (e *budgetError) Error() string { return errUpstreamBudget.Error() }
+
+func (e *budgetError) Unwrap() error { return errUpstreamBudget }
+
+// observedClient reports the latency and status code ("error" for failed requests)
+// of every upstream request.
+type observedClient struct {
+	HTTPClient
+	observe func(code string, d time.Duration)
+}
+
+func (c *observedClient) Do(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := c.HTTPClient.Do(req)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	c.observe(code, time.Since(start))
+	return resp, err
+}
+
+// countError increments the error counters for kind.
+func (p *Proxy) countError(kind string) {
+	if er, ok := p.recorder.(ErrorRecorder); ok {
+		er.ObserveError(kind)
+	}
+}
+
+// upstreamError reports a failed upstream request to the client.
+func (p *Proxy) upstreamError(w http.ResponseWriter, r *http.Request, err error) {
+	var be *budgetError
+	if errors.As(err, &be) {
+		p.countError("upstream_budget")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(be.wait)))))
+		p.httpError(w, r, "upstream busy, try again shortly", http.StatusServiceUnavailable)
+		return
+	}
+	if errors.Is(err, errUpstreamVetoed) {
+		p.countError("upstream_vetoed")
+		p.debugf("upstream request vetoed: %v", err)
+		p.httpError(w, r, "forbidden", http.StatusForbidden)
+		return
+	}
+	p.countError("upstream")
+	p.reportError(r, "upstream", err)
+	p.httpError(w, r, fmt.Sprintf("upstream error: %v", err), http.StatusBadGateway)
+}
@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+)
+
+// Validate reports settings New would accept but can't work as intended, such
+// as a malformed UpstreamOrigin, widget paths without a leading slash or a cache
+// that holds no entries. Each problem names the field and what is expected; they
+// are joined into one error. New logs the same problems as warnings.
+func (cfg Config) Validate() error {
+	return errors.Join(cfg.problems()...)
+}
+
+func (cfg Config) problems() []error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if err := checkOrigin(cfg.UpstreamOrigin, false); err != nil {
+		add("UpstreamOrigin %q: %v, e.g. https://giscus.app", cfg.UpstreamOrigin, err)
+	}
+	if err := checkOrigin(cfg.APIOrigin, true); err != nil {
+		add("APIOrigin %q: %v, e.g. https://giscus.example.com", cfg.APIOrigin, err)
+	}
+	if err := checkOrigin(cfg.PublicOrigin, true); err != nil {
+		add("PublicOrigin %q: %v, e.g. https://comments.example.com", cfg.PublicOrigin, err)
+	}
+	if err := checkPath(cfg.WidgetSourcePath); err != nil {
+		add("WidgetSourcePath %q: %v, e.g. /en/widget", cfg.WidgetSourcePath, err)
+	}
+	for _, wp := range cfg.WidgetPaths {
+		if wp == "" || checkPath(wp) != nil {
+			add("WidgetPaths entry %q: must be a path starting with /, e.g. /widget", wp)
+		}
+	}
+	if b := strings.TrimSpace(cfg.BasePath); strings.ContainsAny(b, "?#") || strings.Contains(b, "//") {
+		add("BasePath %q: must be a plain path prefix, e.g. /giscus", cfg.BasePath)
+	}
+	if err := checkPath(cfg.AdminPrefix); err != nil {
+		add("AdminPrefix %q: %v, e.g. /_admin", cfg.AdminPrefix, err)
+	}
+	if err := checkPath(cfg.MetricsPath); err != nil {
+		add("MetricsPath %q: %v, e.g. /metrics", cfg.MetricsPath, err)
+	}
+	if c, ok := cache.As[interface{ Capacity() int }](cfg.Cache); ok && c.Capacity() < 1 {
+		add("Cache: capacity %d can't hold any entry; use at least 1 or leave Cache nil to disable caching", c.Capacity())
+	}
+
+	for _, d := range []struct {
+		name string
+		v    time.Duration
+	}{
+		{"UpstreamTimeout", cfg.UpstreamTimeout},
+		{"ReadyTimeout", cfg.ReadyTimeout},
+		{"StatsWindow", cfg.StatsWindow},
+		{"SlowThreshold", cfg.SlowThreshold},
+		{"SummaryInterval", cfg.SummaryInterval},
+		{"SnapshotCacheTTL", cfg.SnapshotCacheTTL},
+		{"FeedCacheTTL", cfg.FeedCacheTTL},
+		{"RemoteThemeCacheTTL", cfg.RemoteThemeCacheTTL},
+		{"ReactionsCacheTTL", cfg.ReactionsCacheTTL},
+	} {
+		if d.v < 0 {
+			add("%s %s: must not be negative; use 0 for the default", d.name, d.v)
+		}
+	}
+	for _, n := range []struct {
+		name string
+		v    float64
+	}{
+		{"RateLimitRPS", cfg.RateLimitRPS},
+		{"RateLimitBurst", float64(cfg.RateLimitBurst)},
+		{"UpstreamRPS", cfg.UpstreamRPS},
+		{"UpstreamBurst", float64(cfg.UpstreamBurst)},
+		{"MaxInFlight", float64(cfg.MaxInFlight)},
+	} {
+		if n.v < 0 {
+			add("%s %v: must not be negative; use 0 to disable", n.name, n.v)
+		}
+	}
+	names := map[string]bool{}
+	for i, t := range cfg.Tenants {
+		name := strings.TrimSpace(t.Name)
+		switch {
+		case name == "":
+			add("Tenants[%d]: Name is required", i)
+		case names[name]:
+			add("Tenants[%d]: duplicate name %q", i, name)
+		}
+		names[name] = true
+		if err := checkOrigin(t.UpstreamOrigin, true); err != nil {
+			add("Tenants[%d] UpstreamOrigin %q: %v, e.g. https://giscus.app", i, t.UpstreamOrigin, err)
+		}
+	}
+	profiles := map[string]bool{}
+	for i, pr := range cfg.Profiles {
+		name := strings.TrimSpace(pr.Name)
+		switch {
+		case name == "":
+			add("Profiles[%d]: Name is required", i)
+		case profiles[name]:
+			add("Profiles[%d]: duplicate name %q", i, name)
+		}
+		profiles[name] = true
+	}
+	if cfg.FeedRepo != "" {
+		if owner, name, ok := strings.Cut(strings.TrimSpace(cfg.FeedRepo), "/"); !ok || owner == "" || name == "" {
+			add("FeedRepo %q: must be OWNER/NAME, e.g. octo/blog", cfg.FeedRepo)
+		}
+		if cfg.GitHubToken == "" {
+			add("FeedRepo: requires GitHubToken")
+		}
+	}
+	for _, repo := range cfg.GitHubRepos {
+		if !repoRE.MatchString(strings.TrimSpace(repo)) {
+			add("GitHubRepos %q: must be OWNER/NAME, e.g. octo/blog", repo)
+		}
+	}
+	// New drops a whole list when one rule is malformed, so report each.
+	for _, raw := range cfg.Replacements {
+		if _, err := parseReplacers([]string{raw}); err != nil {
+			add("Replacements: %v", err)
+		}
+	}
+	for _, raw := range cfg.DOMRules {
+		if _, err := parseDOMRules([]string{raw}); err != nil {
+			add("DOMRules: %v", err)
+		}
+	}
+	for _, raw := range cfg.NextDataOverrides {
+		if _, err := parseNextDataOverrides([]string{raw}); err != nil {
+			add("NextDataOverrides: %v", err)
+		}
+	}
+	if (cfg.GitHubWebhookSecret == "") != (cfg.WebhookRelayURL == "") {
+		add("GitHubWebhookSecret and WebhookRelayURL: set both or neither")
+	}
+	if u, err := url.Parse(cfg.WebhookRelayURL); cfg.WebhookRelayURL != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		add("WebhookRelayURL %q: must be an http(s) URL", cfg.WebhookRelayURL)
+	}
+	switch strings.ToLower(cfg.WebhookRelayFormat) {
+	case "", RelaySlack, RelayDiscord, RelayJSON:
+	default:
+		add("WebhookRelayFormat %q: must be %s, %s or %s", cfg.WebhookRelayFormat, RelaySlack, RelayDiscord, RelayJSON)
+	}
+	if s := strings.TrimSpace(cfg.PinClientSHA256); s != "" {
+		if b, err := hex.DecodeString(s); err != nil || len(b) != sha256.Size {
+			add("PinClientSHA256 %q: must be a hex SHA-256 digest", cfg.PinClientSHA256)
+		}
+	}
+	if (cfg.AdminUser == "") != (cfg.AdminPassword == "") {
+		add("AdminUser and AdminPassword: set both or neither")
+	}
+	if (cfg.SiteUser == "") != (cfg.SitePassword == "") {
+		add("SiteUser and SitePassword: set both or neither")
+	}
+	return errs
+}
+
+// checkOrigin accepts "" or a bare http(s) origin; allowSlash tolerates a
+// trailing "/", which New trims.
+func checkOrigin(s string, allowSlash bool) error {
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return errors.New("not a valid URL")
+	}
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https":
+		return errors.New("must start with http:// or https://")
+	case u.Host == "":
+		return errors.New("has no host")
+	case u.User != nil:
+		return errors.New("must not contain credentials")
+	case u.RawQuery != "" || u.Fragment != "" || (u.Path != "" && !(allowSlash && u.Path == "/")):
+		return errors.New("must be a bare origin without path, query or fragment")
+	}
+	return nil
+}
+
+// checkPath accepts "" or an absolute URL path.
+func checkPath(s string) error {
+	if s == "" {
+		return nil
+	}
+	if !strings.HasPrefix(s, "/") {
+		return errors.New("must start with /")
+	}
+	if strings.ContainsAny(s, "?# ") {
+		return errors.New("must be a plain path")
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+)
+
+// newVars builds the proxy's expvar counters. The map is served by handleVars
+// rather than published globally, so several Proxy instances can coexist.
+func (p *Proxy) newVars() *expvar.Map {
+	m := new(expvar.Map).Init()
+	m.Set("in_flight", expvar.Func(func() any { return p.active.Load() }))
+	if ev, ok := cache.As[interface{ Evictions() uint64 }](p.cache); ok {
+		m.Set("cache_evictions", expvar.Func(func() any { return ev.Evictions() }))
+	}
+	return m
+}
+
+// varsRecorder counts measurements in the proxy's expvar map.
+type varsRecorder struct {
+	m *expvar.Map
+}
+
+func (v varsRecorder) ObserveRequest(route string, _, bytes int, _ time.Duration) {
+	v.m.Add("requests", 1)
+	v.m.Add("requests_"+route, 1)
+	v.m.Add("bytes_served", int64(bytes))
+}
+
+func (v varsRecorder) ObserveUpstream(string, time.Duration) {
+	v.m.Add("upstream_requests", 1)
+}
+
+func (v varsRecorder) ObserveCache(result string) {
+	switch result {
+	case "hit":
+		v.m.Add("cache_hits", 1)
+	case "miss":
+		v.m.Add("cache_misses", 1)
+	}
+}
+
+func (v varsRecorder) ObserveError(kind string) {
+	v.m.Add("errors_"+kind, 1)
+}
+
+// handleVars serves the global expvars (command line, memstats) together with
+// goroutine/GC figures and the proxy's own counters, in expvar's JSON layout.
+func (p *Proxy) handleVars(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, "{\n")
+	expvar.Do(func(kv expvar.KeyValue) {
+		fmt.Fprintf(w, "%q: %s,\n", kv.Key, kv.Value)
+	})
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	stats := map[string]any{
+		"goroutines":     runtime.NumGoroutine(),
+		"heap_alloc":     ms.HeapAlloc,
+		"heap_objects":   ms.HeapObjects,
+		"num_gc":         ms.NumGC,
+		"gc_pause_total": time.Duration(ms.PauseTotalNs).String(),
+	}
+	if ms.LastGC > 0 {
+		stats["last_gc"] = time.Unix(0, int64(ms.LastGC)).UTC().Format(time.RFC3339)
+	}
+	rt, _ := json.Marshal(stats)
+	fmt.Fprintf(w, "%q: %s,\n", "runtime", rt)
+	fmt.Fprintf(w, "%q: %s\n}\n", "giscus_proxy", p.vars.String())
+}
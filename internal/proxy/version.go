@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/cdlus/giscus-proxy/internal/version"
+)
+
+// VersionHeader carries the running version on every response unless
+// Config.HideVersion is set.
+const VersionHeader = "X-Giscus-Proxy-Version"
+
+// handleVersion reports the build the instance is running.
+func (p *Proxy) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, version.Get())
+}
+
+// versionHeader stamps responses with the running version.
+func (p *Proxy) versionHeader(next http.Handler) http.Handler {
+	v := version.Get().Version
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(VersionHeader, v)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// maxWebhookBody bounds GitHub webhook payloads; discussion events are small.
+	maxWebhookBody = 1 << 20
+	// maxRelayedBody is how much of a comment notifications quote.
+	maxRelayedBody = 500
+	relayTimeout   = 10 * time.Second
+)
+
+// Relay formats understood by WebhookRelayFormat.
+const (
+	RelaySlack   = "slack"
+	RelayDiscord = "discord"
+	RelayJSON    = "json"
+)
+
+// webhookRelay forwards GitHub discussion comment events to a chat or webhook URL.
+type webhookRelay struct {
+	secret string
+	target string
+	format string
+	// client posts to target. It is not the upstream client, whose tracing and
+	// capture would record the URL and the credentials in it.
+	client *http.Client
+}
+
+func newWebhookRelay(secret, target, format string) *webhookRelay {
+	return &webhookRelay{
+		secret: secret,
+		target: target,
+		format: relayFormat(format, target),
+		client: &http.Client{Timeout: relayTimeout},
+	}
+}
+
+// relayFormat returns format, or the one target's host calls for.
+func relayFormat(format, target string) string {
+	if format != "" {
+		return strings.ToLower(format)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return RelayJSON
+	}
+	switch host := strings.ToLower(u.Hostname()); {
+	case host == "hooks.slack.com":
+		return RelaySlack
+	case (host == "discord.com" || host == "discordapp.com") && strings.HasPrefix(u.Path, "/api/webhooks/"):
+		return RelayDiscord
+	}
+	return RelayJSON
+}
+
+// commentEvent is the part of a discussion_comment payload notifications use.
+type commentEvent struct {
+	Action  string `json:"action"`
+	Comment struct {
+		Body    string `json:"body"`
+		HTMLURL string `json:"html_url"`
+		User    struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	} `json:"comment"`
+	Discussion struct {
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+	} `json:"discussion"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// handleGitHubHook accepts GitHub webhooks signed with GitHubWebhookSecret and
+// relays discussion_comment events to WebhookRelayURL. Other events are
+// acknowledged and dropped. Relay failures answer 502 so GitHub records the
+// delivery as failed and it can be redelivered.
+func (p *Proxy) handleGitHubHook(w http.ResponseWriter, r *http.Request) {
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	var ph phases
+	r, span := p.startSpan(r, "hook")
+	defer func() {
+		p.logLine(r, "hook", sw.status, sw.written, time.Since(start), "BYPASS", relayName(p.relay))
+		p.logSlow(r, "hook", sw.status, time.Since(start), &ph)
+		p.endSpan(span, sw.status, "BYPASS", relayName(p.relay))
+	}()
+	w = sw
+
+	if r.Method != http.MethodPost {
+		p.httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		p.httpError(w, r, "failed to read payload", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if !validHookSignature(p.relay.secret, r.Header.Get("X-Hub-Signature-256"), body) {
+		p.httpError(w, r, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get("X-GitHub-Event") != "discussion_comment" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var ev commentEvent
+	if err := json.Unmarshal(body, &ev); err != nil {
+		p.httpError(w, r, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	ph.begin()
+	err = p.relay.send(r.Context(), &ev)
+	ph.end(&ph.upstream)
+	if err != nil {
+		p.reportError(r, "webhook relay", err)
+		p.httpError(w, r, "failed to relay event", http.StatusBadGateway)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validHookSignature checks GitHub's X-Hub-Signature-256 header for body.
+func validHookSignature(secret, header string, body []byte) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal([]byte(sig), []byte(hex.EncodeToString(mac.Sum(nil))))
+}
+
+// send posts a notification about ev to the relay target. Errors name the
+// target's host only.
+func (wr *webhookRelay) send(ctx context.Context, ev *commentEvent) error {
+	payload, err := json.Marshal(wr.message(ev))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, relayTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wr.target, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := wr.client.Do(req)
+	if err != nil {
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			return fmt.Errorf("%s %s: %w", ue.Op, req.URL.Host, ue.Err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("relay target returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// message renders ev in the relay's format.
+func (wr *webhookRelay) message(ev *commentEvent) any {
+	verb := "commented on"
+	switch ev.Action {
+	case "edited":
+		verb = "edited a comment on"
+	case "deleted":
+		verb = "deleted a comment on"
+	}
+	who, title, link, repo := ev.Comment.User.Login, ev.Discussion.Title, ev.Comment.HTMLURL, ev.Repository.FullName
+	if link == "" {
+		link = ev.Discussion.HTMLURL
+	}
+	body := []rune(strings.TrimSpace(ev.Comment.Body))
+	if len(body) > maxRelayedBody {
+		body = append(body[:maxRelayedBody], '…')
+	}
+	quote := func(s string) string { return "\n> " + strings.ReplaceAll(s, "\n", "\n> ") }
+	switch wr.format {
+	case RelaySlack:
+		esc := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+		text := fmt.Sprintf("*%s* %s <%s|%s> in %s", esc.Replace(who), verb, link, esc.Replace(title), esc.Replace(repo))
+		if ev.Action != "deleted" {
+			text += quote(esc.Replace(string(body)))
+		}
+		return map[string]any{"text": text}
+	case RelayDiscord:
+		text := fmt.Sprintf("**%s** %s [%s](<%s>) in %s", who, verb, title, link, repo)
+		if ev.Action != "deleted" {
+			text += quote(string(body))
+		}
+		return map[string]any{"content": text, "allowed_mentions": map[string]any{"parse": []string{}}}
+	}
+	return map[string]any{
+		"event":      "discussion_comment",
+		"action":     ev.Action,
+		"repository": repo,
+		"discussion": map[string]string{"title": title, "url": ev.Discussion.HTMLURL},
+		"comment":    map[string]string{"author": who, "url": ev.Comment.HTMLURL, "body": ev.Comment.Body},
+	}
+}
+
+// relayName describes the relay in the admin config dump without its URL,
+// which embeds credentials for Slack and Discord.
+func relayName(wr *webhookRelay) string {
+	if wr == nil {
+		return ""
+	}
+	return wr.format
+}
@@ -1,91 +1,213 @@
 package proxy
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/middleware"
 )
 
 func (p *Proxy) handleWidget(w http.ResponseWriter, r *http.Request) {
 	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
 	start := time.Now()
 	var target string
+	var ph phases
+	r, span := p.startSpan(r, "widget")
 	defer func() {
-		p.logLine("widget", r.Method, r.URL.RequestURI(), sw.status, sw.written, time.Since(start), "", target)
+		p.logLine(r, "widget", sw.status, sw.written, time.Since(start), "", target)
+		p.logSlow(r, "widget", sw.status, time.Since(start), &ph)
+		p.endSpan(span, sw.status, "", target)
 	}()
 	w = sw
+	r = r.WithContext(context.WithValue(r.Context(), widgetPageKey{}, true))
 
+	if !p.checkOrigin(w, r) || !p.checkSite(w, r) || !p.checkBot(w, r) {
+		return
+	}
 	if r.Method == http.MethodOptions {
-		writeCORS(w)
+		p.writeCORS(w, r)
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 	if r.Method != http.MethodGet && r.Method != http.MethodHead {
-		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		p.httpError(w, r, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !p.checkRepo(w, r) {
 		return
 	}
 
-	q := r.URL.Query()
-	reps, err := parseReplacers(q)
+	pr, err := p.profileFor(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		p.httpError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
+
+	q := r.URL.Query()
+	reps := p.replacers
+	if t := p.tenantFor(r); t != nil && t.replacers != nil {
+		reps = t.replacers
+	}
+	if pr != nil && len(pr.replacers) > 0 {
+		reps = append(reps[:len(reps):len(reps)], pr.replacers...)
+	}
+	if p.queryReplacers && len(q["rep"]) > 0 {
+		for _, raw := range q["rep"] {
+			if !p.repAllowed(raw) {
+				p.httpError(w, r, fmt.Sprintf("rep value %q not allowed", raw), http.StatusForbidden)
+				return
+			}
+		}
+		qreps, err := p.repCache.parse(q["rep"])
+		if err != nil {
+			p.httpError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reps = append(reps[:len(reps):len(reps)], qreps...)
+	}
+	reps = p.expandReplacers(reps, r, "text/html")
+	if len(p.baseReplacers) > 0 {
+		reps = append(reps[:len(reps):len(reps)], p.baseReplacers...)
+	}
+	reps = append(reps[:len(reps):len(reps)], p.mirrorReplacers(r)...)
 	tq := url.Values{}
 	for k, vs := range q {
-		if k == "rep" {
+		if k == "rep" || k == "sig" || k == "exp" || k == "site" || k == "profile" {
 			continue
 		}
 		for _, v := range vs {
 			tq.Add(k, v)
 		}
 	}
-	target = p.upstreamOrigin + p.widgetSourcePath
+	if pr != nil && pr.theme != "" && tq.Get("theme") == "" {
+		tq.Set("theme", pr.theme)
+	}
+	if theme := tq.Get("theme"); p.remoteThemes != nil && isRemoteTheme(theme) {
+		tq.Set("theme", p.remoteThemeURL(r, theme))
+	}
+	target = p.upstreamFor(r) + p.widgetSource(pr)
 	if enc := tq.Encode(); enc != "" {
 		target += "?" + enc
 	}
 
-	req, err := http.NewRequest(http.MethodGet, target, nil)
+	ctx := context.WithValue(r.Context(), widgetFetchKey{}, true)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
 	if err != nil {
-		http.Error(w, "failed to build upstream request", http.StatusInternalServerError)
+		p.httpError(w, r, "failed to build upstream request", http.StatusInternalServerError)
 		return
 	}
+	p.headerPolicy.forward(req.Header, r.Header)
+	if id := middleware.RequestIDFrom(r.Context()); id != "" {
+		req.Header.Set(middleware.RequestIDHeader, id)
+	}
 	req.Header.Set("Accept-Encoding", "identity")
 	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
-	req.Header.Set("User-Agent", "giscus-proxy/clean-1.0")
+	req.Header.Set("User-Agent", userAgent)
 
+	ph.begin()
 	resp, err := p.client.Do(req)
+	ph.end(&ph.upstream)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("upstream error: %v", err), http.StatusBadGateway)
+		p.upstreamError(w, r, err)
 		return
 	}
 	defer resp.Body.Close()
+	p.debugUpstream(req, resp)
+	if resp.StatusCode >= 500 {
+		// giscus's own error page would be of no more use to visitors.
+		p.countError("upstream")
+		p.httpError(w, r, fmt.Sprintf("upstream returned %d", resp.StatusCode), http.StatusBadGateway)
+		return
+	}
 
-	writeCORS(w)
+	p.writeCORS(w, r)
 	copyIf(w.Header(), resp.Header, "Content-Type")
 
 	body, clean, decErr := decompressIfNeeded(resp.Header, resp.Body)
 	if decErr != nil {
 		w.WriteHeader(resp.StatusCode)
+		ph.begin()
 		_, _ = io.Copy(w, resp.Body)
+		ph.end(&ph.write)
 		return
 	}
 	defer clean()
 
-	bin, err := io.ReadAll(body)
+	if !p.bufferedTransforms(r) && streamable(reps) {
+		w.WriteHeader(resp.StatusCode)
+		if r.Method == http.MethodHead {
+			return
+		}
+		chain := reps
+		if p.removeFooter {
+			chain = append(append([]replacer(nil), reps...), footerReplacers...)
+		}
+		ph.begin()
+		err := streamReplace(w, body, chain)
+		ph.end(&ph.write)
+		if err != nil {
+			p.reportError(r, "widget stream", err)
+		}
+		return
+	}
+
+	ph.begin()
+	buf, err := readPooled(body)
+	defer putBuffer(buf)
+	bin := buf.Bytes()
+	ph.end(&ph.upstream)
 	if err != nil {
 		w.WriteHeader(resp.StatusCode)
 		_, _ = w.Write([]byte(fmt.Sprintf("<!-- read body failed: %v -->", err)))
 		return
 	}
 
-	bin = applyReplacements(bin, reps)
-	bin = widgetFooterSwap(bin)
+	ph.begin()
+	if len(p.domRules) > 0 && isHTML(resp.Header.Get("Content-Type")) {
+		if out, err := applyDOMRules(bin, p.domRules); err != nil {
+			p.reportError(r, "dom transform", err)
+		} else {
+			bin = out
+		}
+	}
+	if len(p.nextData) > 0 {
+		if out, err := applyNextData(bin, p.nextData); err != nil {
+			p.reportError(r, "next data transform", err)
+		} else {
+			bin = out
+		}
+	}
+	if capped, dropped := capUntrustedRegex(reps, len(bin)); dropped {
+		p.warnf("widget body of %d bytes exceeds regex input cap, skipping rep regexes", len(bin))
+		reps = capped
+	}
+	if p.stripTelemetry {
+		bin = stripTelemetry(bin, resp.Header.Get("Content-Type"))
+	}
+	chain := []Transformer{replacements(reps)}
+	if p.removeFooter {
+		chain = append(chain, widgetFooterSwap)
+	}
+	chain = append(chain, p.transformers...)
+	chain = append(chain, requestTransformers(r)...)
+	bin = transform(resp.Header.Get("Content-Type"), bin, chain...)
+	if len(p.snippets) > 0 && isHTML(resp.Header.Get("Content-Type")) {
+		bin = injectSnippets(bin, p.snippets)
+	}
+	if p.sriActive(r) && isHTML(resp.Header.Get("Content-Type")) {
+		bin = p.fixIntegrity(r, bin)
+	}
+	bin = p.minifyBody(resp.Header.Get("Content-Type"), bin)
+	ph.end(&ph.transform)
 
 	w.WriteHeader(resp.StatusCode)
 	if r.Method != http.MethodHead {
+		ph.begin()
 		_, _ = w.Write(bin)
+		ph.end(&ph.write)
 	}
 }
@@ -0,0 +1,161 @@
+// Package sentry is a minimal Sentry client that sends errors as envelope events
+// over HTTP, without pulling in the full SDK.
+package sentry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Client reports errors to the project identified by a DSN.
+type Client struct {
+	endpoint    string
+	auth        string
+	dsn         string
+	environment string
+	release     string
+	serverName  string
+	http        *http.Client
+}
+
+// New parses a DSN of the form https://PUBLIC_KEY@HOST/PROJECT_ID.
+func New(dsn, environment, release string) (*Client, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("sentry: invalid DSN: %w", err)
+	}
+	key := u.User.Username()
+	project := strings.TrimPrefix(u.Path, "/")
+	if key == "" || project == "" || u.Host == "" {
+		return nil, errors.New("sentry: DSN must look like https://KEY@HOST/PROJECT")
+	}
+	prefix := ""
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		prefix, project = "/"+project[:i], project[i+1:]
+	}
+	host, _ := os.Hostname()
+	return &Client{
+		endpoint:    fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project),
+		auth:        "Sentry sentry_version=7, sentry_client=giscus-proxy/1.0, sentry_key=" + key,
+		dsn:         dsn,
+		environment: environment,
+		release:     release,
+		serverName:  host,
+		http:        &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+type exception struct {
+	Type       string      `json:"type"`
+	Value      string      `json:"value"`
+	Stacktrace *stacktrace `json:"stacktrace,omitempty"`
+}
+
+type stacktrace struct {
+	Frames []frame `json:"frames"`
+}
+
+type frame struct {
+	Function string `json:"function,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+type event struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Release     string            `json:"release,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Exception   struct {
+		Values []exception `json:"values"`
+	} `json:"exception"`
+	Extra map[string]string `json:"extra,omitempty"`
+}
+
+// Report sends err in the background. Errors exposing a Stack() []byte method
+// (such as recovered panics) include it as the event's stack trace.
+func (c *Client) Report(_ context.Context, err error, tags map[string]string) {
+	ev := event{
+		EventID:     newEventID(),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339),
+		Platform:    "go",
+		Level:       "error",
+		Logger:      "giscus-proxy",
+		ServerName:  c.serverName,
+		Environment: c.environment,
+		Release:     c.release,
+		Tags:        tags,
+	}
+	exc := exception{Type: fmt.Sprintf("%T", err), Value: err.Error()}
+	var st interface{ Stack() []byte }
+	if errors.As(err, &st) {
+		exc.Stacktrace = parseStack(st.Stack())
+		ev.Extra = map[string]string{"stack": string(st.Stack())}
+	}
+	ev.Exception.Values = []exception{exc}
+	go c.send(ev)
+}
+
+func (c *Client) send(ev event) {
+	header, _ := json.Marshal(map[string]string{"event_id": ev.EventID, "dsn": c.dsn, "sent_at": ev.Timestamp})
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	var body bytes.Buffer
+	body.Write(header)
+	body.WriteString("\n{\"type\":\"event\"}\n")
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, &body)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", c.auth)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
+func newEventID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// parseStack converts a runtime/debug stack into Sentry frames, oldest call first.
+func parseStack(stack []byte) *stacktrace {
+	lines := strings.Split(strings.TrimSpace(string(stack)), "\n")
+	var frames []frame
+	// Skip the "goroutine N [running]:" header; frames come as function/file line pairs.
+	for i := 1; i+1 < len(lines); i += 2 {
+		fn := strings.TrimSpace(lines[i])
+		file := strings.TrimSpace(lines[i+1])
+		if j := strings.LastIndex(file, " +0x"); j >= 0 {
+			file = file[:j]
+		}
+		frames = append(frames, frame{Function: fn, Filename: file})
+	}
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return &stacktrace{Frames: frames}
+}
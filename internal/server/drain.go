@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Drain controls how a server stops once asked to: readiness is flipped first,
+// then after Delay the listeners close and in-flight requests get up to Timeout
+// to finish before their connections are cut.
+type Drain struct {
+	// Delay gives load balancers time to notice the failing readiness probe and
+	// stop routing new requests here before the listeners close.
+	Delay time.Duration
+	// Timeout bounds how long in-flight requests may take to complete.
+	Timeout time.Duration
+	// Drained, when set, reports whether draining already started before the
+	// shutdown signal (e.g. from a Kubernetes preStop hook that waited out the
+	// delay itself); Delay is then skipped.
+	Drained func() bool
+}
+
+// Run calls serve, which must block serving srv, until it fails or ctx is done.
+// In the latter case onDrain runs (typically to fail readiness) and srv shuts
+// down gracefully. A clean shutdown returns nil.
+func (d Drain) Run(ctx context.Context, srv *http.Server, serve func() error, onDrain func()) error {
+	errc := make(chan error, 1)
+	go func() { errc <- serve() }()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	predrained := d.Drained != nil && d.Drained()
+	if onDrain != nil {
+		onDrain()
+	}
+	if d.Delay > 0 && !predrained {
+		time.Sleep(d.Delay)
+	}
+	shutdownCtx := context.Background()
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, d.Timeout)
+		defer cancel()
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		// Past the deadline: drop the remaining connections rather than hang.
+		srv.Close()
+		return err
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
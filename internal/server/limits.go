@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/netutil"
+)
+
+// Limits bounds what a single instance hands out to clients, so slow or flooding
+// connections can't pin every goroutine and file descriptor.
+type Limits struct {
+	// MaxConns caps simultaneously open connections; further connections wait in the
+	// kernel backlog until one closes. Zero means unlimited.
+	MaxConns int
+
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+
+	// SocketMode sets the permissions of Unix domain sockets; zero keeps the umask default.
+	SocketMode os.FileMode
+
+	// ReusePort binds TCP listeners with SO_REUSEPORT, so a new instance can start
+	// on the same port before the old one stops.
+	ReusePort bool
+}
+
+// Apply installs the non-zero timeouts on srv.
+func (l Limits) Apply(srv *http.Server) {
+	if l.ReadTimeout > 0 {
+		srv.ReadTimeout = l.ReadTimeout
+	}
+	if l.WriteTimeout > 0 {
+		srv.WriteTimeout = l.WriteTimeout
+	}
+	if l.IdleTimeout > 0 {
+		srv.IdleTimeout = l.IdleTimeout
+	}
+}
+
+// Listen opens a listener on addr, limited to MaxConns connections. Addresses of
+// the form "unix:/path/to.sock" listen on a Unix domain socket; anything else is TCP.
+// In a process started by Upgrade, the listener handed over for addr is reused.
+func (l Limits) Listen(addr string) (net.Listener, error) {
+	ln, ok := inheritedListener(addr)
+	if !ok {
+		var err error
+		if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+			ln, err = l.listenUnix(path)
+		} else {
+			lc := net.ListenConfig{}
+			if l.ReusePort {
+				lc.Control = reusePort
+			}
+			ln, err = lc.Listen(context.Background(), "tcp", addr)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	trackListener(addr, ln)
+	if l.MaxConns > 0 {
+		ln = netutil.LimitListener(ln, l.MaxConns)
+	}
+	return ln, nil
+}
+
+// ListenAll opens a listener per address; MaxConns applies to each. On failure the
+// listeners opened so far are closed.
+func (l Limits) ListenAll(addrs []string) ([]net.Listener, error) {
+	lns := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		ln, err := l.Listen(addr)
+		if err != nil {
+			for _, opened := range lns {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("listen %s: %w", addr, err)
+		}
+		lns = append(lns, ln)
+	}
+	return lns, nil
+}
+
+func (l Limits) listenUnix(path string) (net.Listener, error) {
+	// A socket left behind by a previous run would make the bind fail; only
+	// sockets are removed, never regular files.
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if l.SocketMode != 0 {
+		if err := os.Chmod(path, l.SocketMode); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// ServeAll runs serve on every listener concurrently and returns the first error,
+// typically http.ErrServerClosed once the server shuts down.
+func ServeAll(lns []net.Listener, serve func(net.Listener) error) error {
+	errc := make(chan error, len(lns))
+	for _, ln := range lns {
+		go func() { errc <- serve(ln) }()
+	}
+	return <-errc
+}
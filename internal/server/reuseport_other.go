@@ -0,0 +1,10 @@
+//go:build !unix
+
+package server
+
+import "syscall"
+
+// reusePort is unavailable on this platform; binding proceeds without it.
+func reusePort(network, address string, c syscall.RawConn) error {
+	return nil
+}
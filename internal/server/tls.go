@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLS describes how the server terminates HTTPS itself: either with certificate
+// files or with certificates issued automatically through ACME (Let's Encrypt).
+type TLS struct {
+	CertFile string
+	KeyFile  string
+
+	ACMEDomains  []string
+	ACMEEmail    string
+	ACMECacheDir string
+
+	// RedirectAddr is where the plain HTTP listener serving ACME HTTP-01 challenges
+	// and HTTP→HTTPS redirects binds. Empty disables it.
+	RedirectAddr string
+
+	// HTTP3 additionally serves HTTP/3 over QUIC on the UDP port of every TCP
+	// listener and advertises it with an Alt-Svc header.
+	HTTP3 bool
+}
+
+// Enabled reports whether HTTPS is configured.
+func (t TLS) Enabled() bool {
+	return (t.CertFile != "" && t.KeyFile != "") || len(t.ACMEDomains) > 0
+}
+
+// Configure installs the TLS settings on srv and returns the handler for the plain
+// HTTP listener, which answers ACME challenges and redirects everything else to HTTPS.
+func (t TLS) Configure(srv *http.Server) (http.Handler, error) {
+	if !t.Enabled() {
+		return nil, errors.New("tls: neither certificate files nor ACME domains configured")
+	}
+	redirect := http.HandlerFunc(redirectHTTPS)
+	if len(t.ACMEDomains) == 0 {
+		srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		return redirect, nil
+	}
+
+	cacheDir := t.ACMECacheDir
+	if cacheDir == "" {
+		cacheDir = "acme-cache"
+	}
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(t.ACMEDomains...),
+		Cache:      autocert.DirCache(cacheDir),
+		Email:      t.ACMEEmail,
+	}
+	srv.TLSConfig = m.TLSConfig()
+	srv.TLSConfig.MinVersion = tls.VersionTLS12
+	return m.HTTPHandler(redirect), nil
+}
+
+// Serve serves srv over HTTPS on every listener, starting the redirect listener
+// when configured.
+func (t TLS) Serve(srv *http.Server, lns ...net.Listener) error {
+	httpHandler, err := t.Configure(srv)
+	if err != nil {
+		return err
+	}
+	if t.RedirectAddr != "" {
+		redirectSrv := &http.Server{
+			Addr:              t.RedirectAddr,
+			Handler:           httpHandler,
+			ReadHeaderTimeout: srv.ReadHeaderTimeout,
+			ReadTimeout:       srv.ReadTimeout,
+			WriteTimeout:      srv.WriteTimeout,
+			IdleTimeout:       srv.IdleTimeout,
+			ErrorLog:          srv.ErrorLog,
+		}
+		srv.RegisterOnShutdown(func() { _ = redirectSrv.Shutdown(context.Background()) })
+		// SO_REUSEPORT lets the process started by an upgrade bind the redirect
+		// listener while this one still drains.
+		lc := net.ListenConfig{Control: reusePort}
+		go func() {
+			redirectLn, err := lc.Listen(context.Background(), "tcp", t.RedirectAddr)
+			if err == nil {
+				err = redirectSrv.Serve(redirectLn)
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) && srv.ErrorLog != nil {
+				srv.ErrorLog.Printf("http redirect listener: %v", err)
+			}
+		}()
+	}
+	if t.HTTP3 {
+		if err := t.serveHTTP3(srv, lns); err != nil {
+			return err
+		}
+	}
+	// With ACME the certificate comes from TLSConfig.GetCertificate, so the file names stay empty.
+	return ServeAll(lns, func(ln net.Listener) error {
+		return srv.ServeTLS(ln, t.CertFile, t.KeyFile)
+	})
+}
+
+// serveHTTP3 starts an HTTP/3 server next to srv on the UDP counterpart of each TCP
+// listener. It stops when srv shuts down.
+func (t TLS) serveHTTP3(srv *http.Server, lns []net.Listener) error {
+	tlsConf := srv.TLSConfig.Clone()
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return err
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+	h3 := &http3.Server{
+		Handler:        srv.Handler,
+		TLSConfig:      http3.ConfigureTLSConfig(tlsConf),
+		IdleTimeout:    srv.IdleTimeout,
+		MaxHeaderBytes: srv.MaxHeaderBytes,
+	}
+	var conns []net.PacketConn
+	for _, ln := range lns {
+		if _, ok := ln.Addr().(*net.TCPAddr); !ok {
+			continue
+		}
+		// As with the redirect listener, SO_REUSEPORT allows an upgrade to bind the
+		// same UDP port.
+		lc := net.ListenConfig{Control: reusePort}
+		conn, err := lc.ListenPacket(context.Background(), "udp", ln.Addr().String())
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			return fmt.Errorf("http3: %w", err)
+		}
+		conns = append(conns, conn)
+	}
+	for _, conn := range conns {
+		go func() {
+			if err := h3.Serve(conn); err != nil && !errors.Is(err, http.ErrServerClosed) && srv.ErrorLog != nil {
+				srv.ErrorLog.Printf("http3 listener %s: %v", conn.LocalAddr(), err)
+			}
+		}()
+	}
+	srv.RegisterOnShutdown(func() { _ = h3.Shutdown(context.Background()) })
+
+	next := srv.Handler
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = h3.SetQUICHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+	return nil
+}
+
+func redirectHTTPS(w http.ResponseWriter, r *http.Request) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+}
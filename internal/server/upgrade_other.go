@@ -0,0 +1,21 @@
+//go:build !unix
+
+package server
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+func inheritedListener(addr string) (net.Listener, bool) { return nil, false }
+
+func trackListener(addr string, ln net.Listener) {}
+
+// Ready is a no-op on platforms without upgrade support.
+func Ready() error { return nil }
+
+// Upgrade is not supported on this platform.
+func Upgrade(timeout time.Duration) (int, error) {
+	return 0, errors.New("binary upgrades are not supported on this platform")
+}
@@ -0,0 +1,190 @@
+//go:build unix
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The parent of an upgrade passes its listeners as file descriptors 3..N, named
+// by inheritAddrsEnv in the same order, and a pipe at readyFDEnv that the child
+// writes to once it serves.
+const (
+	inheritAddrsEnv = "GISCUS_PROXY_INHERIT_ADDRS"
+	readyFDEnv      = "GISCUS_PROXY_READY_FD"
+)
+
+var (
+	listenersMu sync.Mutex
+	// opened holds the listeners Listen created or inherited, unwrapped, so an
+	// upgrade can hand them on.
+	opened []openListener
+	// inherited holds listeners passed down by the parent not yet claimed by Listen.
+	inherited map[string]net.Listener
+	upgrading atomic.Bool
+)
+
+type openListener struct {
+	addr string
+	ln   net.Listener
+}
+
+func init() {
+	v := os.Getenv(inheritAddrsEnv)
+	os.Unsetenv(inheritAddrsEnv)
+	if v == "" {
+		return
+	}
+	inherited = make(map[string]net.Listener)
+	for i, addr := range strings.Split(v, "\n") {
+		f := os.NewFile(uintptr(3+i), addr)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		// Own the socket file like a freshly bound listener would.
+		if ul, ok := ln.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(true)
+		}
+		inherited[addr] = ln
+	}
+}
+
+// inheritedListener claims the listener the parent process passed for addr.
+func inheritedListener(addr string) (net.Listener, bool) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	ln, ok := inherited[addr]
+	delete(inherited, addr)
+	return ln, ok
+}
+
+func trackListener(addr string, ln net.Listener) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	opened = append(opened, openListener{addr, ln})
+}
+
+// Ready tells the parent of an upgrade that this process is serving, so it can
+// drain and exit, and closes inherited listeners no address claimed. It is a
+// no-op when the process wasn't started by Upgrade.
+func Ready() error {
+	listenersMu.Lock()
+	for _, ln := range inherited {
+		ln.Close()
+	}
+	inherited = nil
+	listenersMu.Unlock()
+
+	v := os.Getenv(readyFDEnv)
+	os.Unsetenv(readyFDEnv)
+	if v == "" {
+		return nil
+	}
+	fd, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", readyFDEnv, err)
+	}
+	f := os.NewFile(uintptr(fd), "upgrade-ready")
+	defer f.Close()
+	_, err = f.Write([]byte{1})
+	return err
+}
+
+// Upgrade starts a new copy of the executable with the same arguments and
+// environment, hands it every listener Listen opened and waits until it calls
+// Ready. On success it returns the new process ID and the caller should shut
+// down gracefully: the new process accepts on the same sockets, so no connection
+// is refused during the handoff. If the new process exits or isn't ready within
+// timeout it is killed and this one keeps serving.
+func Upgrade(timeout time.Duration) (int, error) {
+	if !upgrading.CompareAndSwap(false, true) {
+		return 0, errors.New("an upgrade is already in progress")
+	}
+	defer upgrading.Store(false)
+
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	listenersMu.Lock()
+	handoff := append([]openListener(nil), opened...)
+	listenersMu.Unlock()
+
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	addrs := make([]string, 0, len(handoff))
+	for _, o := range handoff {
+		fl, ok := o.ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			return 0, fmt.Errorf("listener %s can't be handed over", o.addr)
+		}
+		f, err := fl.File()
+		if err != nil {
+			return 0, fmt.Errorf("listener %s: %w", o.addr, err)
+		}
+		files = append(files, f)
+		addrs = append(addrs, o.addr)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(),
+		inheritAddrsEnv+"="+strings.Join(addrs, "\n"),
+		readyFDEnv+"="+strconv.Itoa(3+len(files)),
+	)
+	cmd.ExtraFiles = append(files, w)
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		b := make([]byte, 1)
+		if _, err := r.Read(b); err != nil {
+			ready <- errors.New("new process exited before it was ready")
+			return
+		}
+		ready <- nil
+	}()
+	select {
+	case err = <-ready:
+	case <-time.After(timeout):
+		err = fmt.Errorf("new process not ready after %s", timeout)
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return 0, err
+	}
+	// The new process owns the sockets now; closing ours must not remove them.
+	for _, o := range handoff {
+		if ul, ok := o.ln.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	// Reap the child if it ever exits while this process is still around.
+	go func() { _ = cmd.Wait() }()
+	return cmd.Process.Pid, nil
+}
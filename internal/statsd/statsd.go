@@ -0,0 +1,78 @@
+// Package statsd pushes metrics over UDP using the StatsD line protocol, with
+// optional DogStatsD tags for Datadog agents.
+package statsd
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client sends metrics to a StatsD daemon. Sends are fire-and-forget; a missing
+// daemon never slows the proxy down.
+type Client struct {
+	conn    net.Conn
+	prefix  string
+	tags    []string
+	datadog bool
+}
+
+// Dial connects to the daemon at addr (host:port). Every metric name is prefixed
+// with prefix. With datadog set, tags ("key:value") are sent in the DogStatsD
+// "|#" extension; otherwise their values are appended to the metric name.
+func Dial(addr, prefix string, tags []string, datadog bool) (*Client, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, prefix: prefix, tags: tags, datadog: datadog}, nil
+}
+
+// Count adds v to a counter.
+func (c *Client) Count(name string, v int64, tags ...string) {
+	c.send(name, strconv.FormatInt(v, 10), "c", tags)
+}
+
+// Timing records a duration in milliseconds.
+func (c *Client) Timing(name string, d time.Duration, tags ...string) {
+	c.send(name, strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64), "ms", tags)
+}
+
+// Close releases the UDP socket.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) send(name, value, kind string, tags []string) {
+	var b strings.Builder
+	b.WriteString(c.prefix)
+	b.WriteString(name)
+	if !c.datadog {
+		for _, t := range tags {
+			_, v, _ := strings.Cut(t, ":")
+			b.WriteByte('.')
+			b.WriteString(sanitize(v))
+		}
+	}
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(kind)
+	if c.datadog && len(c.tags)+len(tags) > 0 {
+		b.WriteString("|#")
+		b.WriteString(strings.Join(append(append([]string(nil), c.tags...), tags...), ","))
+	}
+	_, _ = c.conn.Write([]byte(b.String()))
+}
+
+// sanitize keeps tag values usable as metric name segments.
+func sanitize(v string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, v)
+}
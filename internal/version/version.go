@@ -0,0 +1,80 @@
+// Package version describes the running build. Release builds set the variables
+// with -ldflags; otherwise they fall back to what the Go toolchain recorded:
+//
+//	go build -ldflags "-X github.com/cdlus/giscus-proxy/internal/version.Version=v1.2.3 \
+//		-X github.com/cdlus/giscus-proxy/internal/version.Commit=$(git rev-parse HEAD) \
+//		-X github.com/cdlus/giscus-proxy/internal/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/giscus-proxy
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Set at build time; see the package documentation.
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+// Info is the build description served at /version.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// Get returns the build description, filling unset fields from the module and
+// VCS information embedded by the Go toolchain.
+var Get = sync.OnceValue(func() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if info.Version == "dev" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = s.Value
+			}
+		case "vcs.time":
+			if info.Date == "" {
+				info.Date = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+})
+
+// String formats the description on one line, as printed by -version.
+func (i Info) String() string {
+	s := "giscus-proxy " + i.Version
+	if i.Commit != "" {
+		s += " (commit " + i.Commit
+		if i.Modified {
+			s += "+dirty"
+		}
+		if i.Date != "" {
+			s += ", built " + i.Date
+		}
+		s += ")"
+	}
+	return s + " " + i.GoVersion + " " + i.Platform
+}
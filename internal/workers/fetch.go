@@ -0,0 +1,83 @@
+//go:build js && wasm
+
+package workers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"syscall/js"
+)
+
+// Transport sends requests with the Workers fetch API. Unlike net/http's own
+// js transport it passes only options the Workers runtime implements, and leaves
+// redirects to http.Client.
+type Transport struct{}
+
+// RoundTrip implements http.RoundTripper.
+func (Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	init := js.Global().Get("Object").New()
+	init.Set("method", req.Method)
+	init.Set("redirect", "manual")
+	headers := js.Global().Get("Headers").New()
+	for k, vs := range req.Header {
+		for _, v := range vs {
+			headers.Call("append", k, v)
+		}
+	}
+	init.Set("headers", headers)
+	if req.Body != nil && req.Body != http.NoBody {
+		b, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > 0 {
+			init.Set("body", bytesTo(b))
+		}
+	}
+	if ctx := req.Context(); ctx.Done() != nil {
+		ac := js.Global().Get("AbortController").New()
+		init.Set("signal", ac.Get("signal"))
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				ac.Call("abort")
+			case <-stop:
+			}
+		}()
+	}
+
+	resp, err := await(js.Global().Call("fetch", req.URL.String(), init))
+	if err != nil {
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	buf, err := await(resp.Call("arrayBuffer"))
+	if err != nil {
+		return nil, err
+	}
+	body := bytesFrom(buf)
+	h := make(http.Header)
+	copyHeaders(h, resp.Get("headers"))
+	// The runtime already decoded the body but keeps the original header.
+	h.Del("Content-Encoding")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	status := resp.Get("status").Int()
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
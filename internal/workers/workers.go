@@ -0,0 +1,204 @@
+//go:build js && wasm
+
+// Package workers runs an http.Handler inside a Cloudflare Worker. The Go program
+// is compiled to WebAssembly (GOOS=js GOARCH=wasm) and loaded by a small module
+// worker that forwards each fetch event to the function Serve registers.
+package workers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall/js"
+)
+
+// FetchFunc is the global the JavaScript glue calls with each Request; it
+// returns a Promise of a Response.
+const FetchFunc = "giscusProxyFetch"
+
+// Serve registers h under FetchFunc and blocks forever, keeping the Go runtime
+// alive between requests.
+func Serve(h http.Handler) {
+	js.Global().Set(FetchFunc, js.FuncOf(func(_ js.Value, args []js.Value) any {
+		if len(args) == 0 {
+			return js.Global().Get("Promise").Call("reject", js.Global().Get("Error").New("missing request"))
+		}
+		req := args[0]
+		return newPromise(func() (js.Value, error) {
+			r, err := NewRequest(req)
+			if err != nil {
+				return newResponse(http.StatusBadRequest, http.Header{"Content-Type": {"text/plain; charset=utf-8"}}, []byte(err.Error())), nil
+			}
+			w := &responseWriter{header: make(http.Header)}
+			h.ServeHTTP(w, r)
+			w.WriteHeader(http.StatusOK)
+			return newResponse(w.status, w.header, w.body.Bytes()), nil
+		})
+	}))
+	select {}
+}
+
+// NewRequest converts a JavaScript Request into an http.Request. The client
+// address comes from CF-Connecting-IP, which Cloudflare always sets.
+func NewRequest(req js.Value) (*http.Request, error) {
+	var body io.Reader = http.NoBody
+	if !req.Get("body").IsNull() {
+		buf, err := await(req.Call("arrayBuffer"))
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(bytesFrom(buf))
+	}
+	r, err := http.NewRequest(req.Get("method").String(), req.Get("url").String(), body)
+	if err != nil {
+		return nil, err
+	}
+	copyHeaders(r.Header, req.Get("headers"))
+	r.Host = r.URL.Host
+	r.RequestURI = r.URL.RequestURI()
+	if ip := r.Header.Get("CF-Connecting-IP"); ip != "" {
+		r.RemoteAddr = net.JoinHostPort(ip, "0")
+	}
+	// Workers are reached over HTTPS; let the proxy build matching URLs.
+	if r.Header.Get("X-Forwarded-Proto") == "" {
+		r.Header.Set("X-Forwarded-Proto", r.URL.Scheme)
+	}
+	return r, nil
+}
+
+// copyHeaders adds every entry of a JavaScript Headers object to h.
+func copyHeaders(h http.Header, headers js.Value) {
+	it := headers.Call("entries")
+	for {
+		next := it.Call("next")
+		if next.Get("done").Bool() {
+			return
+		}
+		kv := next.Get("value")
+		h.Add(kv.Index(0).String(), kv.Index(1).String())
+	}
+}
+
+// newResponse builds a JavaScript Response.
+func newResponse(status int, header http.Header, body []byte) js.Value {
+	headers := js.Global().Get("Headers").New()
+	for k, vs := range header {
+		if isHopByHop(k) {
+			continue
+		}
+		for _, v := range vs {
+			headers.Call("append", k, v)
+		}
+	}
+	init := js.Global().Get("Object").New()
+	init.Set("status", status)
+	init.Set("headers", headers)
+	if header.Get("Content-Encoding") != "" {
+		// The body is already encoded; don't let the runtime compress it again.
+		init.Set("encodeBody", "manual")
+	}
+	var jsBody any = nil
+	// Null-body statuses reject any body, even an empty one.
+	if len(body) > 0 && status != http.StatusNoContent && status != http.StatusNotModified {
+		jsBody = bytesTo(body)
+	}
+	return js.Global().Get("Response").New(jsBody, init)
+}
+
+// newPromise runs fn on a goroutine, since blocking inside a js.Func callback
+// would deadlock the event loop, and settles the returned Promise with its result.
+func newPromise(fn func() (js.Value, error)) js.Value {
+	var executor js.Func
+	executor = js.FuncOf(func(_ js.Value, args []js.Value) any {
+		resolve, reject := args[0], args[1]
+		executor.Release()
+		go func() {
+			defer func() {
+				if v := recover(); v != nil {
+					reject.Invoke(js.Global().Get("Error").New("panic in handler"))
+				}
+			}()
+			v, err := fn()
+			if err != nil {
+				reject.Invoke(js.Global().Get("Error").New(err.Error()))
+				return
+			}
+			resolve.Invoke(v)
+		}()
+		return nil
+	})
+	return js.Global().Get("Promise").New(executor)
+}
+
+// await blocks the calling goroutine until the Promise settles.
+func await(promise js.Value) (js.Value, error) {
+	type result struct {
+		v   js.Value
+		err error
+	}
+	done := make(chan result, 1)
+	onResolve := js.FuncOf(func(_ js.Value, args []js.Value) any {
+		done <- result{v: args[0]}
+		return nil
+	})
+	onReject := js.FuncOf(func(_ js.Value, args []js.Value) any {
+		msg := "promise rejected"
+		if len(args) > 0 && args[0].Truthy() {
+			msg = args[0].Call("toString").String()
+		}
+		done <- result{err: errors.New(msg)}
+		return nil
+	})
+	defer onResolve.Release()
+	defer onReject.Release()
+	promise.Call("then", onResolve, onReject)
+	res := <-done
+	return res.v, res.err
+}
+
+// bytesFrom copies an ArrayBuffer into Go memory.
+func bytesFrom(buf js.Value) []byte {
+	u8 := js.Global().Get("Uint8Array").New(buf)
+	b := make([]byte, u8.Get("length").Int())
+	js.CopyBytesToGo(b, u8)
+	return b
+}
+
+// bytesTo copies b into a new Uint8Array.
+func bytesTo(b []byte) js.Value {
+	u8 := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(u8, b)
+	return u8
+}
+
+// responseWriter buffers a response; a Worker returns it in one piece.
+type responseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseWriter) Header() http.Header { return w.header }
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+// isHopByHop reports headers a Worker may not set on a Response.
+func isHopByHop(name string) bool {
+	switch strings.ToLower(name) {
+	case "connection", "keep-alive", "transfer-encoding", "upgrade":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+// Package giscusenv configures a giscusproxy.Proxy from the environment
+// variables and CONFIG_FILE the binary reads, and detects the public URL the
+// way the binary does. It is separate from giscusproxy because it links the
+// error reporting, StatsD and tracing exporters those settings can enable.
+package giscusenv
+
+import (
+	"os"
+
+	"github.com/cdlus/giscus-proxy/internal/config"
+	"github.com/cdlus/giscus-proxy/pkg/giscusproxy"
+)
+
+// Config reads the same configuration as the binary: CONFIG_FILE, then the
+// environment variables, including the upstream HTTP client settings. The
+// cache and tracer are left for the caller to set. Malformed values and
+// settings Config.Validate rejects are returned as an error.
+func Config() (giscusproxy.Config, error) {
+	if err := config.Load(os.Getenv("CONFIG_FILE")); err != nil {
+		return giscusproxy.Config{}, err
+	}
+	cfg, err := config.Proxy()
+	if err != nil {
+		return giscusproxy.Config{}, err
+	}
+	client, err := config.HTTPClient()
+	if err != nil {
+		return giscusproxy.Config{}, err
+	}
+	cfg.Client = client
+	if err := cfg.Validate(); err != nil {
+		return giscusproxy.Config{}, err
+	}
+	return cfg, nil
+}
+
+// RegisterURLResolver adds a way to detect the public URL on platforms the
+// built-in resolvers don't know. It runs after PUBLIC_URL and before them, and
+// should return "" when its platform isn't detected.
+func RegisterURLResolver(name string, resolve func() string) {
+	config.RegisterURLResolver(name, resolve)
+}
+
+// PublicURL returns the service's public URL from PUBLIC_URL, registered
+// resolvers or platform conventions (Railway, Fly.io, Render, Heroku, Vercel,
+// Cloud Run), or "" when none applies.
+func PublicURL() string {
+	return config.PublicURL()
+}
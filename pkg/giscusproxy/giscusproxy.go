@@ -0,0 +1,210 @@
+// Package giscusproxy is the importable API of giscus-proxy, for Go servers that
+// want to mount the proxy on their own mux instead of running the binary:
+//
+//	p := giscusproxy.New(giscusproxy.Config{
+//		PublicOrigin: "https://comments.example.com",
+//		Cache:        giscusproxy.NewMemoryCache(512),
+//	})
+//	mux.Handle("/", p)
+//
+// The types are aliases of the implementation, so values can be passed freely
+// between this package and code built on it.
+package giscusproxy
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/internal/cache"
+	"github.com/cdlus/giscus-proxy/internal/clock"
+	"github.com/cdlus/giscus-proxy/internal/proxy"
+	"github.com/cdlus/giscus-proxy/internal/statsd"
+)
+
+type (
+	// Proxy serves the giscus widget, client script and passthrough routes. It
+	// is an http.Handler.
+	Proxy = proxy.Proxy
+	// Config configures a Proxy. The zero value proxies giscus.app without a cache.
+	Config = proxy.Config
+	// Route is an entry of the route table returned by Proxy.Routes.
+	Route = proxy.Route
+	// Option sets one Config field for NewWithOptions.
+	Option = proxy.Option
+	// RequestOptions override settings for one request; see WithRequestOptions.
+	RequestOptions = proxy.RequestOptions
+	// HTTPClient sends upstream requests; *http.Client satisfies it.
+	HTTPClient = proxy.HTTPClient
+	// ErrorHandler writes error responses; see Config.ErrorHandler.
+	ErrorHandler = proxy.ErrorHandler
+	// ErrorReporter receives failures and recovered panics, e.g. for Sentry.
+	ErrorReporter = proxy.ErrorReporter
+	// Snippet is an HTML fragment injected into every widget document.
+	Snippet = proxy.Snippet
+	// Tenant holds per-site settings; see Config.Tenants.
+	Tenant = proxy.Tenant
+	// Profile is a named bundle of widget settings; see Config.Profiles.
+	Profile = proxy.Profile
+	// Transformer is a custom body rewrite; see Config.Transformers.
+	Transformer = proxy.Transformer
+	// TransformerFunc adapts a function to Transformer.
+	TransformerFunc = proxy.TransformerFunc
+
+	// Cache stores upstream responses. Implement it to plug in a shared cache.
+	Cache = cache.Cache
+	// SimpleCache is a Cache without context arguments; see AdaptCache.
+	SimpleCache = cache.Simple
+	// CacheEntry is a cached response.
+	CacheEntry = cache.Entry
+	// MemoryCache is the bundled in-process Cache.
+	MemoryCache = cache.MemoryCache
+
+	// MetricsRecorder receives request, upstream and cache measurements; see
+	// Config.MetricsRecorder.
+	MetricsRecorder = proxy.MetricsRecorder
+	// ErrorRecorder is an optional MetricsRecorder extension counting errors.
+	ErrorRecorder = proxy.ErrorRecorder
+	// NopRecorder discards every measurement.
+	NopRecorder = proxy.NopRecorder
+	// PrometheusRecorder exposes measurements in the Prometheus text format.
+	PrometheusRecorder = proxy.PrometheusRecorder
+
+	// Clock tells the time; see Config.Clock.
+	Clock = clock.Clock
+	// FakeClock is a Clock that only moves when advanced, for tests.
+	FakeClock = clock.Fake
+
+	// StatsDClient pushes metrics to a StatsD daemon; see Config.StatsD.
+	StatsDClient = statsd.Client
+)
+
+// Snippet placements understood by Snippet.Position.
+const (
+	PositionHeadStart = proxy.PositionHeadStart
+	PositionHead      = proxy.PositionHead
+	PositionBodyStart = proxy.PositionBodyStart
+	PositionBodyEnd   = proxy.PositionBodyEnd
+)
+
+// Notification formats understood by Config.WebhookRelayFormat.
+const (
+	RelaySlack   = proxy.RelaySlack
+	RelayDiscord = proxy.RelayDiscord
+	RelayJSON    = proxy.RelayJSON
+)
+
+// ErrPurgeUnsupported is returned by Proxy.Purge when the cache can't drop entries.
+var ErrPurgeUnsupported = proxy.ErrPurgeUnsupported
+
+// New builds a Proxy. Invalid settings are logged and ignored, as in the
+// binary; NewChecked rejects them instead.
+func New(cfg Config) *Proxy {
+	return proxy.New(cfg)
+}
+
+// NewChecked builds a Proxy after cfg.Validate, returning its error instead
+// when a setting is invalid, such as a malformed replacement rule or IP filter
+// that New would leave out.
+func NewChecked(cfg Config) (*Proxy, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return proxy.New(cfg), nil
+}
+
+// NewWithOptions builds a Proxy from options applied in order to the zero
+// Config, for code that only sets a few fields:
+//
+//	p := giscusproxy.NewWithOptions(
+//		giscusproxy.WithPublicOrigin("https://comments.example.com"),
+//		giscusproxy.WithCache(giscusproxy.NewMemoryCache(512)),
+//	)
+func NewWithOptions(opts ...Option) *Proxy {
+	return proxy.NewWithOptions(opts...)
+}
+
+// WithConfig replaces the whole Config; later options adjust it.
+func WithConfig(cfg Config) Option { return proxy.WithConfig(cfg) }
+
+// WithUpstream sets the giscus origin to proxy (default https://giscus.app).
+func WithUpstream(origin string) Option { return proxy.WithUpstream(origin) }
+
+// WithPublicOrigin sets the origin visitors use to reach the proxy.
+func WithPublicOrigin(origin string) Option { return proxy.WithPublicOrigin(origin) }
+
+// WithBasePath mounts the proxy under a path prefix.
+func WithBasePath(path string) Option { return proxy.WithBasePath(path) }
+
+// WithCache stores upstream responses in store.
+func WithCache(store Cache) Option { return proxy.WithCache(store) }
+
+// WithClient sends upstream requests through client.
+func WithClient(client HTTPClient) Option { return proxy.WithClient(client) }
+
+// WithTimeout bounds each upstream request made by the default client.
+func WithTimeout(d time.Duration) Option { return proxy.WithTimeout(d) }
+
+// WithLogger writes access and diagnostic logs to logger.
+func WithLogger(logger *log.Logger) Option { return proxy.WithLogger(logger) }
+
+// WithReplacements adds server-side LEFT=>RIGHT replacement rules.
+func WithReplacements(rules ...string) Option { return proxy.WithReplacements(rules...) }
+
+// WithTransformers adds custom body rewrites after any added earlier.
+func WithTransformers(ts ...Transformer) Option { return proxy.WithTransformers(ts...) }
+
+// WithSnippets adds HTML fragments injected into the widget document.
+func WithSnippets(snippets ...Snippet) Option { return proxy.WithSnippets(snippets...) }
+
+// WithErrorReporter notifies reporter of failures and recovered panics.
+func WithErrorReporter(reporter ErrorReporter) Option { return proxy.WithErrorReporter(reporter) }
+
+// WithRequestOptions returns a copy of ctx carrying per-request overrides. Attach
+// it before the proxy sees the request:
+//
+//	r = r.WithContext(giscusproxy.WithRequestOptions(r.Context(), giscusproxy.RequestOptions{
+//		UpstreamOrigin: "https://giscus.example.org",
+//	}))
+func WithRequestOptions(ctx context.Context, opts RequestOptions) context.Context {
+	return proxy.WithRequestOptions(ctx, opts)
+}
+
+// RequestOptionsFrom returns the overrides attached to ctx, or the zero value.
+func RequestOptionsFrom(ctx context.Context) RequestOptions {
+	return proxy.RequestOptionsFrom(ctx)
+}
+
+// Handler is shorthand for New(cfg).Handler().
+func Handler(cfg Config) http.Handler {
+	return proxy.New(cfg).Handler()
+}
+
+// NewMemoryCache returns an in-memory Cache holding at most maxEntries responses.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return cache.NewMemoryCache(maxEntries)
+}
+
+// AdaptCache turns a cache written against the context-free interface into a
+// Cache. Its Purge and Evictions methods, if any, keep working.
+func AdaptCache(c SimpleCache) Cache {
+	return cache.Adapt(c)
+}
+
+// NewPrometheusRecorder creates a recorder with the giscus_proxy_* metrics; mount
+// its Handler to expose them.
+func NewPrometheusRecorder() *PrometheusRecorder {
+	return proxy.NewPrometheusRecorder()
+}
+
+// NewFakeClock returns a FakeClock set to now. Pass it as Config.Clock and call
+// Advance to expire cached responses without sleeping.
+func NewFakeClock(now time.Time) *FakeClock {
+	return clock.NewFake(now)
+}
+
+// DialStatsD connects to a StatsD daemon at addr (host:port) over UDP.
+func DialStatsD(addr, prefix string, tags []string, datadog bool) (*StatsDClient, error) {
+	return statsd.Dial(addr, prefix, tags, datadog)
+}
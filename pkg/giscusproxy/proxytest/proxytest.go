@@ -0,0 +1,311 @@
+// Package proxytest provides a fake giscus upstream and assertion helpers for
+// end-to-end tests of giscus-proxy and code embedding it, without reaching
+// giscus.app:
+//
+//	func TestWidget(t *testing.T) {
+//		p, up := proxytest.NewProxy(t, giscusproxy.Config{})
+//		up.SetWidget(`<html><body>hello</body></html>`)
+//		rec := proxytest.Get(t, p, "/widget?repo=o/r")
+//		proxytest.AssertStatus(t, rec, http.StatusOK)
+//		proxytest.AssertContains(t, rec, "hello")
+//	}
+package proxytest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cdlus/giscus-proxy/pkg/giscusproxy"
+)
+
+// DefaultWidget is the widget document the fake upstream serves until SetWidget
+// replaces it. It references a script and stylesheet under /_next/ and carries
+// the "powered by giscus" footer the proxy removes.
+const DefaultWidget = `<!DOCTYPE html><html><head>` +
+	`<link rel="stylesheet" href="/_next/static/css/app.css">` +
+	`<script src="/_next/static/chunks/main.js" defer></script>` +
+	`</head><body><div class="gsc-main">Comments – powered by <a>giscus</a></div></body></html>`
+
+// DefaultClient is the client script served at /client.js. Like the real one, it
+// derives the widget origin from its own src.
+const DefaultClient = `(function(){var e=document.currentScript,n=new URL(e.src).origin;` +
+	`window.addEventListener("message",function(t){if(t.origin!==n)return});})();`
+
+// Asset is a fake upstream response.
+type Asset struct {
+	Status      int
+	ContentType string
+	Header      http.Header
+	Body        string
+}
+
+// Request is a request the fake upstream received.
+type Request struct {
+	Method string
+	Path   string
+	Query  string
+	Header http.Header
+}
+
+// Upstream is a fake giscus origin. Its URL goes into Config.UpstreamOrigin.
+// Every setter may be called while requests are in flight.
+type Upstream struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	widget   string
+	assets   map[string]Asset
+	latency  time.Duration
+	failures map[string]int
+	record   bool
+	requests []Request
+}
+
+// NewUpstream starts a fake upstream serving DefaultWidget at /widget and
+// /en/widget, DefaultClient at /client.js and small placeholder assets under
+// /_next/static/. It is closed when the test ends.
+func NewUpstream(tb testing.TB) *Upstream {
+	tb.Helper()
+	u := StartUpstream()
+	tb.Cleanup(u.Close)
+	return u
+}
+
+// StartUpstream starts the same fake upstream as NewUpstream outside a test,
+// e.g. for a load test. The caller closes it.
+func StartUpstream() *Upstream {
+	u := &Upstream{failures: make(map[string]int)}
+	u.Reset()
+	u.Server = httptest.NewServer(http.HandlerFunc(u.serve))
+	return u
+}
+
+// NewProxy starts a fake upstream and builds a proxy for it from cfg.
+func NewProxy(tb testing.TB, cfg giscusproxy.Config) (*giscusproxy.Proxy, *Upstream) {
+	tb.Helper()
+	up := NewUpstream(tb)
+	cfg.UpstreamOrigin = up.URL
+	p := giscusproxy.New(cfg)
+	tb.Cleanup(p.Close)
+	return p, up
+}
+
+// Reset restores the default documents, clears latency, failures and the
+// request log, and turns recording back on.
+func (u *Upstream) Reset() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.widget = DefaultWidget
+	u.assets = map[string]Asset{
+		"/client.js":                     {ContentType: "application/javascript", Body: DefaultClient},
+		"/_next/static/css/app.css":      {ContentType: "text/css", Body: `.gsc-main{color:#000}`},
+		"/_next/static/chunks/main.js":   {ContentType: "application/javascript", Body: `console.log("giscus")`},
+		"/_next/static/media/avatar.png": {ContentType: "image/png", Body: "\x89PNG\r\n\x1a\n"},
+	}
+	u.latency = 0
+	clear(u.failures)
+	u.record = true
+	u.requests = nil
+}
+
+// SetWidget replaces the widget document.
+func (u *Upstream) SetWidget(html string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.widget = html
+}
+
+// SetAsset serves a 200 response with body and content type at path.
+func (u *Upstream) SetAsset(path, contentType, body string) {
+	u.SetResponse(path, Asset{ContentType: contentType, Body: body})
+}
+
+// SetResponse serves a as the response for path.
+func (u *Upstream) SetResponse(path string, a Asset) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.assets[path] = a
+}
+
+// SetLatency delays every response by d.
+func (u *Upstream) SetLatency(d time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.latency = d
+}
+
+// SetRecording turns the request log read by Requests and RequestCount on or
+// off. It is on by default; long runs turn it off so the log doesn't grow.
+func (u *Upstream) SetRecording(on bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.record = on
+}
+
+// Fail answers requests whose path starts with prefix with status, or drops
+// the connection when status is 0. Use Heal to stop.
+func (u *Upstream) Fail(prefix string, status int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.failures[prefix] = status
+}
+
+// Heal stops failing requests under prefix.
+func (u *Upstream) Heal(prefix string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.failures, prefix)
+}
+
+// Requests returns the requests received so far, oldest first.
+func (u *Upstream) Requests() []Request {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]Request(nil), u.requests...)
+}
+
+// RequestCount reports how many requests for path were received.
+func (u *Upstream) RequestCount(path string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	n := 0
+	for _, r := range u.requests {
+		if r.Path == path {
+			n++
+		}
+	}
+	return n
+}
+
+func (u *Upstream) serve(w http.ResponseWriter, r *http.Request) {
+	u.mu.Lock()
+	if u.record {
+		u.requests = append(u.requests, Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery, Header: r.Header.Clone()})
+	}
+	latency, widget := u.latency, u.widget
+	asset, found := u.assets[r.URL.Path]
+	status, failing := 0, false
+	for prefix, s := range u.failures {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			status, failing = s, true
+			break
+		}
+	}
+	u.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if failing {
+		if status == 0 {
+			panic(http.ErrAbortHandler)
+		}
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	switch {
+	case r.URL.Path == "/widget" || r.URL.Path == "/en/widget":
+		asset, found = Asset{ContentType: "text/html; charset=utf-8", Body: widget}, true
+	case !found:
+		http.NotFound(w, r)
+		return
+	}
+	for k, vs := range asset.Header {
+		w.Header()[k] = vs
+	}
+	if asset.ContentType != "" {
+		w.Header().Set("Content-Type", asset.ContentType)
+	}
+	status = asset.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write([]byte(asset.Body))
+	}
+}
+
+// Get serves a GET request for target through h. headers are name, value pairs.
+func Get(tb testing.TB, h http.Handler, target string, headers ...string) *httptest.ResponseRecorder {
+	tb.Helper()
+	return Do(tb, h, httptest.NewRequest(http.MethodGet, target, nil), headers...)
+}
+
+// Do serves r through h after setting headers, given as name, value pairs.
+func Do(tb testing.TB, h http.Handler, r *http.Request, headers ...string) *httptest.ResponseRecorder {
+	tb.Helper()
+	if len(headers)%2 != 0 {
+		tb.Fatalf("proxytest: headers must be name, value pairs, got %d values", len(headers))
+	}
+	for i := 0; i < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	return rec
+}
+
+// AssertStatus fails the test unless the response has status want.
+func AssertStatus(tb testing.TB, rec *httptest.ResponseRecorder, want int) {
+	tb.Helper()
+	if rec.Code != want {
+		tb.Errorf("status = %d, want %d; body: %s", rec.Code, want, abbreviate(rec.Body.String()))
+	}
+}
+
+// AssertHeader fails the test unless header key of the response equals want.
+func AssertHeader(tb testing.TB, rec *httptest.ResponseRecorder, key, want string) {
+	tb.Helper()
+	if got := rec.Header().Get(key); got != want {
+		tb.Errorf("header %s = %q, want %q", key, got, want)
+	}
+}
+
+// AssertContains fails the test unless the body contains every substring.
+func AssertContains(tb testing.TB, rec *httptest.ResponseRecorder, substrs ...string) {
+	tb.Helper()
+	body := rec.Body.String()
+	for _, s := range substrs {
+		if !strings.Contains(body, s) {
+			tb.Errorf("body does not contain %q; body: %s", s, abbreviate(body))
+		}
+	}
+}
+
+// AssertNotContains fails the test if the body contains any of the substrings.
+func AssertNotContains(tb testing.TB, rec *httptest.ResponseRecorder, substrs ...string) {
+	tb.Helper()
+	body := rec.Body.String()
+	for _, s := range substrs {
+		if strings.Contains(body, s) {
+			tb.Errorf("body contains %q; body: %s", s, abbreviate(body))
+		}
+	}
+}
+
+// AssertUpstreamRequests fails the test unless the upstream received n
+// requests for path, e.g. to check that a response was served from the cache.
+func AssertUpstreamRequests(tb testing.TB, u *Upstream, path string, n int) {
+	tb.Helper()
+	if got := u.RequestCount(path); got != n {
+		tb.Errorf("upstream requests for %s = %d, want %d", path, got, n)
+	}
+}
+
+// abbreviate shortens bodies quoted in failure messages.
+func abbreviate(s string) string {
+	const limit = 512
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit] + "…"
+}
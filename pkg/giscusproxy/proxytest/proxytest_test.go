@@ -0,0 +1,58 @@
+package proxytest_test
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/cdlus/giscus-proxy/pkg/giscusproxy"
+	"github.com/cdlus/giscus-proxy/pkg/giscusproxy/proxytest"
+)
+
+func newProxy(t *testing.T, cfg giscusproxy.Config) (*giscusproxy.Proxy, *proxytest.Upstream) {
+	t.Helper()
+	cfg.Logger = log.New(io.Discard, "", 0)
+	return proxytest.NewProxy(t, cfg)
+}
+
+func TestWidgetRewriting(t *testing.T) {
+	p, up := newProxy(t, giscusproxy.Config{
+		Replacements: []string{"Comments=>Discussion of {{query.term}}"},
+	})
+
+	rec := proxytest.Get(t, p, "/widget?repo=o/r&term=a%22b")
+	proxytest.AssertStatus(t, rec, http.StatusOK)
+	proxytest.AssertHeader(t, rec, "Content-Type", "text/html; charset=utf-8")
+	proxytest.AssertContains(t, rec, `href="/_next/static/css/app.css"`, "Discussion of a&#34;b")
+	proxytest.AssertNotContains(t, rec, "powered by", "giscus</a>", `a"b`)
+
+	reqs := up.Requests()
+	if len(reqs) != 1 || reqs[0].Path != "/en/widget" {
+		t.Fatalf("upstream requests = %+v, want one for /en/widget", reqs)
+	}
+	if !strings.Contains(reqs[0].Query, "repo=o%2Fr") {
+		t.Errorf("upstream query = %q, want the widget's parameters", reqs[0].Query)
+	}
+}
+
+func TestClientPassthrough(t *testing.T) {
+	p, up := newProxy(t, giscusproxy.Config{Cache: giscusproxy.NewMemoryCache(16)})
+	up.SetResponse("/client.js", proxytest.Asset{
+		ContentType: "text/javascript; charset=utf-8",
+		Header:      http.Header{"Cache-Control": {"public, max-age=3600"}},
+		Body:        proxytest.DefaultClient,
+	})
+
+	for range 2 {
+		rec := proxytest.Get(t, p, "/client.js")
+		proxytest.AssertStatus(t, rec, http.StatusOK)
+		proxytest.AssertHeader(t, rec, "Content-Type", "text/javascript; charset=utf-8")
+		if got := rec.Body.String(); got != proxytest.DefaultClient {
+			t.Errorf("body = %q, want the upstream client unchanged", got)
+		}
+	}
+	proxytest.AssertUpstreamRequests(t, up, "/client.js", 1)
+	proxytest.AssertUpstreamRequests(t, up, "/en/widget", 0)
+}
@@ -0,0 +1,28 @@
+// Cloudflare Workers entry point: boots the Go WebAssembly build of the proxy
+// once per isolate and hands every request to it.
+import "./wasm_exec.js";
+import wasm from "./giscus-proxy.wasm";
+
+let ready;
+
+function start(env) {
+  if (!ready) {
+    const go = new Go();
+    // Plain-text variables and secrets become the Go program's environment.
+    go.env = Object.fromEntries(
+      Object.entries(env).filter(([, v]) => typeof v === "string"),
+    );
+    ready = WebAssembly.instantiate(wasm, go.importObject).then((instance) => {
+      // run() returns once main blocks, after the fetch function is registered.
+      go.run(instance);
+    });
+  }
+  return ready;
+}
+
+export default {
+  async fetch(request, env) {
+    await start(env);
+    return globalThis.giscusProxyFetch(request);
+  },
+};